@@ -6,6 +6,7 @@ import (
 	"errors"
 	"explore-api/model"
 	"explore-api/tool"
+	"shared/config"
 
 	"net/url"
 	"strconv"
@@ -21,12 +22,14 @@ import (
 
 type Database struct {
 	Client *mongo.Client
+	// Name is the database the collections are read from
+	Name string
 }
 
-// collection list of database. 
+// collection list of database.
 const (
-	kindServices        = "services"
-	kindServiceUsages   = "serviceUsages"
+	kindServices      = "services"
+	kindServiceUsages = "serviceUsages"
 )
 
 var MongoCommand = map[string]string{
@@ -41,16 +44,16 @@ var MongoCommand = map[string]string{
 	"<=":  "$lte",
 }
 
-//ต่อ mongodb
-func Connect(uri string) (*Database, error) {
-	ctx, cancle := context.WithTimeout(context.Background(), 10*time.Second)
+// ต่อ mongodb
+func Connect(cfg config.Mongo) (*Database, error) {
+	ctx, cancle := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancle()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(cfg.URI))
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancle = context.WithTimeout(context.Background(), 5*time.Second)
+	ctx, cancle = context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancle()
 
 	err = client.Ping(ctx, readpref.Primary())
@@ -58,10 +61,10 @@ func Connect(uri string) (*Database, error) {
 		return nil, err
 	}
 
-	return &Database{Client: client}, nil
+	return &Database{Client: client, Name: cfg.Database}, nil
 }
 
-// OptionSortBson function 
+// OptionSortBson function
 func OptionSortBson(value string) (bson.D, error) {
 	order := bson.D{}
 
@@ -102,8 +105,6 @@ func OptionSortBson(value string) (bson.D, error) {
 	return order, nil
 }
 
-
-
 func GenerateFilterBson(queryParams url.Values, ignorequeryParams []string) []bson.M {
 	and := []bson.M{}
 
@@ -156,19 +157,15 @@ func GenerateFilterBson(queryParams url.Values, ignorequeryParams []string) []bs
 	return and
 }
 
-
-
-
-
-//filter เพื่อ query ข้อมูลใน mongo
+// filter เพื่อ query ข้อมูลใน mongo
 func FilterToBsonM(filter *model.ExploreFilter) (bson.M, error) {
 	var err error
 
 	query := bson.M{}
 
 	ops := []string{}
-	
-	logicalOps := []string{"and", "or"} 
+
+	logicalOps := []string{"and", "or"}
 	compareOps := []string{"=", "!=", "<>", ">", ">=", "<", "<="}
 
 	ops = append(ops, logicalOps...)
@@ -229,7 +226,7 @@ func FilterToBsonM(filter *model.ExploreFilter) (bson.M, error) {
 
 		//
 		// hard code
-		//		
+		//
 		var value interface{}
 
 		if tool.IsStringInSlice(key, []string{"time", "createdAt", "updatedAt", "datetime"}) {
@@ -260,9 +257,6 @@ func FilterToBsonM(filter *model.ExploreFilter) (bson.M, error) {
 	return query, nil
 }
 
-
-
-
 func ChangeKeyId(key string) string {
 	keyElems := strings.Split(key, ".")
 
@@ -5,7 +5,7 @@ import (
 	"encoding/json"
 	"explore-api/database"
 	"explore-api/model"
-	"explore-api/tool"
+	"explore-api/problem"
 	"net/http"
 	"strings"
 
@@ -20,19 +20,14 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 	err = c.Bind(body)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, &model.Exception{
-			Status: tool.IntToPointer(http.StatusBadRequest),
-			Detail: err.(*echo.HTTPError).Message.(string),
-		})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
 	}
 
 	pipeline := []bson.M{}
 	match := bson.M{}
 
-
-
 	//
-	// filter stage 
+	// filter stage
 	//
 	if body.Filter != nil {
 
@@ -46,10 +41,7 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 			var arg *model.ExploreFilter
 			err = json.Unmarshal(b, &arg)
 			if err != nil {
-				return c.JSON(http.StatusBadRequest, &model.Exception{
-					Status: tool.IntToPointer(http.StatusBadRequest),
-					Detail: "Body 'filter' is invalid",
-				})
+				return problem.Write(c, http.StatusBadRequest, "Body 'filter' is invalid")
 			}
 		}
 
@@ -57,14 +49,11 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 		match, err = database.FilterToBsonM(body.Filter)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, &model.Exception{
-				Status: tool.IntToPointer(http.StatusBadRequest),
-				Detail: "Body 'filter' is invalid, " + err.Error(),
-			})
+			return problem.Write(c, http.StatusBadRequest, "Body 'filter' is invalid, "+err.Error())
 		}
 	}
 
-	// 
+	//
 	// match stage
 	//
 	if len(match) > 0 {
@@ -73,10 +62,6 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 		})
 	}
 
-
-
-
-
 	//
 	// group
 	//
@@ -96,9 +81,9 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 	} else {
 		group["_id"] = nil
 	}
-	
-	//aggregate 
-	for _, ag := range body.Aggregate { 
+
+	//aggregate
+	for _, ag := range body.Aggregate {
 		column := strings.ReplaceAll(ag.Column, ".", "_")
 
 		aggregate := bson.M{}
@@ -110,14 +95,11 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 		}
 		group[column] = aggregate
 	}
-	
+
 	pipeline = append(pipeline, bson.M{
 		"$group": group,
 	})
 
-
-
-
 	//
 	// project
 	//
@@ -143,9 +125,6 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 		"$project": project,
 	})
 
-
-
-
 	//
 	// sort
 	//
@@ -176,9 +155,6 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 		"$sort": sort,
 	})
 
-
-
-
 	//
 	// offset stage
 	//
@@ -191,11 +167,6 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 		"$skip": offset,
 	})
 
-
-
-
-	
-
 	//
 	// limit stage
 	//
@@ -208,18 +179,12 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 		"$limit": limit,
 	})
 
-
-	
-
 	//
 	// result ผลลัพธ์
 	//
 	aggServiceUsages, err := h.DB.AggregateServiceUsage(context.Background(), pipeline)
 	if err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, &model.Exception{
-			Status: tool.IntToPointer(http.StatusUnprocessableEntity),
-			Detail: "Could not explore service usages, " + err.Error(),
-		})
+		return problem.Write(c, http.StatusUnprocessableEntity, "Could not explore service usages, "+err.Error())
 	}
 
 	results := []interface{}{}
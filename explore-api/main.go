@@ -1,3 +1,86 @@
 package main
 
-func main() {}
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"explore-api/database"
+	"explore-api/handler"
+	"explore-api/problem"
+	"shared/config"
+	"shared/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+// Config is the configuration of the api
+type Config struct {
+	Server config.Server `yaml:"server"`
+	Mongo  config.Mongo  `yaml:"mongo"`
+}
+
+// loadConfig reads the configuration, see config.Load. API_DB_NAME, the
+// variable the database was named by before MONGO_DATABASE, is its default
+func loadConfig() (*Config, error) {
+	cfg := &Config{Mongo: config.Mongo{Database: os.Getenv("API_DB_NAME")}}
+	if err := config.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func main() {
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(problem.RequestID)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	db, err := database.Connect(cfg.Mongo)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	checker := health.New()
+	checker.Add("mongo", health.Mongo(db.Client))
+	e.GET("/healthz", echo.WrapHandler(http.HandlerFunc(health.Live)))
+	e.GET("/readyz", echo.WrapHandler(checker))
+
+	h := &handler.Handler{DB: db}
+	e.POST("/explore", h.ExploreServiceUsages)
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := e.Start(cfg.Server.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	// the probes see the service is not ready while it still serves
+	checker.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
+
+	// the requests in flight finish, then the client disconnects, both within
+	// the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
+	if err := db.Client.Disconnect(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
+}
@@ -4,14 +4,17 @@ import "go.mongodb.org/mongo-driver/bson/primitive"
 
 // Exception model     //error response
 type Exception struct {
-	Code   string `json:"code,omitempty"`
-	Type   string `json:"type,omitempty"`
-	Title  string `json:"title,omitempty"`
-	Status *int   `json:"status,omitempty"`
-	Detail string `json:"detail,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Title     string      `json:"title,omitempty"`
+	Status    *int        `json:"status,omitempty"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
 }
 
-// Explore model 
+// Explore model
 type ExploreRequest struct {
 	Columns   []*ExploreColumn    `json:"columns,omitempty"`
 	Aggregate []*ExploreAggregate `json:"aggregate,omitempty"`
@@ -26,27 +29,25 @@ type ExploreColumn struct {
 	Alias string `json:"alias,omitempty"`
 }
 
-//
 type ExploreAggregate struct {
 	Column    string `json:"column,omitempty"`
 	Aggregate string `json:"aggregate,omitempty"`
 	Alias     string `json:"alias,omitempty"`
 }
 
-//filter 
+// filter
 type ExploreFilter struct {
 	Operator  string        `json:"op,omitempty"`
 	Arguments []interface{} `json:"args,omitempty"`
 }
 
-//sort 
+// sort
 type ExploreSort struct {
 	Column    string `json:"column,omitempty" bson:"column,omitempty"`
 	Direction string `json:"direction,omitempty" bson:"direction,omitempty"`
 }
 
-
-// Results response 
+// Results response
 type Explores struct {
 	NumberMatched  *int          `json:"numberMatched,omitempty"`
 	NumberReturned *int          `json:"numberReturned,omitempty"`
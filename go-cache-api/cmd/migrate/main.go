@@ -0,0 +1,27 @@
+// Command migrate applies the migrations of the database or lists them.
+//
+//	go run ./cmd/migrate up
+//	go run ./cmd/migrate status
+package main
+
+import (
+	"go-cache-api/configs"
+	"go-cache-api/migrations"
+	"shared/migrate"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func main() {
+	migrate.Main(func() (*mongo.Database, []migrate.Migration, error) {
+		cfg, err := configs.Load()
+		if err != nil {
+			return nil, nil, err
+		}
+		key, err := cfg.Import.Key()
+		if err != nil {
+			return nil, nil, err
+		}
+		return configs.ConnectDB(cfg.Mongo).Database(cfg.Mongo.Database), migrations.All(key), nil
+	})
+}
@@ -0,0 +1,100 @@
+package configs
+
+import (
+	"errors"
+	"time"
+
+	"go-cache-api/importer"
+	"shared/config"
+)
+
+// Config is the configuration of the api, it is loaded once at start by Load
+type Config struct {
+	Server config.Server `yaml:"server"`
+	Mongo  config.Mongo  `yaml:"mongo"`
+	Redis  config.Redis  `yaml:"redis"`
+
+	// MigrateOnStart applies the pending migrations when the api starts.
+	// Without it they are applied with go run ./cmd/migrate up
+	MigrateOnStart bool `yaml:"migrateOnStart" env:"MIGRATE_ON_START" default:"true"`
+
+	SoftDelete  SoftDelete  `yaml:"softDelete"`
+	Idempotency Idempotency `yaml:"idempotency"`
+	Import      Import      `yaml:"import"`
+}
+
+// SoftDelete is how long soft deleted documents stay in the trash
+type SoftDelete struct {
+	RetentionDays int `yaml:"retentionDays" env:"SOFT_DELETE_RETENTION_DAYS" default:"30"`
+}
+
+// Retention is the time a document stays in the trash before being purged
+func (s SoftDelete) Retention() time.Duration {
+	return time.Duration(s.RetentionDays) * 24 * time.Hour
+}
+
+func (s *SoftDelete) Validate() error {
+	if s.RetentionDays < 1 {
+		return errors.New("retentionDays should be a positive number of days")
+	}
+	return nil
+}
+
+// Idempotency is how long the response to an Idempotency-Key is kept
+type Idempotency struct {
+	KeyTTLHours int `yaml:"keyTTLHours" env:"IDEMPOTENCY_KEY_TTL_HOURS" default:"24"`
+}
+
+// TTL is the time the response to a key is replayed
+func (i Idempotency) TTL() time.Duration {
+	return time.Duration(i.KeyTTLHours) * time.Hour
+}
+
+func (i *Idempotency) Validate() error {
+	if i.KeyTTLHours < 1 {
+		return errors.New("keyTTLHours should be a positive number of hours")
+	}
+	return nil
+}
+
+// Import is how imported rows are read and matched to the exports
+type Import struct {
+	// NaturalKey lists the fields identifying an export row, an imported row
+	// matching an export on all of them updates it
+	NaturalKey []string `yaml:"naturalKey" env:"IMPORT_NATURAL_KEY"`
+	// MappingsFile is the json file of the column mappings of imports, the
+	// built in mappings are used without it
+	MappingsFile string `yaml:"mappingsFile" env:"IMPORT_MAPPINGS_FILE"`
+}
+
+func (i *Import) Validate() error {
+	if _, err := i.Key(); err != nil {
+		return err
+	}
+	if _, err := importer.LoadMappings(i.MappingsFile); err != nil {
+		return err
+	}
+	return nil
+}
+
+// Key is the natural key of exports, the default one unless another is configured
+func (i Import) Key() (importer.NaturalKey, error) {
+	if len(i.NaturalKey) == 0 {
+		return importer.NewNaturalKey(importer.DefaultNaturalKey)
+	}
+	return importer.NewNaturalKey(i.NaturalKey)
+}
+
+// Load reads the configuration from the environment, the optional .env and
+// yaml files and the defaults, see config.Load. An invalid configuration is
+// an error so the api does not start with it
+func Load() (*Config, error) {
+	cfg := &Config{
+		Mongo:  config.Mongo{Database: "project-api-cache"},
+		Import: Import{NaturalKey: importer.DefaultNaturalKey},
+	}
+	if err := config.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -0,0 +1,167 @@
+package configs
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// FilterField is a model field clients may filter on with the query string
+type FilterField struct {
+	Key  string
+	Type reflect.Type
+}
+
+// range operators allowed as field[op]=value
+var FilterOperators = map[string]string{
+	"eq":  "$eq",
+	"ne":  "$ne",
+	"gt":  "$gt",
+	"gte": "$gte",
+	"lt":  "$lt",
+	"lte": "$lte",
+}
+
+var (
+	timeType     = reflect.TypeOf(time.Time{})
+	objectIDType = reflect.TypeOf(primitive.ObjectID{})
+)
+
+// FilterFields builds the allow-list of filterable fields of model, keyed by
+// their json name. Only the listed json names are allowed
+func FilterFields(model interface{}, names ...string) map[string]FilterField {
+	fields := map[string]FilterField{}
+
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		if !IsStringInSlice(jsonName, names) {
+			continue
+		}
+
+		fieldType := f.Type
+		if fieldType.Kind() == reflect.Ptr {
+			fieldType = fieldType.Elem()
+		}
+
+		fields[jsonName] = FilterField{
+			Key:  strings.Split(f.Tag.Get("bson"), ",")[0],
+			Type: fieldType,
+		}
+	}
+
+	return fields
+}
+
+// coerce converts a query string value to the type of the field
+func (f FilterField) coerce(value string) (interface{}, error) {
+	switch {
+	case f.Type == timeType:
+		for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+			if t, err := time.Parse(layout, value); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("'%s' is not a valid date", value)
+	case f.Type == objectIDType:
+		return primitive.ObjectIDFromHex(value)
+	case f.Type.Kind() == reflect.Int:
+		return strconv.Atoi(value)
+	case f.Type.Kind() == reflect.Float64:
+		return strconv.ParseFloat(value, 64)
+	case f.Type.Kind() == reflect.Bool:
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
+
+// splitFilterKey splits "year[gte]" into "year" and "gte"
+func splitFilterKey(key string) (string, string) {
+	if i := strings.Index(key, "["); i != -1 && strings.HasSuffix(key, "]") {
+		return key[:i], key[i+1 : len(key)-1]
+	}
+	return key, ""
+}
+
+// GenerateFilterBson turns the query string into a list of conditions to be
+// combined with $and. Comma separated values of a field are combined with $or,
+// "*" is a wildcard on string fields and field[op]=value applies a range operator.
+// Parameters outside of allowed are rejected
+func GenerateFilterBson(queryParams url.Values, ignorequeryParams []string, allowed map[string]FilterField) ([]bson.M, error) {
+	and := []bson.M{}
+
+	for key, values := range queryParams {
+		if IsStringInSlice(key, ignorequeryParams) {
+			continue
+		}
+
+		name, op := splitFilterKey(key)
+
+		field, ok := allowed[name]
+		if !ok {
+			return nil, fmt.Errorf("filter on '%s' is not supported", name)
+		}
+
+		if op != "" {
+			command, ok := FilterOperators[op]
+			if !ok {
+				return nil, fmt.Errorf("not support operator '%s' on '%s'", op, name)
+			}
+
+			for _, v := range values {
+				value, err := field.coerce(strings.TrimSpace(v))
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for '%s': %s", key, err.Error())
+				}
+				and = append(and, bson.M{field.Key: bson.M{command: value}})
+			}
+			continue
+		}
+
+		or := []bson.M{}
+		for _, v := range values {
+			for _, vs := range strings.Split(v, ",") {
+				vs = strings.TrimSpace(vs)
+				if vs == "" {
+					continue
+				}
+
+				if field.Type.Kind() == reflect.String && strings.Contains(vs, "*") {
+					or = append(or, bson.M{field.Key: primitive.Regex{Pattern: wildcardPattern(vs), Options: "i"}})
+					continue
+				}
+
+				value, err := field.coerce(vs)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value for '%s': %s", key, err.Error())
+				}
+				or = append(or, bson.M{field.Key: value})
+			}
+		}
+
+		if len(or) > 0 {
+			and = append(and, bson.M{"$or": or})
+		}
+	}
+
+	return and, nil
+}
+
+// wildcardPattern turns "*rice*" into an anchored regex, the rest of the value is matched literally
+func wildcardPattern(value string) string {
+	parts := strings.Split(value, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+	return "^" + strings.Join(parts, ".*") + "$"
+}
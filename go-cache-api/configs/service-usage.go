@@ -12,36 +12,18 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
-	"go.mongodb.org/mongo-driver/mongo/readpref"
 )
 
+// Database is the database explorations run on
 type Database struct {
 	Client *mongo.Client
+	Name   string
 }
 
 const (
 	exports = "exports"
 )
 
-func Connect(uri string) (*Database, error) {
-	ctx, cancle := context.WithTimeout(context.Background(), 10*time.Second)
-	defer cancle()
-	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri))
-	if err != nil { 
-		return nil, err
-	}
-
-	ctx, cancle = context.WithTimeout(context.Background(), 5*time.Second)
-	defer cancle()
-
-	err = client.Ping(ctx, readpref.Primary())
-	if err != nil {
-		return nil, err
-	}
-
-	return &Database{Client: client}, nil
-}
-
 func IntToPointer(i int) *int {
 	return &i
 }
@@ -184,7 +166,7 @@ func FilterToBsonM(filter *models.ExploreFilter) (bson.M, error) {
 }
 
 func (db *Database) AggregateServiceUsage(ctx context.Context, pipeline interface{}, opts ...*options.AggregateOptions) ([]bson.M, error) {
-	collection := GetCollection(ConnectDB(), exports)
+	collection := db.Client.Database(db.Name).Collection(exports)
 	cur, err := collection.Aggregate(ctx, pipeline)
 	// defer cur.Close(ctx)
 	if err != nil {
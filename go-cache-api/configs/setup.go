@@ -3,20 +3,22 @@ package configs
 import (
 	"context"
 	"log"
-	"time"
+
+	"shared/config"
 
 	"github.com/redis/go-redis/v9"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func ConnectDB() *mongo.Client {
-	client, err := mongo.NewClient(options.Client().ApplyURI(EnvMongoURI()))
+// ConnectDB connects to the mongo of cfg, the api does not start without it
+func ConnectDB(cfg config.Mongo) *mongo.Client {
+	client, err := mongo.NewClient(options.Client().ApplyURI(cfg.URI))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
 	err = client.Connect(ctx)
@@ -32,37 +34,19 @@ func ConnectDB() *mongo.Client {
 	return client
 }
 
-
-
-func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	collection := client.Database("project-api-cache").Collection(collectionName)
-	return collection
-}
-
-
-
-func ConnectRedis() *redis.Client {
+// ConnectRedis connects to the redis of cfg, the api does not start without it
+func ConnectRedis(cfg config.Redis) *redis.Client {
 	ctx := context.Background()
 	redisClient := redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
-		Password: "",
-		DB:   0,
+		Addr:     cfg.Addr,
+		Password: cfg.Password,
+		DB:       cfg.DB,
 	})
 
 	_, err := redisClient.Ping(ctx).Result()
-    if err != nil {
-        log.Fatalln("Redis connection was refused", err)
-    }
+	if err != nil {
+		log.Fatalln("Redis connection was refused", err)
+	}
 
 	return redisClient
 }
-
-
-
-
-
-
-
-
-
-
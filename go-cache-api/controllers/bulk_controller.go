@@ -0,0 +1,363 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"go-cache-api/models"
+	"go-cache-api/patch"
+	"go-cache-api/problem"
+	"go-cache-api/response"
+	"go-cache-api/validation"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const bulkMaxOperations = 1000
+
+// bulkResource is a collection bulk writes can target
+type bulkResource struct {
+	collection *mongo.Collection
+	audit      auditResource
+	newModel   func() interface{}
+	// validate returns the check of a model written during ctx
+	validate func(ctx context.Context) func(interface{}) error
+}
+
+// decodeDocument decodes a JSON document into model, unknown fields are rejected
+func decodeDocument(raw json.RawMessage, model interface{}) error {
+	if len(raw) == 0 {
+		return errors.New("document is required")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(model)
+}
+
+// toBsonM returns the bson fields of model
+func toBsonM(model interface{}) (bson.M, error) {
+	raw, err := bson.Marshal(model)
+	if err != nil {
+		return nil, err
+	}
+
+	var values bson.M
+	err = bson.Unmarshal(raw, &values)
+	return values, err
+}
+
+// findExisting loads the documents of ids that are not in the trash
+func (r bulkResource) findExisting(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]interface{}, error) {
+	existing := map[primitive.ObjectID]interface{}{}
+	if len(ids) == 0 {
+		return existing, nil
+	}
+
+	filter := notDeleted()
+	filter["_id"] = bson.M{"$in": ids}
+
+	cur, err := r.collection.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		model := r.newModel()
+		if err := cur.Decode(model); err != nil {
+			return nil, err
+		}
+		existing[cur.Current.Lookup("_id").ObjectID()] = model
+	}
+
+	return existing, cur.Err()
+}
+
+// writeModel turns op into the mongo write to run, it returns the status the
+// item gets when the write succeeds
+func (r bulkResource) writeModel(ctx context.Context, op models.BulkOperation, id primitive.ObjectID, existing map[primitive.ObjectID]interface{}, now time.Time) (mongo.WriteModel, string, error) {
+	validate := r.validate(ctx)
+
+	switch op.Op {
+	case "insert":
+		model := r.newModel()
+		if err := decodeDocument(op.Document, model); err != nil {
+			return nil, "", err
+		}
+		if err := validate(model); err != nil {
+			return nil, "", err
+		}
+
+		values, err := toBsonM(model)
+		if err != nil {
+			return nil, "", err
+		}
+		delete(values, deletedAtField)
+		delete(values, importField)
+		values["_id"] = id
+		values["createdAt"] = now
+		values["updatedAt"] = now
+
+		return mongo.NewInsertOneModel().SetDocument(values), "inserted", nil
+
+	case "upsert":
+		model := r.newModel()
+		if err := decodeDocument(op.Document, model); err != nil {
+			return nil, "", err
+		}
+		if err := validate(model); err != nil {
+			return nil, "", err
+		}
+
+		values, err := toBsonM(model)
+		if err != nil {
+			return nil, "", err
+		}
+		delete(values, "_id")
+		delete(values, "createdAt")
+		delete(values, deletedAtField)
+		delete(values, importField)
+		values["updatedAt"] = now
+
+		update := bson.M{
+			"$set":         values,
+			"$setOnInsert": bson.M{"createdAt": now},
+			"$unset":       bson.M{deletedAtField: ""},
+		}
+
+		return mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": id}).SetUpdate(update).SetUpsert(true), "updated", nil
+
+	case "update":
+		current, ok := existing[id]
+		if !ok {
+			return nil, "not_found", errors.New("document not found")
+		}
+
+		update, err := applyPatch(current, patch.MergePatchType, op.Document, r.newModel(), validate)
+		if err != nil {
+			return nil, "", err
+		}
+		if len(update) == 0 {
+			return nil, "unchanged", nil
+		}
+
+		set, ok := update["$set"].(bson.M)
+		if !ok {
+			set = bson.M{}
+			update["$set"] = set
+		}
+		set["updatedAt"] = now
+
+		filter := notDeleted()
+		filter["_id"] = id
+
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update), "updated", nil
+
+	case "delete":
+		if _, ok := existing[id]; !ok {
+			return nil, "not_found", errors.New("document not found")
+		}
+
+		if op.Hard {
+			return mongo.NewDeleteOneModel().SetFilter(bson.M{"_id": id}), "deleted", nil
+		}
+
+		filter := notDeleted()
+		filter["_id"] = id
+
+		return mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(bson.M{"$set": bson.M{deletedAtField: now}}), "deleted", nil
+	}
+
+	return nil, "", errors.New("op should be insert, update, upsert or delete")
+}
+
+// bulkActions is the history action of each successful bulk status
+var bulkActions = map[string]string{
+	"inserted": "create",
+	"upserted": "create",
+	"updated":  "update",
+	"deleted":  "delete",
+}
+
+// recordBulk writes the history of the operations that were written
+func (r bulkResource) recordBulk(ctx context.Context, c echo.Context, results []response.BulkItemResult, writeIndex []int, ids []primitive.ObjectID, before map[primitive.ObjectID]bson.M) {
+	written := map[string][]primitive.ObjectID{}
+	for _, i := range writeIndex {
+		if action, ok := bulkActions[results[i].Status]; ok {
+			written[action] = append(written[action], ids[i])
+		}
+	}
+
+	for action, actionIds := range written {
+		r.audit.record(ctx, c, action, before, actionIds...)
+	}
+}
+
+// bulkWrite runs a mixed batch of operations with a single BulkWrite and
+// reports a status for every operation
+func bulkWrite(c echo.Context, r bulkResource) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	var body models.BulkRequest
+	if err := c.Bind(&body); err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
+	}
+
+	if len(body.Operations) == 0 {
+		return problem.Write(c, http.StatusBadRequest, "operations is required")
+	}
+	if len(body.Operations) > bulkMaxOperations {
+		return problem.Write(c, http.StatusBadRequest, "at most "+strconv.Itoa(bulkMaxOperations)+" operations are allowed")
+	}
+
+	ordered := true
+	if body.Ordered != nil {
+		ordered = *body.Ordered
+	}
+
+	res := response.BulkResponse{Ordered: ordered, Results: make([]response.BulkItemResult, len(body.Operations))}
+
+	// ids of every operation, insert gets a new one
+	ids := make([]primitive.ObjectID, len(body.Operations))
+	lookup := []primitive.ObjectID{}
+	for i, op := range body.Operations {
+		res.Results[i] = response.BulkItemResult{Index: i, Op: op.Op, ID: op.ID}
+
+		if op.Op == "insert" {
+			ids[i] = primitive.NewObjectID()
+			res.Results[i].ID = ids[i].Hex()
+			continue
+		}
+
+		id, err := primitive.ObjectIDFromHex(op.ID)
+		if err != nil {
+			continue
+		}
+		ids[i] = id
+		if op.Op == "update" || op.Op == "delete" {
+			lookup = append(lookup, id)
+		}
+	}
+
+	existing, err := r.findExisting(ctx, lookup)
+	if err != nil {
+		return problem.Mongo(c, err, "Failed to write operations")
+	}
+
+	now := time.Now()
+
+	// writes holds the mongo operations, writeIndex their index in the request
+	writes := []mongo.WriteModel{}
+	writeIndex := []int{}
+	stopped := false
+
+	for i, op := range body.Operations {
+		item := &res.Results[i]
+
+		if stopped {
+			item.Status = "skipped"
+			continue
+		}
+
+		if op.Op != "insert" && ids[i].IsZero() {
+			item.Status = "invalid"
+			item.Error = "Invalid id"
+		} else if write, status, err := r.writeModel(ctx, op, ids[i], existing, now); err != nil {
+			item.Status = "invalid"
+			if status != "" {
+				item.Status = status
+			}
+			item.Error = err.Error()
+
+			var errs validation.Errors
+			if errors.As(err, &errs) {
+				item.Errors = errs
+			}
+		} else {
+			item.Status = status
+			if write != nil {
+				writes = append(writes, write)
+				writeIndex = append(writeIndex, i)
+			}
+		}
+
+		if item.Error != "" && ordered {
+			stopped = true
+		}
+	}
+
+	if len(writes) > 0 {
+		touched := []primitive.ObjectID{}
+		for _, i := range writeIndex {
+			if body.Operations[i].Op != "insert" {
+				touched = append(touched, ids[i])
+			}
+		}
+		before := r.audit.before(ctx, touched...)
+
+		result, err := r.collection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(ordered))
+
+		var bwe mongo.BulkWriteException
+		if err != nil && !errors.As(err, &bwe) {
+			return problem.Mongo(c, err, "Failed to write operations")
+		}
+
+		failedAt := len(writes)
+		for _, we := range bwe.WriteErrors {
+			item := &res.Results[writeIndex[we.Index]]
+			item.Status = "failed"
+			item.Error = we.Message
+			if we.Index < failedAt {
+				failedAt = we.Index
+			}
+		}
+
+		// an ordered bulk write does not run anything after the first error
+		if ordered {
+			for k := failedAt + 1; k < len(writes); k++ {
+				res.Results[writeIndex[k]].Status = "skipped"
+				res.Results[writeIndex[k]].Error = ""
+			}
+		}
+
+		if result != nil {
+			for k, id := range result.UpsertedIDs {
+				res.Results[writeIndex[k]].Status = "upserted"
+				if oid, ok := id.(primitive.ObjectID); ok {
+					res.Results[writeIndex[k]].ID = oid.Hex()
+				}
+			}
+		}
+
+		r.recordBulk(ctx, c, res.Results, writeIndex, ids, before)
+	}
+
+	for _, item := range res.Results {
+		switch item.Status {
+		case "inserted", "updated", "upserted", "deleted", "unchanged":
+			res.Succeeded++
+		default:
+			res.Failed++
+		}
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (h *Handler) BulkProducts(c echo.Context) error {
+	return bulkWrite(c, h.productBulk)
+}
+
+func (h *Handler) BulkExports(c echo.Context) error {
+	return bulkWrite(c, h.exportBulk)
+}
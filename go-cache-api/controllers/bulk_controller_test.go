@@ -0,0 +1,98 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"go-cache-api/models"
+	"go-cache-api/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBulkWriteModel(t *testing.T) {
+	ctx := context.Background()
+	h := NewRepositoryHandler(repository.NewMemoryProducts(), repository.NewMemoryExports())
+
+	rice := models.Product{ID: primitive.NewObjectID(), ProductName: "Rice", Category: "Food", BusinessSize: "Small"}
+	tea := models.Product{ID: primitive.NewObjectID(), ProductName: "Tea", Category: "Drink", BusinessSize: "Micro"}
+	if err := h.Products.Insert(ctx, rice, tea); err != nil {
+		t.Fatal(err)
+	}
+
+	id := primitive.NewObjectID()
+	existing := map[primitive.ObjectID]interface{}{
+		id: &models.ExportData{ID: id, ProductId: &rice.ID, ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Japan", Month: 1, Year: 2024},
+	}
+
+	tests := []struct {
+		name     string
+		op       models.BulkOperation
+		status   string
+		set      bson.M
+		hasError bool
+	}{
+		{
+			name:   "product fields follow productId",
+			op:     models.BulkOperation{Op: "update", Document: json.RawMessage(`{"productId":"` + tea.ID.Hex() + `"}`)},
+			status: "updated",
+			set:    bson.M{"productId": tea.ID, "productName": "Tea", "category": "Drink", "businessSize": "Micro"},
+		},
+		{
+			name:   "own field",
+			op:     models.BulkOperation{Op: "update", Document: json.RawMessage(`{"country":"Laos"}`)},
+			status: "updated",
+			set:    bson.M{"country": "Laos"},
+		},
+		{
+			name:   "product fields stay the ones of the product",
+			op:     models.BulkOperation{Op: "update", Document: json.RawMessage(`{"productName":"Corn"}`)},
+			status: "unchanged",
+		},
+		{
+			name:     "unknown product",
+			op:       models.BulkOperation{Op: "update", Document: json.RawMessage(`{"productId":"` + primitive.NewObjectID().Hex() + `"}`)},
+			hasError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := time.Now()
+			write, status, err := h.exportBulk.writeModel(ctx, tt.op, id, existing, now)
+			if tt.hasError {
+				if err == nil {
+					t.Fatalf("writeModel should fail, got %s", status)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != tt.status {
+				t.Fatalf("status = %s, want %s", status, tt.status)
+			}
+			if tt.set == nil {
+				return
+			}
+
+			set := write.(*mongo.UpdateOneModel).Update.(bson.M)["$set"].(bson.M)
+			if set["updatedAt"] != now {
+				t.Errorf("updatedAt = %v, want %v", set["updatedAt"], now)
+			}
+			delete(set, "updatedAt")
+			if len(set) != len(tt.set) {
+				t.Fatalf("$set = %v, want %v", set, tt.set)
+			}
+			for key, want := range tt.set {
+				if set[key] != want {
+					t.Errorf("$set.%s = %v, want %v", key, set[key], want)
+				}
+			}
+		})
+	}
+}
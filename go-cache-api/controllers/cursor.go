@@ -0,0 +1,241 @@
+package controllers
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"go-cache-api/repository"
+	"go-cache-api/response"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// keysetCursor is the decoded form of the opaque ?cursor= token. It holds the
+// sort it was issued for and the sort values of the last item already returned
+type keysetCursor struct {
+	Sort   string             `bson:"s"`
+	Values bson.A             `bson:"v"`
+	ID     primitive.ObjectID `bson:"id"`
+}
+
+var errInvalidCursor = errors.New("Invalid cursor!")
+
+// encodeCursor serialises the cursor as bson so the sort values keep their
+// types (dates, numbers, ids) when the cursor comes back
+func encodeCursor(cur keysetCursor) (string, error) {
+	b, err := bson.Marshal(cur)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(token string) (*keysetCursor, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	var cur keysetCursor
+	if err := bson.Unmarshal(b, &cur); err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &cur, nil
+}
+
+// keysetSort appends _id to sorts as a tiebreaker so every document has a
+// unique position in the result
+func keysetSort(sorts bson.D) bson.D {
+	direction := 1
+	for _, s := range sorts {
+		if s.Key == "_id" {
+			return sorts
+		}
+		direction = s.Value.(int)
+	}
+
+	keyset := append(bson.D{}, sorts...)
+	return append(keyset, bson.E{Key: "_id", Value: direction})
+}
+
+// sortSignature identifies a sort, a cursor is only valid for the sort it was issued for
+func sortSignature(sorts bson.D) string {
+	keys := []string{}
+	for _, s := range sorts {
+		keys = append(keys, s.Key+":"+strconv.Itoa(s.Value.(int)))
+	}
+	return strings.Join(keys, ",")
+}
+
+// keysetFilter matches the documents positioned after cur in sorts
+func keysetFilter(sorts bson.D, cur *keysetCursor) (bson.M, error) {
+	if cur.Sort != sortSignature(sorts) || len(cur.Values) != len(sorts)-1 {
+		return nil, errors.New("cursor does not match the sortby parameter")
+	}
+
+	values := append(append(bson.A{}, cur.Values...), cur.ID)
+
+	or := []bson.M{}
+	for i, s := range sorts {
+		cond := bson.M{}
+		for j := 0; j < i; j++ {
+			cond[sorts[j].Key] = values[j]
+		}
+
+		if !keysetBound(cond, s.Key, s.Value.(int), values[i]) {
+			continue
+		}
+
+		or = append(or, cond)
+	}
+
+	return bson.M{"$or": or}, nil
+}
+
+// keysetBound adds to cond the documents whose key comes after value in
+// direction. Null and missing sort before every other value in mongo, they
+// come first ascending and last descending, and a comparison with null
+// matches nothing. It reports false when nothing comes after value
+func keysetBound(cond bson.M, key string, direction int, value interface{}) bool {
+	switch {
+	case direction > 0 && value == nil:
+		cond[key] = bson.M{"$ne": nil}
+	case direction > 0:
+		cond[key] = bson.M{"$gt": value}
+	case value == nil:
+		return false
+	default:
+		cond["$or"] = []bson.M{{key: bson.M{"$lt": value}}, {key: nil}}
+	}
+	return true
+}
+
+// checkCursor reports whether the cursor of p, if any, was issued for sorts
+func checkCursor(p pagination, sorts bson.D) error {
+	if p.Cursor == nil {
+		return nil
+	}
+	_, err := keysetFilter(keysetSort(sorts), p.Cursor)
+	return err
+}
+
+// cursorAfter builds the cursor pointing right after item
+func cursorAfter(sorts bson.D, item interface{}) (string, error) {
+	raw, err := bson.Marshal(item)
+	if err != nil {
+		return "", err
+	}
+
+	cur := keysetCursor{Sort: sortSignature(sorts)}
+	for _, s := range sorts {
+		value, err := bson.Raw(raw).LookupErr(strings.Split(s.Key, ".")...)
+		if err != nil {
+			value = bson.RawValue{Type: bson.TypeNull}
+		}
+
+		if s.Key == "_id" {
+			cur.ID, _ = value.ObjectIDOK()
+			continue
+		}
+
+		var v interface{}
+		if value.Type != bson.TypeNull {
+			if err := value.Unmarshal(&v); err != nil {
+				return "", err
+			}
+		}
+		cur.Values = append(cur.Values, v)
+	}
+
+	return encodeCursor(cur)
+}
+
+// findCursorPage runs a keyset paginated find. It returns the number of
+// documents matched by filter and the cursor of the next page, empty on the last page
+func findCursorPage(ctx context.Context, documents pageReader, filter bson.M, sorts bson.D, projection bson.M, p pagination, results interface{}) (int64, string, error) {
+	sorts = keysetSort(sorts)
+
+	query := repository.Query{Filter: filter, Sort: sorts, Projection: projection, Limit: int64(p.Limit + 1)}
+	if p.Cursor != nil {
+		keyset, err := keysetFilter(sorts, p.Cursor)
+		if err != nil {
+			return 0, "", err
+		}
+		query.Filter = bson.M{"$and": []bson.M{filter, keyset}}
+	} else {
+		query.Skip = int64(p.Offset)
+	}
+
+	if err := documents.Find(ctx, query, results); err != nil {
+		return 0, "", err
+	}
+
+	var err error
+	var next string
+	items := reflect.ValueOf(results).Elem()
+	if items.Len() > p.Limit {
+		items.Set(items.Slice(0, p.Limit))
+
+		next, err = cursorAfter(sorts, items.Index(p.Limit-1).Interface())
+		if err != nil {
+			return 0, "", err
+		}
+	}
+
+	total, err := documents.Count(ctx, filter)
+	if err != nil {
+		return 0, "", err
+	}
+
+	return total, next, nil
+}
+
+// newCursorPage wraps items in the page envelope. In cursor mode the page has
+// no offset so only the first and next links are available
+func newCursorPage(c echo.Context, items interface{}, total int64, p pagination, next string) *response.Page {
+	if p.Cursor == nil {
+		page := newPage(c, items, total, p)
+		page.NextCursor = next
+		return page
+	}
+
+	page := &response.Page{
+		Items:      items,
+		Total:      total,
+		Limit:      p.Limit,
+		NextCursor: next,
+	}
+
+	page.Links.Self = cursorLink(c, p, c.QueryParam("cursor"))
+	page.Links.First = cursorLink(c, p, "")
+	if next != "" {
+		page.Links.Next = cursorLink(c, p, next)
+	}
+
+	return page
+}
+
+// cursorLink returns the current request URL moved to cursor
+func cursorLink(c echo.Context, p pagination, cursor string) string {
+	q := url.Values{}
+	for k, v := range c.QueryParams() {
+		q[k] = append([]string(nil), v...)
+	}
+
+	q.Set("limit", strconv.Itoa(p.Limit))
+	q.Del("offset")
+	q.Del("page")
+	q.Del("cursor")
+	if cursor != "" {
+		q.Set("cursor", cursor)
+	}
+
+	return c.Request().URL.Path + "?" + q.Encode()
+}
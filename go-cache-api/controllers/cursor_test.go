@@ -0,0 +1,128 @@
+package controllers
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestCursorRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	created := time.Date(2024, 3, 1, 10, 0, 0, 0, time.UTC)
+	sorts := keysetSort(bson.D{{Key: "productName", Value: 1}, {Key: "createdAt", Value: -1}})
+
+	item := bson.M{"_id": id, "productName": "Rice", "createdAt": created, "valueTHB": 10}
+	token, err := cursorAfter(sorts, item)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cur, err := decodeCursor(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cur.ID != id || cur.Sort != "productName:1,createdAt:-1,_id:-1" {
+		t.Fatalf("cursor = %+v", cur)
+	}
+
+	want := bson.A{"Rice", primitive.NewDateTimeFromTime(created)}
+	if !reflect.DeepEqual(cur.Values, want) {
+		t.Errorf("values = %#v, want %#v, the types of the sort values are kept", cur.Values, want)
+	}
+}
+
+func TestCursorAfterMissingField(t *testing.T) {
+	id := primitive.NewObjectID()
+	sorts := keysetSort(bson.D{{Key: "category", Value: 1}})
+
+	token, err := cursorAfter(sorts, bson.M{"_id": id})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cur, err := decodeCursor(token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cur.Values) != 1 || cur.Values[0] != nil {
+		t.Errorf("values = %#v, want a null for the missing field", cur.Values)
+	}
+}
+
+func TestDecodeCursorInvalid(t *testing.T) {
+	for _, token := range []string{"not base64!", "aGVsbG8"} {
+		if _, err := decodeCursor(token); err != errInvalidCursor {
+			t.Errorf("decodeCursor(%q) error = %v, want errInvalidCursor", token, err)
+		}
+	}
+}
+
+func TestKeysetSort(t *testing.T) {
+	tests := []struct {
+		name  string
+		sorts bson.D
+		want  bson.D
+	}{
+		{"empty", bson.D{}, bson.D{{Key: "_id", Value: 1}}},
+		{"follows the last direction", bson.D{{Key: "year", Value: 1}, {Key: "month", Value: -1}}, bson.D{{Key: "year", Value: 1}, {Key: "month", Value: -1}, {Key: "_id", Value: -1}}},
+		{"already unique", bson.D{{Key: "_id", Value: -1}, {Key: "year", Value: 1}}, bson.D{{Key: "_id", Value: -1}, {Key: "year", Value: 1}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := keysetSort(tt.sorts); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("keysetSort = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestKeysetBound(t *testing.T) {
+	tests := []struct {
+		name      string
+		direction int
+		value     interface{}
+		want      bson.M
+		ok        bool
+	}{
+		{"ascending", 1, "Rice", bson.M{"name": bson.M{"$gt": "Rice"}}, true},
+		{"ascending after null", 1, nil, bson.M{"name": bson.M{"$ne": nil}}, true},
+		{"descending", -1, "Rice", bson.M{"$or": []bson.M{{"name": bson.M{"$lt": "Rice"}}, {"name": nil}}}, true},
+		{"descending after null", -1, nil, bson.M{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cond := bson.M{}
+			ok := keysetBound(cond, "name", tt.direction, tt.value)
+			if ok != tt.ok || !reflect.DeepEqual(cond, tt.want) {
+				t.Errorf("keysetBound = %v, %v, want %v, %v", cond, ok, tt.want, tt.ok)
+			}
+		})
+	}
+}
+
+func TestKeysetFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+	sorts := keysetSort(bson.D{{Key: "name", Value: 1}})
+	cur := &keysetCursor{Sort: sortSignature(sorts), Values: bson.A{"Rice"}, ID: id}
+
+	got, err := keysetFilter(sorts, cur)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := bson.M{"$or": []bson.M{
+		{"name": bson.M{"$gt": "Rice"}},
+		{"name": "Rice", "_id": bson.M{"$gt": id}},
+	}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("keysetFilter = %v, want %v", got, want)
+	}
+
+	other := keysetSort(bson.D{{Key: "name", Value: -1}})
+	if _, err := keysetFilter(other, cur); err == nil {
+		t.Error("a cursor is accepted for another sort")
+	}
+}
@@ -0,0 +1,205 @@
+package controllers
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"reflect"
+	"strings"
+	"time"
+
+	"go-cache-api/download"
+	"go-cache-api/models"
+	"go-cache-api/problem"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// downloadTimeout bounds a download, it outlasts the timeout of a page
+	downloadTimeout = 5 * time.Minute
+	// downloadFlushRows is how many rows are sent at once
+	downloadFlushRows = 500
+)
+
+// downloadFormat is the file format the client asked for with ?format= or
+// Accept, nil when the response is JSON
+func downloadFormat(c echo.Context) (*download.Format, error) {
+	return download.Negotiate(c.QueryParam("format"), c.Request().Header.Get(echo.HeaderAccept))
+}
+
+// downloadColumns returns the json names of the columns of a download of
+// model and the bson names to read them from, in the order of the model.
+// Only the selected fields are included when fields is set
+func downloadColumns(model interface{}, fields *fieldSet) ([]string, []string) {
+	columns, keys := []string{}, []string{}
+
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		bsonName := strings.Split(f.Tag.Get("bson"), ",")[0]
+		if jsonName == "" || jsonName == "-" || bsonName == "" || bsonName == "-" {
+			continue
+		}
+		if jsonName == "deletedAt" || jsonName == "score" || jsonName == importField {
+			continue
+		}
+		if fields != nil && !IsStringInSlice(jsonName, fields.Fields) {
+			continue
+		}
+
+		columns = append(columns, jsonName)
+		keys = append(keys, bsonName)
+	}
+
+	return columns, keys
+}
+
+// lookupPath reads a dotted key of doc
+func lookupPath(doc bson.M, key string) interface{} {
+	var v interface{} = doc
+	for _, part := range strings.Split(key, ".") {
+		m, ok := v.(bson.M)
+		if !ok {
+			return nil
+		}
+		v = m[part]
+	}
+	return v
+}
+
+// streamDownload sends the rows returned by next as a file until next has no
+// more. Rows are flushed as they come, once the first one is sent an error
+// can only cut the file short so it is logged
+func streamDownload(c echo.Context, f *download.Format, name string, header []string, next func() ([]interface{}, bool, error)) error {
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, f.ContentType)
+	res.Header().Set(echo.HeaderContentDisposition, `attachment; filename="`+f.Filename(name)+`"`)
+	res.Header().Set("Cache-Control", "no-store")
+	res.WriteHeader(http.StatusOK)
+
+	w, err := download.NewWriter(f, res, name)
+	if err == nil {
+		err = writeRows(c, w, header, next)
+	}
+	if err != nil {
+		log.Printf("request %s: download %s: %v", res.Header().Get(echo.HeaderXRequestID), f.Filename(name), err)
+	}
+
+	return nil
+}
+
+func writeRows(c echo.Context, w download.Writer, header []string, next func() ([]interface{}, bool, error)) error {
+	flusher, _ := c.Response().Writer.(http.Flusher)
+
+	row := make([]interface{}, len(header))
+	for i, h := range header {
+		row[i] = h
+	}
+
+	for rows := 0; ; rows++ {
+		if err := w.Write(row); err != nil {
+			return err
+		}
+
+		if rows%downloadFlushRows == 0 {
+			if err := w.Flush(); err != nil {
+				return err
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		}
+
+		var more bool
+		var err error
+		row, more, err = next()
+		if err != nil {
+			return err
+		}
+		if !more {
+			break
+		}
+	}
+
+	return w.Close()
+}
+
+// downloadExports streams every export matched by filter, pagination does not
+// apply to a file
+func (h *Handler) downloadExports(c echo.Context, f *download.Format, filter bson.M, sorts bson.D, fields *fieldSet, q *searchQuery) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), downloadTimeout)
+	defer cancel()
+
+	columns, keys := downloadColumns(models.ExportData{}, fields)
+
+	opts := options.Find().SetSort(q.sort(keysetSort(sorts)))
+	cur, err := h.exportCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find data in exports")
+	}
+	defer cur.Close(ctx)
+
+	return streamDownload(c, f, "exports", columns, func() ([]interface{}, bool, error) {
+		if !cur.Next(ctx) {
+			return nil, false, cur.Err()
+		}
+
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return nil, false, err
+		}
+
+		row := make([]interface{}, len(keys))
+		for i, k := range keys {
+			row[i] = doc[k]
+		}
+		return row, true, nil
+	})
+}
+
+// downloadExploration streams the results of an explore pipeline, one column
+// per column and aggregate of the request
+func (h *Handler) downloadExploration(c echo.Context, f *download.Format, body *models.ExploreRequest, pipeline []bson.M) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), downloadTimeout)
+	defer cancel()
+
+	columns := []string{}
+	for _, col := range body.Columns {
+		alias := col.Alias
+		if alias == "" {
+			alias = col.Name
+		}
+		columns = append(columns, alias)
+	}
+	for _, ag := range body.Aggregate {
+		columns = append(columns, ag.Alias)
+	}
+
+	cur, err := h.exportCollection.Aggregate(ctx, pipeline)
+	if err != nil {
+		return problem.Write(c, http.StatusUnprocessableEntity, "Could not explore service usages, "+err.Error())
+	}
+	defer cur.Close(ctx)
+
+	return streamDownload(c, f, "exploration", columns, func() ([]interface{}, bool, error) {
+		if !cur.Next(ctx) {
+			return nil, false, cur.Err()
+		}
+
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return nil, false, err
+		}
+
+		row := make([]interface{}, len(columns))
+		for i, col := range columns {
+			row[i] = lookupPath(doc, col)
+		}
+		return row, true, nil
+	})
+}
@@ -1,4 +1,5 @@
 package controllers
+
 import (
 	"context"
 	"crypto/md5"
@@ -8,27 +9,24 @@ import (
 	"log"
 	"sync"
 
-	"go-cache-api/configs"
 	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/response"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/labstack/echo"
-	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	redisClient = configs.ConnectRedis()
-	cacheMutex  sync.Mutex
+	cacheMutex sync.Mutex
 )
 
 const (
 	maxAgeDefault = 300
-
 )
 
 func getMaxAgeTime(c echo.Context) int {
@@ -66,26 +64,21 @@ func generateETag(data string) string {
 	return eTag
 }
 
-func parseSortFields(sortFields []string) bson.D {
-	sorts := bson.D{}
-	for _, sort := range sortFields {
-		for _, value := range strings.Split(sort, ",") {
-			sortOrder := 1
-			if strings.HasPrefix(value, "-") {
-				sortOrder = -1
-				value = strings.TrimPrefix(value, "-")
-			}
-			sorts = append(sorts, bson.E{Key: value, Value: sortOrder})
-		}
+func generateCacheKey(c echo.Context, prefix string) string {
+	query := url.Values{}
+	for k, v := range c.QueryParams() {
+		query[k] = v
 	}
-	return sorts
-}
 
-func generateCacheKey(c echo.Context) string {
-	uri := c.Request().Method + ":" + c.QueryParams().Encode()
+	// fields=a,b and fields=b,a select the same response
+	if fields := normalizeFields(query["fields"]); len(fields) > 0 {
+		query.Set("fields", strings.Join(fields, ","))
+	}
+
+	uri := c.Request().Method + ":" + query.Encode()
 	maxageString := fmt.Sprintf(":max-age=%s", strconv.Itoa(getMaxAgeTime(c)))
 
-	return "exports:" + uri + maxageString
+	return prefix + ":" + uri + maxageString
 }
 
 // Etag/if-none-match
@@ -137,226 +130,157 @@ func handleNoCache(c echo.Context, etag string, lastModified time.Time) error {
 	return nil
 }
 
-func handleCacheOnlyRequest(c echo.Context, ctx context.Context, cacheKey string) error {
-	cache, found := redisClient.Get(ctx, cacheKey).Result()
-
-	if found != nil {
-		c.Response().Header().Set("Cache-Control", "no-store")
-		c.Response().Header().Set("Connection", "close")
-		c.Response().Header().Set("X-Cache-Status", "Miss")
-		return c.JSON(http.StatusGatewayTimeout, echo.Map{"message": "The resource is not in the cache, and the server could not retrieve it"})
-	}
+// cacheLoader fetches a fresh response from mongo when the cache can not be used
+type cacheLoader func() (interface{}, error)
 
-	var exports []models.Product
-	if err := json.Unmarshal([]byte(cache), &exports); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Error unmarshal JSON"})
-	}
+// cachedBody is the part of a cached response needed to rebuild its headers
+type cachedBody struct {
+	Items []struct {
+		UpdatedAt *time.Time `json:"updatedAt"`
+	} `json:"items"`
+	Links *response.PageLinks `json:"links"`
+}
 
-	//cache-control: max-age
-	maxAge := getMaxAgeTime(c)
-	cacheAgeTime, err := redisClient.TTL(ctx, cacheKey).Result()
-	if err != nil {
-		log.Println(err)
+// inspectCachedBody returns the last modified time of the items in a cached
+// response and sets its Link header when the response is a page
+func inspectCachedBody(c echo.Context, data []byte) time.Time {
+	var body cachedBody
+	if err := json.Unmarshal(data, &body); err != nil {
+		return time.Time{}
 	}
 
-	//ttl of cache in redis
-	age := int(maxAge) - int(cacheAgeTime.Seconds())
-
-	//cache time when will expire
-	expire := time.Now().Add(time.Duration(maxAge) * time.Second)
-
-	//last modified of resouce
 	var lastModified time.Time
-	for _, export := range exports {
-		if export.UpdatedAt.After(lastModified) {
-			lastModified = *export.UpdatedAt
+	for _, item := range body.Items {
+		if item.UpdatedAt != nil && item.UpdatedAt.After(lastModified) {
+			lastModified = *item.UpdatedAt
 		}
 	}
 
-	// etag
-	etag := generateETag(cache)
-
-	//if none match
-	if err := handleIfNoneMatch(c, etag, age, lastModified, maxAge, expire); err != nil {
-		return err
+	if body.Links != nil {
+		setLinkHeader(c, *body.Links)
 	}
 
-	//if modified since
-	if err := handleIfModifiedSince(c, etag, age, lastModified, maxAge, expire); err != nil {
-		return err
-	}
-
-	setCacheHeaders(c, age, maxAge, etag, expire, lastModified)
-
-	return c.JSON(http.StatusOK, exports)
+	return lastModified
 }
 
-// cache hit
-func handleCacheHit(c echo.Context, ctx context.Context, cacheKey string, cachedData string, filter primitive.M , opts *options.FindOptions) error {
-	var exports []models.ExportData
-	if err := json.Unmarshal([]byte(cachedData), &exports); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Error unmarshal JSON"})
-	}
-
-	maxAge := getMaxAgeTime(c)
-	timeTolive, err := redisClient.TTL(ctx, cacheKey).Result()
-	if err != nil {
-		log.Println(err)
+// serveCached answers a GET request from redis, honoring the Cache-Control
+// directives of the client, and falls back to load on cache miss
+func (h *Handler) serveCached(c echo.Context, ctx context.Context, cacheKey string, load cacheLoader) error {
+	if c.Request().Header.Get("Cache-Control") == "only-if-cached" {
+		return h.handleCacheOnlyRequest(c, ctx, cacheKey)
 	}
 
-	age := int(maxAge) - int(timeTolive.Seconds())
-	expire := time.Now().Add(time.Duration(maxAge) * time.Second)
+	//find cache in redis
+	cachedData, found := h.Redis.Get(ctx, cacheKey).Result()
 
-	var lastModified time.Time
-	for _, product := range exports {
-		if product.UpdatedAt.After(lastModified) {
-			lastModified = *product.UpdatedAt
-		}
+	//cache hit
+	if found == nil {
+		return h.handleCacheHit(c, ctx, cacheKey, cachedData, load)
 	}
 
-	etag := generateETag(cachedData)
-
-	//no cached
-	if c.Request().Header.Get("Cache-Control") == "no-cache" {
-		results, err := productCollection.Find(ctx, filter, opts)
-		if err != nil {
-			return c.JSON(http.StatusNotFound, echo.Map{"message": "Can not find product in collection"})
-		}
-
-		var products []models.Product
-		if err := results.All(ctx, &products); err != nil {
-			return c.JSON(http.StatusNotFound, echo.Map{"message": err})
-		}
-
-		maxAgeTime := getMaxAgeTime(c)
-
-		expiresTime := time.Now().Add(time.Duration(maxAgeTime) * time.Second)
-
-		var latestUpdateTime time.Time
-		for _, product := range products {
-			if product.UpdatedAt.After(latestUpdateTime) {
-				latestUpdateTime = *product.UpdatedAt
-			}
-		}
-
-		productMarshal, err := json.Marshal(products)
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": err})
-		}
-
-		err = redisClient.Set(ctx, cacheKey, productMarshal, time.Duration(maxAgeTime)*time.Second).Err()
-		if err != nil {
-			log.Println(err)
-		}
+	//cache miss
+	return h.handleCacheMiss(c, ctx, cacheKey, load)
+}
 
-		etag := generateETag(cachedData)
+func (h *Handler) handleCacheOnlyRequest(c echo.Context, ctx context.Context, cacheKey string) error {
+	cache, found := h.Redis.Get(ctx, cacheKey).Result()
 
-		c.Response().Header().Set("Cache-Control", "no-cache")
-		c.Response().Header().Set("Etag", etag)
-		c.Response().Header().Set("Last-Modified", latestUpdateTime.UTC().Format(http.TimeFormat))
-		c.Response().Header().Set("Expires", expiresTime.UTC().Format(http.TimeFormat))
+	if found != nil {
+		c.Response().Header().Set("Cache-Control", "no-store")
+		c.Response().Header().Set("Connection", "close")
 		c.Response().Header().Set("X-Cache-Status", "Miss")
-
-		return c.JSON(http.StatusOK, products)
+		return problem.Write(c, http.StatusGatewayTimeout, "The resource is not in the cache, and the server could not retrieve it")
 	}
 
-	//no-store directive
-	if c.Request().Header.Get("Cache-control") == "no-store" {
-		results, err := productCollection.Find(ctx, filter, opts)
-		if err != nil {
-			return c.JSON(http.StatusNotFound, echo.Map{"message": "Can not find product in collection"})
-		}
+	return h.serveFromCache(c, ctx, cacheKey, cache)
+}
 
-		var products []models.Product
-		if err := results.All(ctx, &products); err != nil {
-			return c.JSON(http.StatusNotFound, echo.Map{"message": err})
-		}
+// cache hit
+func (h *Handler) handleCacheHit(c echo.Context, ctx context.Context, cacheKey string, cachedData string, load cacheLoader) error {
+	cacheControl := c.Request().Header.Get("Cache-Control")
 
-		// maxAgeTime := getMaxAgeTime(c)
+	//no-cache and no-store directive, revalidate against the database
+	if cacheControl == "no-cache" || cacheControl == "no-store" {
+		return h.handleCacheMiss(c, ctx, cacheKey, load)
+	}
 
-		var latestUpdateTime time.Time
-		for _, product := range products {
-			if product.UpdatedAt.After(latestUpdateTime) {
-				latestUpdateTime = *product.UpdatedAt
-			}
-		}
+	return h.serveFromCache(c, ctx, cacheKey, cachedData)
+}
 
-		etag := generateETag(cachedData)
+// serveFromCache writes a cached response with its age and validators
+func (h *Handler) serveFromCache(c echo.Context, ctx context.Context, cacheKey string, cachedData string) error {
+	//cache-control: max-age
+	maxAge := getMaxAgeTime(c)
+	timeTolive, err := h.Redis.TTL(ctx, cacheKey).Result()
+	if err != nil {
+		log.Println(err)
+	}
 
-		c.Response().Header().Set("Cache-Control", "no-store")
-		c.Response().Header().Set("Etag", etag)
-		c.Response().Header().Set("Last-Modified", latestUpdateTime.UTC().Format(http.TimeFormat))
-		c.Response().Header().Set("X-Cache-Status", "Miss")
+	//ttl of cache in redis
+	age := int(maxAge) - int(timeTolive.Seconds())
 
-		return c.JSON(http.StatusOK, products)
+	//cache time when will expire
+	expire := time.Now().Add(time.Duration(maxAge) * time.Second)
 
-	}
+	//last modified of resouce
+	lastModified := inspectCachedBody(c, []byte(cachedData))
 
+	// etag
+	etag := generateETag(cachedData)
 
+	//if none match
 	if err := handleIfNoneMatch(c, etag, age, lastModified, maxAge, expire); err != nil {
 		return err
 	}
 
+	//if modified since
 	if err := handleIfModifiedSince(c, etag, age, lastModified, maxAge, expire); err != nil {
 		return err
 	}
 
 	setCacheHeaders(c, age, maxAge, etag, expire, lastModified)
 
-	return c.JSON(http.StatusOK, exports)
+	return c.JSONBlob(http.StatusOK, []byte(cachedData))
 }
 
 // cache miss
-func handleCacheMiss(c echo.Context, ctx context.Context, filter bson.M, opts *options.FindOptions, cacheKey string) error {
-	results, err := exportCollection.Find(ctx, filter, opts)
+func (h *Handler) handleCacheMiss(c echo.Context, ctx context.Context, cacheKey string, load cacheLoader) error {
+	result, err := load()
 	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"message": "Can not find product in collection"})
-	}
-	defer results.Close(ctx)
-
-	var exports []models.ExportData
-	if err := results.All(ctx, &exports); err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"message": err})
+		return problem.Mongo(c, err, "Can not find data")
 	}
 
-	exportsMarshal, err := json.Marshal(exports)
+	data, err := json.Marshal(result)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Error marshaling JSON"})
+		return problem.Write(c, http.StatusInternalServerError, "Error marshaling JSON")
 	}
 
 	maxAge := getMaxAgeTime(c)
 
-	etag := generateETag(string(exportsMarshal))
+	etag := generateETag(string(data))
 
 	expire := time.Now().Add(time.Duration(maxAge) * time.Second)
 
-	var lastModified time.Time
-	for _, export := range exports {
-		if export.UpdatedAt.After(lastModified) {
-			lastModified = *export.UpdatedAt
-		}
-	}
+	lastModified := inspectCachedBody(c, data)
 
 	cacheControl := c.Request().Header.Get("Cache-Control")
 
-	if cacheControl == "no-cache" {
-		if err := handleNoCache(c, etag, lastModified); err != nil {
-			return err
-		}
-		return c.JSON(http.StatusOK, exports)
-	}
-
 	if cacheControl == "no-store" {
 		c.Response().Header().Set("Cache-Control", "no-store")
 		c.Response().Header().Set("X-Cache-Status", "Miss")
-		return c.JSON(http.StatusOK, exports)
+		return c.JSONBlob(http.StatusOK, data)
 	}
 
-	if cacheControl != "no-store" {
-		err = redisClient.Set(ctx, cacheKey, exportsMarshal, time.Duration(maxAge)*time.Second).Err()
-		if err != nil {
-			log.Println(err)
+	err = h.Redis.Set(ctx, cacheKey, data, time.Duration(maxAge)*time.Second).Err()
+	if err != nil {
+		log.Println(err)
+	}
+
+	if cacheControl == "no-cache" {
+		if err := handleNoCache(c, etag, lastModified); err != nil {
+			return err
 		}
+		return c.JSONBlob(http.StatusOK, data)
 	}
 
 	c.Response().Header().Set("Cache-Control", fmt.Sprintf("public, max-age=%d", maxAge))
@@ -365,66 +289,82 @@ func handleCacheMiss(c echo.Context, ctx context.Context, filter bson.M, opts *o
 	c.Response().Header().Set("Last-Modified", lastModified.UTC().Format(http.TimeFormat))
 	c.Response().Header().Set("X-Cache-Status", "Miss")
 
-	return c.JSON(http.StatusOK, exports)
+	return c.JSONBlob(http.StatusOK, data)
 }
 
 // get exports
-func ExportsCache(c echo.Context) error {
-	var err error
+func (h *Handler) ExportsCache(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
-
-	limit := 10
-	if c.QueryParam("limit") != "" {
-		limit, err = strconv.Atoi(c.QueryParam("limit"))
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid type limit!"})
-		}
+	p, err := parsePagination(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	offset := 0
-	if c.QueryParam("offset") != "" {
-		offset, err = strconv.Atoi(c.QueryParam("offset"))
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid type offset!"})
-		}
+	sorts, err := parseSort(c, exportSort)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	sortFields := c.QueryParams()["sortby"]
-	sorts := parseSortFields(sortFields)
+	expand, err := h.parseExpand(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
 
 	// Construct filter
-	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
-	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
-
-	search := c.QueryParam("search")
-	if search != "" {
-		filter["$or"] = []bson.M{
-			{"productName": bson.M{"$regex": primitive.Regex{Pattern: search, Options: "i"}}},
-			{"category": bson.M{"$regex": primitive.Regex{Pattern: search, Options: "i"}}},
-		}
+	filter := notDeleted()
+
+	q, err := parseSearch(c, p)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
+	q.apply(filter)
 
-	if len(sorts) > 0 {
-		opts.SetSort(sorts)
+	if err := applyQueryFilter(c, filter, exportFilterFields); err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	cacheKey := generateCacheKey(c)
-	if c.Request().Header.Get("Cache-Control") == "only-if-cached" {
-		return handleCacheOnlyRequest(c, ctx, cacheKey)
+	if err := checkCursor(p, sorts); err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	//find cache in redis
-	cachedData, found := redisClient.Get(ctx, cacheKey).Result()
+	fields, err := parseFields(c, models.ExportData{})
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+	fields.withSort(sorts)
 
-	//cache hit
-	if found == nil {
-		return handleCacheHit(c, ctx, cacheKey, cachedData, filter, opts )
+	format, err := downloadFormat(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+	if format != nil {
+		if expand {
+			return problem.Write(c, http.StatusBadRequest, "expand is only available in JSON")
+		}
+		return h.downloadExports(c, format, filter, sorts, fields, q)
 	}
 
-	//cache miss
-	return handleCacheMiss(c, ctx, filter, opts, cacheKey)
-}
\ No newline at end of file
+	cacheMutex.Lock()
+	defer cacheMutex.Unlock()
+
+	// the cursor and the fields are part of the query string so each of them has its own cache entry
+	cacheKey := generateCacheKey(c, "exports")
+
+	return h.serveCached(c, ctx, cacheKey, func() (interface{}, error) {
+		exports := fields.results(&[]models.ExportData{})
+		total, next, err := findListPage(ctx, h.Exports, filter, sorts, fields.projection(), q, p, exports)
+		if err != nil {
+			return nil, err
+		}
+
+		items := fields.items(exports)
+		if expand {
+			if items, err = h.expandProducts(ctx, items); err != nil {
+				return nil, err
+			}
+		}
+		return newCursorPage(c, items, total, p, next), nil
+	})
+}
@@ -2,177 +2,209 @@ package controllers
 
 import (
 	"context"
-	"go-cache-api/configs"
+	"errors"
 	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/validation"
 	"net/http"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/labstack/echo"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	exportCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "exports")
-)
-
-func CreateExports(c echo.Context) error {
+func (h *Handler) CreateExports(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var exports []models.ExportData
 	if err := c.Bind(&exports); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	for _, export := range exports {
-		if export.ProductName == "" {
-			return c.JSON(http.StatusBadRequest, "Product name id is required")
-		}
-		if export.Category == "" {
-			return c.JSON(http.StatusBadRequest, "Product category id is required")
-		}
-		if export.ValueTHB == 0 {
-			return c.JSON(http.StatusBadRequest, "Value in baht id is required")
-		}
-		if export.ValueUSD == 0 {
-			return c.JSON(http.StatusBadRequest, "Value in dollars id is required")
-		}
-		if export.BusinessSize == "" {
-			return c.JSON(http.StatusBadRequest, "Business size id is required")
-		}
-		if export.Country == "" {
-			return c.JSON(http.StatusBadRequest, "Country is required")
-		}
-		if export.Month < 1 {
-			return c.JSON(http.StatusBadRequest, "Month is required")
-		}
-		if export.Year < 1 {
-			return c.JSON(http.StatusBadRequest, "Year is required")
-		}
+	errs, err := h.linkProducts(ctx, exports)
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find the products of exports")
+	}
+	if errs != nil {
+		return problem.Validation(c, errs)
+	}
+
+	if errs := validation.Slice(exports); errs != nil {
+		return problem.Validation(c, errs)
 	}
 
 	timeNow := time.Now()
 
-	var newExports []interface{}
+	var newExports []models.ExportData
+	var ids []primitive.ObjectID
 	for _, export := range exports {
 		newExport := models.ExportData{
-			ID:        primitive.NewObjectID(),
-			ProductName: export.ProductName,
-			Category: export.Category,
-			ValueTHB: export.ValueTHB,
-			ValueUSD:  export.ValueUSD,
+			ID:           primitive.NewObjectID(),
+			ProductId:    export.ProductId,
+			ProductName:  export.ProductName,
+			Category:     export.Category,
+			ValueTHB:     export.ValueTHB,
+			ValueUSD:     export.ValueUSD,
 			BusinessSize: export.BusinessSize,
-			Country:   export.Country,
-			Month:     export.Month,
-			Year:      export.Year,
-			CreatedAt: &timeNow,
-			UpdatedAt: &timeNow,
+			Country:      export.Country,
+			Month:        export.Month,
+			Year:         export.Year,
+			CreatedAt:    &timeNow,
+			UpdatedAt:    &timeNow,
 		}
 
 		newExports = append(newExports, newExport)
+		ids = append(ids, newExport.ID)
 	}
 
-	_, err := exportCollection.InsertMany(ctx, newExports)
+	err = h.Exports.Insert(ctx, newExports...)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"error": "Failed to create export"})
+		return problem.Mongo(c, err, "Failed to create export")
 	}
+
+	h.exportAudit.record(ctx, c, "create", nil, ids...)
 	return c.JSON(http.StatusCreated, echo.Map{"exports": newExports})
 }
 
-func GetExports(c echo.Context) error {
-	var err error
+func (h *Handler) GetExports(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
-	cacheMutex.Lock()
-	defer cacheMutex.Unlock()
+	// a download streams for minutes, it does not hold the lock every list waits on
+	if format, _ := downloadFormat(c); format == nil {
+		cacheMutex.Lock()
+		defer cacheMutex.Unlock()
+	}
 
-	//check limit queryparam
-	limit := 10
-	if c.QueryParam("limit") != "" {
-		limit, err = strconv.Atoi(c.QueryParam("limit"))
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid type limit!"})
-		}
+	return h.listExports(c, ctx, notDeleted())
+}
+
+// listExports returns a keyset paginated page of the exports matching filter
+// and the query string, with their product when ?expand=product
+func (h *Handler) listExports(c echo.Context, ctx context.Context, filter bson.M) error {
+	p, err := parsePagination(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	offset := 0
-	if c.QueryParam("offset") != "" {
-		offset, err = strconv.Atoi(c.QueryParam("offset"))
-		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid type offset!"})
-		}
+	sorts, err := parseSort(c, exportSort)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	// check if sorts queryparam
-	// แก้ไข การแบ่ง การ sort
-	sortFields := c.QueryParams()["sortby"]
-	sorts := bson.D{}
-	if len(sortFields) > 0 {
-		for _, sort := range sortFields {
-			for _, value := range strings.Split(sort, ",") {
-				sortOrder := 1
-				if strings.HasPrefix(value, "-") {
-					sortOrder = -1
-					value = strings.Trim(value, "-")
-
-				}
-				sorts = append(sorts, bson.E{Key: value, Value: sortOrder})
-			}
-		}
+	expand, err := h.parseExpand(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
-	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	q, err := parseSearch(c, p)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+	q.apply(filter)
 
-	search := c.QueryParam("search")
-	if search != "" {
-		filter["$or"] = []bson.M{
-			{"productName": bson.M{"$regex": primitive.Regex{Pattern: search, Options: "i"}}},
-			{"category": bson.M{"$regex": primitive.Regex{Pattern: search, Options: "i"}}},
-			{"country": bson.M{"$regex": primitive.Regex{Pattern: search, Options: "i"}}},
-		}
+	if err := applyQueryFilter(c, filter, exportFilterFields); err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	if len(sorts) > 0 {
-		opts.SetSort(sorts)
+	if err := checkCursor(p, sorts); err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
-	results, err := exportCollection.Find(ctx, filter, opts)
+	fields, err := parseFields(c, models.ExportData{})
 	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"message": "Can not find data in exports"})
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
+	fields.withSort(sorts)
 
-	var exports []models.ExportData
-	if err := results.All(ctx, &exports); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": err})
+	format, err := downloadFormat(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+	if format != nil {
+		if expand {
+			return problem.Write(c, http.StatusBadRequest, "expand is only available in JSON")
+		}
+		return h.downloadExports(c, format, filter, sorts, fields, q)
+	}
+
+	exports := fields.results(&[]models.ExportData{})
+	total, next, err := findListPage(ctx, h.Exports, filter, sorts, fields.projection(), q, p, exports)
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find data in exports")
 	}
 
-	return c.JSON(http.StatusOK, exports)
+	items := fields.items(exports)
+	if expand {
+		if items, err = h.expandProducts(ctx, items); err != nil {
+			return problem.Mongo(c, err, "Can not find the products of exports")
+		}
+	}
+
+	page := newCursorPage(c, items, total, p, next)
+	setLinkHeader(c, page.Links)
+
+	return c.JSON(http.StatusOK, page)
 }
 
-func GetExport(c echo.Context) error {
+func (h *Handler) GetExport(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	exportId, err := primitive.ObjectIDFromHex(c.Param("exportId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid product id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid product id")
+	}
+
+	fields, err := parseFields(c, models.ExportData{})
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	expand, err := h.parseExpand(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	filter := notDeleted()
+	filter["_id"] = exportId
+
+	if fields != nil {
+		var doc bson.M
+		err = h.Exports.Get(ctx, filter, fields.Projection, &doc)
+		if err != nil {
+			return problem.Mongo(c, err, "Export not found")
+		}
+		renameID(doc)
+
+		if expand {
+			if _, err := h.expandProducts(ctx, []bson.M{doc}); err != nil {
+				return problem.Mongo(c, err, "Can not find the product of export")
+			}
+		}
+		return c.JSON(http.StatusOK, doc)
 	}
 
 	var export models.ExportData
-	err = exportCollection.FindOne(ctx, bson.M{"_id": exportId, "deleted_at": bson.M{"$exists": false}}).Decode(&export)
+	err = h.Exports.Get(ctx, filter, nil, &export)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, echo.Map{"message": "Export not found"})
+		return problem.Mongo(c, err, "Export not found")
+	}
+
+	if expand {
+		expanded, err := h.expandProducts(ctx, []models.ExportData{export})
+		if err != nil {
+			return problem.Mongo(c, err, "Can not find the product of export")
+		}
+		return c.JSON(http.StatusOK, expanded.([]models.ExportWithProduct)[0])
 	}
 
 	exportWithProduct := models.ExportData{
 		ID:           export.ID,
+		ProductId:    export.ProductId,
 		ProductName:  export.ProductName,
 		Category:     export.Category,
 		ValueTHB:     export.ValueTHB,
@@ -188,24 +220,26 @@ func GetExport(c echo.Context) error {
 	return c.JSON(http.StatusOK, exportWithProduct)
 }
 
-func EditExport(c echo.Context) error {
+func (h *Handler) EditExport(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	exportId, err := primitive.ObjectIDFromHex(c.Param("exportId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid export id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid export id")
 	}
 
 	var export models.ExportData
 	if err := c.Bind(&export); err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid request payload"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
 	}
 
 	var updateExport models.ExportData
-	err = exportCollection.FindOne(ctx, bson.M{"_id": exportId}).Decode(&updateExport)
+	filter := notDeleted()
+	filter["_id"] = exportId
+	err = h.Exports.Get(ctx, filter, nil, &updateExport)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Export not found"})
+		return problem.Mongo(c, err, "Export not found")
 	}
 
 	if export.ProductName != "" {
@@ -220,6 +254,9 @@ func EditExport(c echo.Context) error {
 	if export.ValueUSD != 0 {
 		updateExport.ValueUSD = export.ValueUSD
 	}
+	if export.BusinessSize != "" {
+		updateExport.BusinessSize = export.BusinessSize
+	}
 	if export.Country != "" {
 		updateExport.Country = export.Country
 	}
@@ -229,67 +266,95 @@ func EditExport(c echo.Context) error {
 	if export.Year != 0 {
 		updateExport.Year = export.Year
 	}
+	if export.ProductId != nil {
+		updateExport.ProductId = export.ProductId
+	}
+
+	if err := h.linkExport(ctx, &updateExport); err != nil {
+		var errs validation.Errors
+		if errors.As(err, &errs) {
+			return problem.Validation(c, errs)
+		}
+		return problem.Mongo(c, err, "Can not find product")
+	}
+
+	if errs := validation.Struct(updateExport); errs != nil {
+		return problem.Validation(c, errs)
+	}
 
 	updateTime := time.Now()
 	updateExport.UpdatedAt = &updateTime
 
-	result, err := exportCollection.UpdateByID(ctx, exportId, bson.M{"$set": updateExport})
+	before := h.exportAudit.before(ctx, exportId)
+
+	result, err := h.Exports.Update(ctx, bson.M{"_id": exportId}, bson.M{"$set": updateExport})
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Failed to update export"})
+		return problem.Mongo(c, err, "Failed to update export")
 	}
 
-	if result.ModifiedCount == 0 {
+	h.exportAudit.record(ctx, c, "update", before, exportId)
+
+	if result.Modified == 0 {
 		return c.JSON(http.StatusOK, echo.Map{"message": "No changes detected"})
 	}
 
 	return c.JSON(http.StatusOK, echo.Map{"message": "Export had been updated"})
 }
 
-func DeleteExport(c echo.Context) error {
+func (h *Handler) DeleteExport(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	deleteType, err := strconv.Atoi(c.QueryParam("deleteType"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid delete type"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid delete type")
 	}
 
 	exportId, err := primitive.ObjectIDFromHex(c.Param("exportId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid export id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid export id")
 	}
 
 	var export models.Product
-	err = exportCollection.FindOne(ctx, bson.M{"_id": exportId}).Decode(&export)
+	// an export in the trash can only be deleted for good, deleting it again
+	// would move its deletedAt
+	filter := bson.M{"_id": exportId}
+	if deleteType == 1 {
+		filter = notDeleted()
+		filter["_id"] = exportId
+	}
+
+	err = h.Exports.Get(ctx, filter, nil, &export)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Export not found"})
+		return problem.Mongo(c, err, "Export not found")
 	}
 
+	before := h.exportAudit.before(ctx, exportId)
+
 	var updateExport bson.M
 	if deleteType == 0 {
-		_, err := exportCollection.DeleteOne(ctx, bson.M{"_id": exportId})
+		_, err := h.Exports.Delete(ctx, bson.M{"_id": exportId})
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Failed to hard delete export"})
+			return problem.Mongo(c, err, "Failed to hard delete export")
 		}
 	} else if deleteType == 1 {
 		updateExport = bson.M{
-			"deletedAt": time.Now(),
+			deletedAtField: time.Now(),
 		}
 
-		result, err := exportCollection.UpdateOne(ctx, bson.M{"_id": exportId}, bson.M{"$set": updateExport})
+		result, err := h.Exports.Update(ctx, filter, bson.M{"$set": updateExport})
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Failed to soft delete export"})
+			return problem.Mongo(c, err, "Failed to soft delete export")
 		}
 
-		if result.ModifiedCount == 0 {
+		if result.Modified == 0 {
 			return c.JSON(http.StatusOK, echo.Map{"message": "Export had been deleted"})
 		}
 	} else {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Invalid delete type"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid delete type")
 	}
 
+	h.exportAudit.record(ctx, c, "delete", before, exportId)
+
 	return c.JSON(http.StatusOK, echo.Map{"message": export.ID.Hex() + " has been deleted"})
 }
-
-
-
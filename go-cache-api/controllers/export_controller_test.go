@@ -0,0 +1,202 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-cache-api/models"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createExports(t *testing.T, e *echo.Echo, exports ...models.ExportData) []models.ExportData {
+	t.Helper()
+
+	var created struct {
+		Exports []models.ExportData `json:"exports"`
+	}
+	decode(t, do(t, e, http.MethodPost, "/exports", exports), http.StatusCreated, &created)
+	return created.Exports
+}
+
+func TestCreateExportsLinksProducts(t *testing.T) {
+	e := newServer()
+	product := createProducts(t, e, models.Product{ProductName: "Rice", Category: "Food", BusinessSize: "Small"})[0]
+
+	created := createExports(t, e,
+		// the product fields of a linked export are the ones of its product
+		models.ExportData{ProductId: &product.ID, ProductName: "Corn", Country: "Japan", Month: 1, Year: 2024},
+		// an export without productId is linked by its product fields
+		models.ExportData{ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Laos", Month: 2, Year: 2024},
+		models.ExportData{ProductName: "Tea", Category: "Drink", BusinessSize: "Micro", Country: "Laos", Month: 2, Year: 2024},
+	)
+	if len(created) != 3 {
+		t.Fatalf("created = %+v", created)
+	}
+
+	for i, export := range created[:2] {
+		if export.ProductId == nil || *export.ProductId != product.ID {
+			t.Errorf("export %d productId = %v, want %s", i, export.ProductId, product.ID.Hex())
+		}
+		if export.ProductName != "Rice" || export.Category != "Food" || export.BusinessSize != "Small" {
+			t.Errorf("export %d = %+v, want the fields of its product", i, export)
+		}
+	}
+	if created[2].ProductId != nil {
+		t.Errorf("export without a product productId = %s", created[2].ProductId.Hex())
+	}
+
+	var export models.ExportData
+	decode(t, do(t, e, http.MethodGet, "/exports/"+created[0].ID.Hex(), nil), http.StatusOK, &export)
+	if export.Country != "Japan" || export.ProductName != "Rice" {
+		t.Errorf("export = %+v", export)
+	}
+}
+
+func TestCreateExportsValidation(t *testing.T) {
+	unknown := primitive.NewObjectID()
+	valid := models.ExportData{ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Japan", Month: 1, Year: 2024}
+
+	tests := []struct {
+		name   string
+		change func(*models.ExportData)
+		field  string
+		rule   string
+	}{
+		{"unknown product", func(x *models.ExportData) { x.ProductId = &unknown }, "productId", "exists"},
+		{"missing country", func(x *models.ExportData) { x.Country = "" }, "country", "required"},
+		{"month out of range", func(x *models.ExportData) { x.Month = 13 }, "month", "max"},
+		{"missing business size", func(x *models.ExportData) { x.BusinessSize = "" }, "businessSize", "required"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newServer()
+
+			export := valid
+			tt.change(&export)
+			rules := validationRules(t, do(t, e, http.MethodPost, "/exports", []models.ExportData{export}))
+			if rules[tt.field] != tt.rule {
+				t.Errorf("rules = %v, want %s on %s", rules, tt.rule, tt.field)
+			}
+		})
+	}
+}
+
+func TestGetExportsCursor(t *testing.T) {
+	e := newServer()
+
+	exports := []models.ExportData{}
+	for month := 1; month <= 5; month++ {
+		exports = append(exports, models.ExportData{ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Japan", Month: month, Year: 2024})
+	}
+	createExports(t, e, exports...)
+
+	months := []int{}
+	target := "/exports?limit=2"
+	for i := 0; target != ""; i++ {
+		if i > 5 {
+			t.Fatal("the cursor does not end")
+		}
+
+		var list page[models.ExportData]
+		decode(t, do(t, e, http.MethodGet, target, nil), http.StatusOK, &list)
+		for _, export := range list.Items {
+			months = append(months, export.Month)
+		}
+
+		target = ""
+		if list.NextCursor != "" {
+			target = "/exports?limit=2&cursor=" + list.NextCursor
+		}
+	}
+
+	want := []int{5, 4, 3, 2, 1}
+	if len(months) != len(want) {
+		t.Fatalf("months = %v, want %v", months, want)
+	}
+	for i := range want {
+		if months[i] != want[i] {
+			t.Fatalf("months = %v, want %v", months, want)
+		}
+	}
+}
+
+func TestGetExportsExpandWithoutMongo(t *testing.T) {
+	e := newServer()
+	createExports(t, e, models.ExportData{ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Japan", Month: 1, Year: 2024})
+
+	if rec := do(t, e, http.MethodGet, "/exports?expand=product", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("expand=product status = %d, want 400: %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestEditExport(t *testing.T) {
+	e := newServer()
+	id := createExports(t, e, models.ExportData{ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Japan", Month: 1, Year: 2024})[0].ID.Hex()
+
+	decode(t, do(t, e, http.MethodPut, "/exports/"+id, models.ExportData{Country: "Laos", Month: 6}), http.StatusOK, nil)
+
+	var export models.ExportData
+	decode(t, do(t, e, http.MethodGet, "/exports/"+id, nil), http.StatusOK, &export)
+	if export.Country != "Laos" || export.Month != 6 || export.Year != 2024 {
+		t.Errorf("export = %+v", export)
+	}
+
+	if rules := validationRules(t, do(t, e, http.MethodPut, "/exports/"+id, models.ExportData{Month: 13})); rules["month"] != "max" {
+		t.Errorf("rules = %v", rules)
+	}
+}
+
+func TestPatchExportProductId(t *testing.T) {
+	e := newServer()
+	products := createProducts(t, e,
+		models.Product{ProductName: "Rice", Category: "Food", BusinessSize: "Small"},
+		models.Product{ProductName: "Tea", Category: "Drink", BusinessSize: "Micro"},
+	)
+	id := createExports(t, e, models.ExportData{ProductId: &products[0].ID, Country: "Japan", Month: 1, Year: 2024})[0].ID.Hex()
+
+	req := httptest.NewRequest(http.MethodPatch, "/exports/"+id, strings.NewReader(`{"productId":"`+products[1].ID.Hex()+`"}`))
+	req.Header.Set(echo.HeaderContentType, "application/merge-patch+json")
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	decode(t, rec, http.StatusOK, nil)
+
+	// the product fields follow the product the export now references
+	var export models.ExportData
+	decode(t, do(t, e, http.MethodGet, "/exports/"+id, nil), http.StatusOK, &export)
+	if export.ProductId == nil || *export.ProductId != products[1].ID {
+		t.Fatalf("productId = %v, want %s", export.ProductId, products[1].ID.Hex())
+	}
+	if export.ProductName != "Tea" || export.Category != "Drink" || export.BusinessSize != "Micro" {
+		t.Errorf("export = %+v, want the fields of Tea", export)
+	}
+}
+
+func TestSoftDeleteAndRestoreExport(t *testing.T) {
+	e := newServer()
+	id := createExports(t, e, models.ExportData{ProductName: "Rice", Category: "Food", BusinessSize: "Small", Country: "Japan", Month: 1, Year: 2024})[0].ID.Hex()
+
+	decode(t, do(t, e, http.MethodDelete, "/exports/"+id+"?deleteType=1", nil), http.StatusOK, nil)
+
+	var list page[models.ExportData]
+	decode(t, do(t, e, http.MethodGet, "/exports", nil), http.StatusOK, &list)
+	if list.Total != 0 {
+		t.Errorf("soft deleted export is listed, total = %d", list.Total)
+	}
+
+	decode(t, do(t, e, http.MethodGet, "/exports/trash", nil), http.StatusOK, &list)
+	if list.Total != 1 {
+		t.Fatalf("trash total = %d, want 1", list.Total)
+	}
+
+	if rec := do(t, e, http.MethodDelete, "/exports/"+id+"?deleteType=1", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second soft delete status = %d, want 404", rec.Code)
+	}
+
+	decode(t, do(t, e, http.MethodPost, "/exports/"+id+"/restore", nil), http.StatusOK, nil)
+	decode(t, do(t, e, http.MethodGet, "/exports/"+id, nil), http.StatusOK, nil)
+}
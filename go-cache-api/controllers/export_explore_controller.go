@@ -6,6 +6,7 @@ import (
 	"fmt"
 	"go-cache-api/configs"
 	"go-cache-api/models"
+	"go-cache-api/problem"
 	"log"
 	"net/http"
 	"strconv"
@@ -16,10 +17,6 @@ import (
 	"go.mongodb.org/mongo-driver/bson"
 )
 
-type Handler struct {
-	DB *configs.Database
-}
-
 func IntToPointer(i int) *int {
 	return &i
 }
@@ -41,22 +38,25 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 	err = c.Bind(body)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, &models.Exception{
-			Status: IntToPointer(http.StatusBadRequest),
-			Detail: err.(*echo.HTTPError).Message.(string),
-		})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
+	}
+
+	format, err := downloadFormat(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
 	requestBodyJSON, err := json.Marshal(body)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, echo.Map{"error": err.Error()})
+		return problem.Write(c, http.StatusInternalServerError, "Error marshaling JSON")
 	}
 
 	specificResponse := string(requestBodyJSON) + strconv.Itoa(getMaxAgeTime(c))
 	hashkey := generateETag(specificResponse)
 	cacheKey := "products:" + hashkey
 
-	pipeline := []bson.M{}
+	// soft deleted exports are left out of every exploration
+	pipeline := []bson.M{{"$match": notDeleted()}}
 	match := bson.M{}
 
 	//
@@ -74,10 +74,7 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 			var arg *models.ExploreFilter
 			err = json.Unmarshal(b, &arg)
 			if err != nil {
-				return c.JSON(http.StatusBadRequest, &models.Exception{
-					Status: IntToPointer(http.StatusBadRequest),
-					Detail: "Body 'filter' is invalid",
-				})
+				return problem.Write(c, http.StatusBadRequest, "Body 'filter' is invalid")
 			}
 
 			if len(arg.Arguments) > 0 {
@@ -90,10 +87,7 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 		match, err = configs.FilterToBsonM(body.Filter)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, &models.Exception{
-				Status: IntToPointer(http.StatusBadRequest),
-				Detail: "Body 'filter' is invalid, " + err.Error(),
-			})
+			return problem.Write(c, http.StatusBadRequest, "Body 'filter' is invalid, "+err.Error())
 		}
 	}
 
@@ -212,16 +206,22 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 	})
 
 	//
-	// limit stage
+	// limit stage, a download holds every result unless a limit is given
 	//
 	limit := 10
 	if body.Limit != nil {
 		limit = *body.Limit
 	}
 
-	pipeline = append(pipeline, bson.M{
-		"$limit": limit,
-	})
+	if format == nil || body.Limit != nil {
+		pipeline = append(pipeline, bson.M{
+			"$limit": limit,
+		})
+	}
+
+	if format != nil {
+		return h.downloadExploration(c, format, body, pipeline)
+	}
 
 	//---------------redis------------------//
 	cacheMutex.Lock()
@@ -231,22 +231,22 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 	if c.Request().Header.Get("Cache-Control") == "only-if-cached" {
 
-		cacheProducts, found := redisClient.Get(context.Background(), cacheKey).Result()
+		cacheProducts, found := h.Redis.Get(context.Background(), cacheKey).Result()
 
 		if found != nil {
 			c.Response().Header().Set("Cache-Control", "no-store")
 			c.Response().Header().Set("Connection", "close")
 			c.Response().Header().Set("X-Cache-Status", "Miss")
-			return c.JSON(http.StatusGatewayTimeout, echo.Map{"message": "The resource is not in the cache, and the server could not retrieve it"})
+			return problem.Write(c, http.StatusGatewayTimeout, "The resource is not in the cache, and the server could not retrieve it")
 		}
 
 		var products map[string][]interface{}
 		if err := json.Unmarshal([]byte(cacheProducts), &products); err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"message": "Error unmarshal JSON only if cached"})
+			return problem.Write(c, http.StatusInternalServerError, "Error unmarshal JSON only if cached")
 		}
 
 		maxAgeTime := getMaxAgeTime(c)
-		cacheAgeTime, err := redisClient.TTL(context.Background(), cacheKey).Result()
+		cacheAgeTime, err := h.Redis.TTL(context.Background(), cacheKey).Result()
 		if err != nil {
 			log.Println(err)
 		}
@@ -276,18 +276,18 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 	}
 
-	cacheProducts, found := redisClient.Get(context.Background(), cacheKey).Result()
+	cacheProducts, found := h.Redis.Get(context.Background(), cacheKey).Result()
 	//cache Hit
 	if found == nil {
 
 		var products map[string][]interface{}
 		err := json.Unmarshal([]byte(cacheProducts), &products)
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, echo.Map{"error": err.Error()})
+			return problem.Write(c, http.StatusInternalServerError, err.Error())
 		}
 
 		maxAgeTime := getMaxAgeTime(c)
-		cacheAgeTime, err := redisClient.TTL(context.Background(), cacheKey).Result()
+		cacheAgeTime, err := h.Redis.TTL(context.Background(), cacheKey).Result()
 		if err != nil {
 			log.Println(err)
 		}
@@ -326,10 +326,7 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 	//
 	aggServiceUsages, err := h.DB.AggregateServiceUsage(context.Background(), pipeline)
 	if err != nil {
-		return c.JSON(http.StatusUnprocessableEntity, &models.Exception{
-			Status: IntToPointer(http.StatusUnprocessableEntity),
-			Detail: "Could not explore service usages, " + err.Error(),
-		})
+		return problem.Write(c, http.StatusUnprocessableEntity, "Could not explore service usages, "+err.Error())
 	}
 
 	results := []interface{}{}
@@ -343,7 +340,7 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 
 	productMarshal, err := json.Marshal(response)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, echo.Map{"message": "Error marshaling JSON"})
+		return problem.Write(c, http.StatusInternalServerError, "Error marshaling JSON")
 	}
 
 	maxAgeTime := getMaxAgeTime(c)
@@ -370,7 +367,7 @@ func (h *Handler) ExploreServiceUsages(c echo.Context) error {
 	}
 
 	if cacheControl != "no-store" {
-		err = redisClient.Set(context.Background(), cacheKey, productMarshal, time.Duration(maxAgeTime)*time.Second).Err()
+		err = h.Redis.Set(context.Background(), cacheKey, productMarshal, time.Duration(maxAgeTime)*time.Second).Err()
 		if err != nil {
 			log.Println(err)
 		}
@@ -0,0 +1,248 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cache-api/link"
+	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/repository"
+	"go-cache-api/validation"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// parseExpand reads ?expand=, product is the only relation exports have. The
+// product is joined by mongo, a handler of repositories alone can not expand it
+func (h *Handler) parseExpand(c echo.Context) (bool, error) {
+	expand := false
+	for _, name := range normalizeFields(c.QueryParams()["expand"]) {
+		if name != "product" {
+			return false, fmt.Errorf("can not expand '%s'", name)
+		}
+		expand = true
+	}
+	if expand && h.exportCollection == nil {
+		return false, errors.New("expand is not available on this server")
+	}
+	return expand, nil
+}
+
+// expandProducts joins the product of each export of items with $lookup.
+// items are the exports of a page, []models.ExportData or the []bson.M of a
+// sparse fieldset, and keep their order
+func (h *Handler) expandProducts(ctx context.Context, items interface{}) (interface{}, error) {
+	ids := []primitive.ObjectID{}
+	switch exports := items.(type) {
+	case []models.ExportData:
+		for _, export := range exports {
+			ids = append(ids, export.ID)
+		}
+	case []bson.M:
+		for _, doc := range exports {
+			if id, ok := doc["id"].(primitive.ObjectID); ok {
+				ids = append(ids, id)
+			}
+		}
+	default:
+		return nil, errors.New("can not expand the product of these items")
+	}
+
+	cur, err := h.exportCollection.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"_id": bson.M{"$in": ids}}},
+		// a deleted product is not joined, like an export without one
+		{"$lookup": bson.M{
+			"from": repository.ProductCollection,
+			"let":  bson.M{"productId": "$productId"},
+			"pipeline": []bson.M{{"$match": bson.M{
+				"$expr":        bson.M{"$eq": bson.A{"$_id", "$$productId"}},
+				deletedAtField: nil,
+			}}},
+			"as": "product",
+		}},
+		{"$unwind": bson.M{"path": "$product", "preserveNullAndEmptyArrays": true}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	joined := []models.ExportWithProduct{}
+	if err := cur.All(ctx, &joined); err != nil {
+		return nil, err
+	}
+
+	byID := map[primitive.ObjectID]models.ExportWithProduct{}
+	for _, export := range joined {
+		byID[export.ID] = export
+	}
+
+	if docs, ok := items.([]bson.M); ok {
+		for _, doc := range docs {
+			if id, ok := doc["id"].(primitive.ObjectID); ok {
+				doc["product"] = byID[id].Product
+			}
+		}
+		return docs, nil
+	}
+
+	// the score of a search result is not stored, it is kept from items
+	expanded := []models.ExportWithProduct{}
+	for _, export := range items.([]models.ExportData) {
+		joined := byID[export.ID]
+		joined.Score = export.Score
+		expanded = append(expanded, joined)
+	}
+	return expanded, nil
+}
+
+// linkProducts points every export to its product. An export naming a
+// productId gets the product fields copied from it, the others are linked
+// to the product with the same name, category and business size if there is one
+func (h *Handler) linkProducts(ctx context.Context, exports []models.ExportData) (validation.Errors, error) {
+	ids := []primitive.ObjectID{}
+	for _, export := range exports {
+		if export.ProductId != nil {
+			ids = append(ids, *export.ProductId)
+		}
+	}
+
+	products := map[primitive.ObjectID]models.Product{}
+	if len(ids) > 0 {
+		filter := notDeleted()
+		filter["_id"] = bson.M{"$in": ids}
+
+		found := []models.Product{}
+		if err := h.Products.Find(ctx, repository.Query{Filter: filter}, &found); err != nil {
+			return nil, err
+		}
+
+		for _, product := range found {
+			products[product.ID] = product
+		}
+	}
+
+	errs := validation.Errors{}
+	matcher := link.NewMatcher(h.Products)
+	for i := range exports {
+		export := &exports[i]
+
+		if export.ProductId == nil {
+			id, err := matcher.Match(ctx, link.Key{ProductName: export.ProductName, Category: export.Category, BusinessSize: export.BusinessSize})
+			if err != nil {
+				return nil, err
+			}
+			export.ProductId = id
+			continue
+		}
+
+		product, ok := products[*export.ProductId]
+		if !ok {
+			index := i
+			errs = append(errs, validation.FieldError{
+				Field:   "productId",
+				Index:   &index,
+				Rule:    "exists",
+				Message: "productId does not reference a product",
+			})
+			continue
+		}
+
+		export.ProductName = product.ProductName
+		export.Category = product.Category
+		export.BusinessSize = product.BusinessSize
+	}
+
+	if len(errs) == 0 {
+		return nil, nil
+	}
+	return errs, nil
+}
+
+// linkExport links a single export with linkProducts, an export whose
+// productId was removed stays unlinked
+func (h *Handler) linkExport(ctx context.Context, export *models.ExportData) error {
+	if export.ProductId == nil {
+		return nil
+	}
+
+	exports := []models.ExportData{*export}
+	errs, err := h.linkProducts(ctx, exports)
+	if err != nil {
+		return err
+	}
+	if errs != nil {
+		errs[0].Index = nil
+		return errs
+	}
+
+	*export = exports[0]
+	return nil
+}
+
+// validateExport is validateModel for a patched export, its product fields
+// are taken from the product it references
+func (h *Handler) validateExport(ctx context.Context) func(interface{}) error {
+	return func(v interface{}) error {
+		if err := h.linkExport(ctx, v.(*models.ExportData)); err != nil {
+			return err
+		}
+		return validateModel(v)
+	}
+}
+
+// syncProductExports copies the product fields to the exports referencing the
+// products of ids. The copies are derived data so they are not kept in the history
+func (h *Handler) syncProductExports(ctx context.Context, ids ...primitive.ObjectID) {
+	filter := notDeleted()
+	filter["_id"] = bson.M{"$in": ids}
+
+	products := []models.Product{}
+	if err := h.Products.Find(ctx, repository.Query{Filter: filter}, &products); err != nil {
+		log.Println("sync product exports:", err)
+		return
+	}
+
+	for _, product := range products {
+		_, err := h.exportCollection.UpdateMany(ctx, bson.M{"productId": product.ID}, bson.M{"$set": bson.M{
+			"productName":  product.ProductName,
+			"category":     product.Category,
+			"businessSize": product.BusinessSize,
+		}})
+		if err != nil {
+			log.Println("sync product exports:", err)
+			continue
+		}
+
+		if err := h.exportSearch.reindex(ctx, bson.M{"productId": product.ID}); err != nil {
+			log.Println("sync product exports:", err)
+		}
+	}
+}
+
+// GetProductExports lists the exports of a product
+func (h *Handler) GetProductExports(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid product id")
+	}
+
+	filter := notDeleted()
+	filter["_id"] = productId
+	if err := h.Products.Get(ctx, filter, bson.M{"_id": 1}, &bson.M{}); err != nil {
+		return problem.Mongo(c, err, "Product not found")
+	}
+
+	base := notDeleted()
+	base["productId"] = productId
+
+	return h.listExports(c, ctx, base)
+}
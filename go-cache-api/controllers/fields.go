@@ -0,0 +1,126 @@
+package controllers
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// fieldSet is the sparse fieldset requested with ?fields=
+type fieldSet struct {
+	// Fields are the json names requested by the client, sorted and without duplicates
+	Fields     []string
+	Projection bson.M
+}
+
+// modelFields maps the json name of every field of model to its bson name
+func modelFields(model interface{}) map[string]string {
+	fields := map[string]string{}
+
+	t := reflect.TypeOf(model)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+
+		jsonName := strings.Split(f.Tag.Get("json"), ",")[0]
+		bsonName := strings.Split(f.Tag.Get("bson"), ",")[0]
+		if jsonName == "" || jsonName == "-" || bsonName == "" || bsonName == "-" {
+			continue
+		}
+
+		fields[jsonName] = bsonName
+	}
+
+	return fields
+}
+
+// normalizeFields splits the ?fields= values into a sorted list without duplicates
+func normalizeFields(values []string) []string {
+	seen := map[string]bool{}
+	fields := []string{}
+	for _, v := range values {
+		for _, f := range strings.Split(v, ",") {
+			f = strings.TrimSpace(f)
+			if f != "" && !seen[f] {
+				seen[f] = true
+				fields = append(fields, f)
+			}
+		}
+	}
+	sort.Strings(fields)
+	return fields
+}
+
+// parseFields validates ?fields= against the json fields of model and builds
+// the matching projection. It returns nil when the client wants every field
+func parseFields(c echo.Context, model interface{}) (*fieldSet, error) {
+	fields := normalizeFields(c.QueryParams()["fields"])
+	if len(fields) == 0 {
+		return nil, nil
+	}
+
+	known := modelFields(model)
+
+	fs := &fieldSet{Fields: fields, Projection: bson.M{}}
+	for _, f := range fields {
+		bsonName, ok := known[f]
+		if !ok {
+			return nil, fmt.Errorf("unknown field '%s' in fields", f)
+		}
+		fs.Projection[bsonName] = 1
+	}
+
+	return fs, nil
+}
+
+// projection returns the mongo projection, nil when every field is wanted
+func (fs *fieldSet) projection() bson.M {
+	if fs == nil {
+		return nil
+	}
+	return fs.Projection
+}
+
+// withSort adds the sort keys to the projection, keyset pagination needs
+// their values to build the next cursor
+func (fs *fieldSet) withSort(sorts bson.D) {
+	if fs == nil {
+		return
+	}
+	for _, s := range sorts {
+		fs.Projection[s.Key] = 1
+	}
+}
+
+// results returns the slice to decode documents into. Documents are decoded
+// as bson.M when fields were selected so the unselected ones stay out of the response
+func (fs *fieldSet) results(typed interface{}) interface{} {
+	if fs == nil {
+		return typed
+	}
+	return &[]bson.M{}
+}
+
+// items dereferences results for the response, renaming _id to its json name
+func (fs *fieldSet) items(results interface{}) interface{} {
+	docs, ok := results.(*[]bson.M)
+	if !ok {
+		return reflect.ValueOf(results).Elem().Interface()
+	}
+
+	for _, doc := range *docs {
+		renameID(doc)
+	}
+
+	return *docs
+}
+
+func renameID(doc bson.M) {
+	if id, ok := doc["_id"]; ok {
+		doc["id"] = id
+		delete(doc, "_id")
+	}
+}
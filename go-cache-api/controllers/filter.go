@@ -0,0 +1,80 @@
+package controllers
+
+import (
+	"go-cache-api/configs"
+	"go-cache-api/models"
+	"shared/query"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// listQueryParams are the query parameters of list endpoints that are not filters
+var listQueryParams = []string{"limit", "offset", "page", "cursor", "sortby", "search", "fields", "expand", "format"}
+
+var (
+	productFilterFields = configs.FilterFields(models.Product{},
+		"id", "productName", "category", "valueTHB", "valueUSD", "businessSize", "createdAt", "updatedAt")
+	exportFilterFields = configs.FilterFields(models.ExportData{},
+		"id", "productId", "productName", "category", "valueTHB", "valueUSD", "businessSize", "country", "month", "year", "createdAt", "updatedAt")
+)
+
+// sortable fields are the ones backed by an index
+var (
+	productSort = query.SortSpec{
+		Fields: map[string]string{
+			"id":          "_id",
+			"productName": "productName",
+			"category":    "category",
+			"valueTHB":    "valueTHB",
+			"valueUSD":    "valueUSD",
+			"createdAt":   "createdAt",
+			"updatedAt":   "updatedAt",
+		},
+		Default: bson.D{{Key: "createdAt", Value: -1}},
+	}
+	exportSort = query.SortSpec{
+		Fields: map[string]string{
+			"id":          "_id",
+			"productName": "productName",
+			"category":    "category",
+			"valueTHB":    "valueTHB",
+			"valueUSD":    "valueUSD",
+			"country":     "country",
+			"month":       "month",
+			"year":        "year",
+			"createdAt":   "createdAt",
+			"updatedAt":   "updatedAt",
+		},
+		Default: bson.D{{Key: "year", Value: -1}, {Key: "month", Value: -1}},
+	}
+)
+
+// parseSort reads ?sortby= and falls back to the default sort of the resource
+func parseSort(c echo.Context, spec query.SortSpec) (bson.D, error) {
+	return query.ParseSort(c.QueryParams()["sortby"], spec)
+}
+
+// applyQueryFilter adds the filters of the query string to filter, e.g.
+// country=Japan&year[gte]=2020. They are appended to the $and filter already has
+func applyQueryFilter(c echo.Context, filter bson.M, allowed map[string]configs.FilterField) error {
+	and, err := configs.GenerateFilterBson(c.QueryParams(), listQueryParams, allowed)
+	if err != nil {
+		return err
+	}
+
+	if len(and) == 0 {
+		return nil
+	}
+
+	switch existing := filter["$and"].(type) {
+	case nil:
+	case []bson.M:
+		and = append(existing, and...)
+	default:
+		and = append([]bson.M{{"$and": existing}}, and...)
+	}
+	filter["$and"] = and
+
+	return nil
+}
@@ -0,0 +1,154 @@
+package controllers
+
+import (
+	"context"
+	"sync"
+
+	"go-cache-api/configs"
+	"go-cache-api/importer"
+	"go-cache-api/models"
+	"go-cache-api/repository"
+	"go-cache-api/search"
+
+	"github.com/redis/go-redis/v9"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Handler serves the api. It gets the repositories and the clients it works
+// with at construction, the package opens no connection of its own
+type Handler struct {
+	// DB runs the explorations of exports
+	DB *configs.Database
+	// Products and Exports store the products and exports the CRUD handlers
+	// read and write
+	Products repository.ProductRepository
+	Exports  repository.ExportRepository
+	// Mongo runs what the repositories do not cover, the aggregations, bulk
+	// writes and indexes of products and exports, their history and the
+	// imports. A handler without it keeps no history and no search terms
+	Mongo *mongo.Database
+	// Redis caches responses and the idempotency keys
+	Redis *redis.Client
+
+	productCollection      *mongo.Collection
+	exportCollection       *mongo.Collection
+	historyCollection      *mongo.Collection
+	importJobCollection    *mongo.Collection
+	importRecordCollection *mongo.Collection
+
+	productAudit  auditResource
+	exportAudit   auditResource
+	productSearch searchIndex
+	exportSearch  searchIndex
+	productBulk   bulkResource
+	exportBulk    bulkResource
+
+	// exportKey identifies an export row, imported rows are matched on it
+	exportKey importer.NaturalKey
+	// importMappings are the column mappings a file can be imported with, by name
+	importMappings map[string]importer.Mapping
+	// importWake tells the import worker a job was queued
+	importWake chan struct{}
+	// jobOwner names this server in the leases of the import jobs it runs
+	jobOwner string
+	// jobs are the background jobs running, see Wait
+	jobs sync.WaitGroup
+}
+
+// store is what the handlers shared by products and exports read and write
+// them through, both repositories are one
+type store interface {
+	Get(ctx context.Context, filter bson.M, projection bson.M, result interface{}) error
+	Find(ctx context.Context, q repository.Query, results interface{}) error
+	Count(ctx context.Context, filter bson.M) (int64, error)
+	Update(ctx context.Context, filter bson.M, update bson.M) (repository.UpdateResult, error)
+	Delete(ctx context.Context, filter bson.M) (int64, error)
+}
+
+// NewHandler serves the api from db, redisClient caches it. imports are the
+// settings of the imports, an empty one imports with the defaults
+func NewHandler(db *mongo.Database, redisClient *redis.Client, imports configs.Import) (*Handler, error) {
+	h := newHandler(repository.NewMongoProducts(db), repository.NewMongoExports(db), db)
+	h.DB = &configs.Database{Client: db.Client(), Name: db.Name()}
+	h.Redis = redisClient
+
+	var err error
+	if h.exportKey, err = imports.Key(); err != nil {
+		return nil, err
+	}
+	if h.importMappings, err = importer.LoadMappings(imports.MappingsFile); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// NewRepositoryHandler serves the handlers that only read and write through
+// products and exports, the CRUD of both, their trash and patches. It lets them
+// be tested with the memory repositories. Without mongo there is no product to
+// join, the exports answer expand=product with a 400
+func NewRepositoryHandler(products repository.ProductRepository, exports repository.ExportRepository) *Handler {
+	return newHandler(products, exports, nil)
+}
+
+func newHandler(products repository.ProductRepository, exports repository.ExportRepository, db *mongo.Database) *Handler {
+	h := &Handler{
+		Products:       products,
+		Exports:        exports,
+		Mongo:          db,
+		importMappings: importer.DefaultMappings(),
+		importWake:     make(chan struct{}, 1),
+		jobOwner:       newJobOwner(),
+	}
+
+	if db != nil {
+		h.productCollection = db.Collection(repository.ProductCollection)
+		h.exportCollection = db.Collection(repository.ExportCollection)
+		h.historyCollection = db.Collection("history")
+		h.importJobCollection = db.Collection("imports")
+		h.importRecordCollection = db.Collection("importRecords")
+	}
+
+	h.productSearch = searchIndex{collection: h.productCollection, weights: search.ProductWeights}
+	h.exportSearch = searchIndex{collection: h.exportCollection, weights: search.ExportWeights}
+
+	h.productAudit = auditResource{name: "products", store: products, collection: h.productCollection, history: h.historyCollection}
+	h.exportAudit = auditResource{name: "exports", store: exports, collection: h.exportCollection, history: h.historyCollection}
+	if db != nil {
+		h.productAudit.onWrite = h.onProductWrite
+		h.exportAudit.onWrite = h.exportSearch.index
+	}
+
+	h.productBulk = bulkResource{
+		collection: h.productCollection,
+		audit:      h.productAudit,
+		newModel:   func() interface{} { return &models.Product{} },
+		validate:   func(context.Context) func(interface{}) error { return validateModel },
+	}
+	h.exportBulk = bulkResource{
+		collection: h.exportCollection,
+		audit:      h.exportAudit,
+		newModel:   func() interface{} { return &models.ExportData{} },
+		// exports are linked to their product like the single exports
+		validate: h.validateExport,
+	}
+
+	return h
+}
+
+// Wait waits for the background jobs to stop once the context they were
+// started with is done. It gives up when ctx is done first
+func (h *Handler) Wait(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		h.jobs.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,98 @@
+package controllers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"go-cache-api/configs"
+	"go-cache-api/controllers"
+	"go-cache-api/problem"
+	"go-cache-api/repository"
+	"go-cache-api/routes"
+
+	"github.com/labstack/echo"
+)
+
+// newServer serves the product and export routes on memory repositories
+func newServer() *echo.Echo {
+	h := controllers.NewRepositoryHandler(repository.NewMemoryProducts(), repository.NewMemoryExports())
+
+	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	cfg := &configs.Config{}
+	routes.ProductRoute(e, h, cfg)
+	routes.ExportRoute(e, h, cfg)
+	return e
+}
+
+// do sends a request with a JSON body, a nil body sends none
+func do(t *testing.T, e *echo.Echo, method string, target string, body interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+
+	var reader *bytes.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		reader = bytes.NewReader(b)
+	} else {
+		reader = bytes.NewReader(nil)
+	}
+
+	req := httptest.NewRequest(method, target, reader)
+	if body != nil {
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	}
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, req)
+	return rec
+}
+
+// decode reads the JSON body of rec into v once its status is the expected one
+func decode(t *testing.T, rec *httptest.ResponseRecorder, status int, v interface{}) {
+	t.Helper()
+
+	if rec.Code != status {
+		t.Fatalf("status = %d, want %d: %s", rec.Code, status, rec.Body.String())
+	}
+	if v == nil {
+		return
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), v); err != nil {
+		t.Fatalf("decode %s: %v", rec.Body.String(), err)
+	}
+}
+
+// validationRules returns the field and rule of every broken rule of a problem
+func validationRules(t *testing.T, rec *httptest.ResponseRecorder) map[string]string {
+	t.Helper()
+
+	var p struct {
+		Code   string `json:"code"`
+		Errors []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"errors"`
+	}
+	decode(t, rec, http.StatusBadRequest, &p)
+	if p.Code != problem.CodeValidation {
+		t.Fatalf("code = %q, want %q", p.Code, problem.CodeValidation)
+	}
+
+	rules := map[string]string{}
+	for _, err := range p.Errors {
+		rules[err.Field] = err.Rule
+	}
+	return rules
+}
+
+// page is the envelope of a list endpoint
+type page[T any] struct {
+	Items      []T    `json:"items"`
+	Total      int64  `json:"total"`
+	NextCursor string `json:"next_cursor"`
+}
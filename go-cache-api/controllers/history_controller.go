@@ -0,0 +1,283 @@
+package controllers
+
+import (
+	"context"
+	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/repository"
+	"go-cache-api/search"
+	"log"
+	"net/http"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// actorHeader names who made a change, there is no authentication so it is
+// trusted as sent
+const actorHeader = "X-Actor"
+
+// auditResource is a collection whose writes are kept in the history collection
+type auditResource struct {
+	name  string
+	store store
+	// collection is the collection of store, versions are reverted and the
+	// trash purged on it
+	collection *mongo.Collection
+	// history keeps the changes, they are not kept without it
+	history *mongo.Collection
+	// onWrite keeps the data derived from the written documents in step
+	onWrite func(ctx context.Context, ids ...primitive.ObjectID)
+}
+
+// onProductWrite indexes the written products and copies them to their exports
+func (h *Handler) onProductWrite(ctx context.Context, ids ...primitive.ObjectID) {
+	h.productSearch.index(ctx, ids...)
+	h.syncProductExports(ctx, ids...)
+}
+
+// snapshots loads the stored documents of ids, trash included
+func (r auditResource) snapshots(ctx context.Context, ids []primitive.ObjectID) (map[primitive.ObjectID]bson.M, error) {
+	docs := map[primitive.ObjectID]bson.M{}
+	if len(ids) == 0 {
+		return docs, nil
+	}
+
+	found := []bson.M{}
+	if err := r.store.Find(ctx, repository.Query{Filter: bson.M{"_id": bson.M{"$in": ids}}}, &found); err != nil {
+		return nil, err
+	}
+
+	for _, doc := range found {
+		docs[doc["_id"].(primitive.ObjectID)] = doc
+	}
+
+	return docs, nil
+}
+
+// before loads the documents about to be written, a failure only loses the
+// old values in the history
+func (r auditResource) before(ctx context.Context, ids ...primitive.ObjectID) map[primitive.ObjectID]bson.M {
+	docs, err := r.snapshots(ctx, ids)
+	if err != nil {
+		log.Printf("history of %s: %v", r.name, err)
+		return map[primitive.ObjectID]bson.M{}
+	}
+	return docs
+}
+
+// record writes a history entry for every document of ids whose fields
+// changed between before and its stored state. The write itself already
+// happened, so a failure is logged and not returned
+func (r auditResource) record(ctx context.Context, c echo.Context, action string, before map[primitive.ObjectID]bson.M, ids ...primitive.ObjectID) {
+	if err := r.writeHistory(ctx, c, action, nil, before, ids...); err != nil {
+		log.Printf("history of %s: %v", r.name, err)
+	}
+}
+
+// recordAs is record for a write made outside of a request, on behalf of
+// the actor and the request that asked for it
+func (r auditResource) recordAs(ctx context.Context, actor string, requestID string, action string, before map[primitive.ObjectID]bson.M, ids ...primitive.ObjectID) {
+	if err := r.writeHistoryAs(ctx, actor, requestID, action, nil, before, ids...); err != nil {
+		log.Printf("history of %s: %v", r.name, err)
+	}
+}
+
+// requestActor is who made the request, anonymous when it does not say
+func requestActor(c echo.Context) (string, string) {
+	if c == nil {
+		return "system", ""
+	}
+
+	actor := c.Request().Header.Get(actorHeader)
+	if actor == "" {
+		actor = "anonymous"
+	}
+	return actor, c.Response().Header().Get(echo.HeaderXRequestID)
+}
+
+// writeHistory is record returning its error, revertedFrom links a revert to
+// the entry it restored
+func (r auditResource) writeHistory(ctx context.Context, c echo.Context, action string, revertedFrom *primitive.ObjectID, before map[primitive.ObjectID]bson.M, ids ...primitive.ObjectID) error {
+	actor, requestID := requestActor(c)
+	return r.writeHistoryAs(ctx, actor, requestID, action, revertedFrom, before, ids...)
+}
+
+func (r auditResource) writeHistoryAs(ctx context.Context, actor string, requestID string, action string, revertedFrom *primitive.ObjectID, before map[primitive.ObjectID]bson.M, ids ...primitive.ObjectID) error {
+	if r.history == nil {
+		return nil
+	}
+	if r.onWrite != nil {
+		r.onWrite(ctx, ids...)
+	}
+
+	after, err := r.snapshots(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+
+	entries := []interface{}{}
+	for _, id := range ids {
+		changes := diffDocuments(before[id], after[id])
+		if len(changes) == 0 {
+			continue
+		}
+
+		snapshot := after[id]
+		if snapshot == nil {
+			snapshot = before[id]
+		}
+		delete(snapshot, search.Field)
+
+		entries = append(entries, models.History{
+			ID:           primitive.NewObjectID(),
+			Resource:     r.name,
+			DocumentID:   id,
+			Action:       action,
+			Actor:        actor,
+			RequestID:    requestID,
+			Changes:      changes,
+			Snapshot:     snapshot,
+			RevertedFrom: revertedFrom,
+			CreatedAt:    now,
+		})
+	}
+
+	if len(entries) == 0 {
+		return nil
+	}
+
+	_, err = r.history.InsertMany(ctx, entries)
+	return err
+}
+
+// diffDocuments lists the fields that differ, updatedAt is left out since
+// every write changes it and the search terms since they follow the other fields
+func diffDocuments(before, after bson.M) []models.FieldChange {
+	keys := map[string]bool{}
+	for k := range before {
+		keys[k] = true
+	}
+	for k := range after {
+		keys[k] = true
+	}
+
+	fields := []string{}
+	for k := range keys {
+		if k != "_id" && k != "updatedAt" && k != search.Field {
+			fields = append(fields, k)
+		}
+	}
+	sort.Strings(fields)
+
+	changes := []models.FieldChange{}
+	for _, f := range fields {
+		if !reflect.DeepEqual(before[f], after[f]) {
+			changes = append(changes, models.FieldChange{Field: f, Old: before[f], New: after[f]})
+		}
+	}
+
+	return changes
+}
+
+// listHistory returns a page of the history of a document, the latest change first
+func listHistory(c echo.Context, r auditResource, param string, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid "+name+" id")
+	}
+
+	p, err := parsePagination(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	q := p.query(bson.M{"resource": r.name, "documentId": id})
+	q.Sort = bson.D{{Key: "createdAt", Value: -1}, {Key: "_id", Value: -1}}
+
+	entries := []models.History{}
+	total, err := findPage(ctx, repository.NewMongo[models.History](r.history), q, &entries)
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find history")
+	}
+
+	for _, entry := range entries {
+		renameID(entry.Snapshot)
+	}
+
+	page := newPage(c, entries, total, p)
+	setLinkHeader(c, page.Links)
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// revertVersion writes back the document as the given history entry left it.
+// A hard deleted document is inserted again
+func revertVersion(c echo.Context, r auditResource, param string, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid "+name+" id")
+	}
+
+	historyId, err := primitive.ObjectIDFromHex(c.Param("historyId"))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid history id")
+	}
+
+	var entry models.History
+	err = r.history.FindOne(ctx, bson.M{"_id": historyId, "resource": r.name, "documentId": id}).Decode(&entry)
+	if err != nil {
+		return problem.Mongo(c, err, "Version not found")
+	}
+
+	before := r.before(ctx, id)
+
+	doc := bson.M{}
+	for k, v := range entry.Snapshot {
+		doc[k] = v
+	}
+	doc["_id"] = id
+	doc["updatedAt"] = time.Now()
+
+	_, err = r.collection.ReplaceOne(ctx, bson.M{"_id": id}, doc, options.Replace().SetUpsert(true))
+	if err != nil {
+		return problem.Mongo(c, err, "Failed to revert "+name)
+	}
+
+	if err := r.writeHistory(ctx, c, "revert", &historyId, before, id); err != nil {
+		log.Printf("history of %s: %v", r.name, err)
+	}
+
+	renameID(doc)
+	return c.JSON(http.StatusOK, doc)
+}
+
+func (h *Handler) GetProductHistory(c echo.Context) error {
+	return listHistory(c, h.productAudit, "productId", "product")
+}
+
+func (h *Handler) RestoreProductVersion(c echo.Context) error {
+	return revertVersion(c, h.productAudit, "productId", "product")
+}
+
+func (h *Handler) GetExportHistory(c echo.Context) error {
+	return listHistory(c, h.exportAudit, "exportId", "export")
+}
+
+func (h *Handler) RestoreExportVersion(c echo.Context) error {
+	return revertVersion(c, h.exportAudit, "exportId", "export")
+}
@@ -0,0 +1,202 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-cache-api/problem"
+
+	"github.com/labstack/echo"
+)
+
+const (
+	idempotencyHeader = "Idempotency-Key"
+	// replayedHeader marks a response sent again for a known key
+	replayedHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKey = 255
+)
+
+// idempotentHeaders are the response headers replayed with the body
+var idempotentHeaders = []string{echo.HeaderContentType, echo.HeaderLocation, "Link"}
+
+// idempotentResponse is what redis keeps for a key. A key without Status is
+// still being handled
+type idempotentResponse struct {
+	RequestHash string            `json:"requestHash"`
+	Status      int               `json:"status,omitempty"`
+	Header      map[string]string `json:"header,omitempty"`
+	Body        []byte            `json:"body,omitempty"`
+}
+
+// responseRecorder copies what the handler writes so it can be replayed
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (r *responseRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+func (r *responseRecorder) Write(b []byte) (int, error) {
+	r.body.Write(b)
+	return r.ResponseWriter.Write(b)
+}
+
+// Idempotent is the middleware honoring the Idempotency-Key header of POST
+// requests. The first response of a key is kept for ttl and sent again to the
+// retries with the same body, a retry with another body gets 422. Requests
+// without the header are handled as usual
+func (h *Handler) Idempotent(ttl time.Duration) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			// a handler without redis, like one under test, keeps no keys
+			key := c.Request().Header.Get(idempotencyHeader)
+			if key == "" || c.Request().Method != http.MethodPost || h.Redis == nil {
+				return next(c)
+			}
+			if len(key) > maxIdempotencyKey {
+				return problem.Write(c, http.StatusBadRequest, "Idempotency-Key is too long")
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			defer cancel()
+
+			body, err := io.ReadAll(c.Request().Body)
+			if err != nil {
+				return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
+			}
+			c.Request().Body = io.NopCloser(bytes.NewReader(body))
+
+			hash, err := requestHash(c.Request().Header.Get(echo.HeaderContentType), body)
+			if err != nil {
+				return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
+			}
+
+			// a key belongs to the endpoint it was sent to
+			cacheKey := "idempotency:" + c.Path() + ":" + key
+
+			pending, _ := json.Marshal(idempotentResponse{RequestHash: hash})
+			claimed, err := h.Redis.SetNX(ctx, cacheKey, pending, ttl).Result()
+			if err != nil {
+				log.Println("idempotency:", err)
+				return problem.Write(c, http.StatusServiceUnavailable, "Idempotency-Key can not be checked, try again later")
+			}
+
+			if !claimed {
+				return h.replayIdempotent(c, ctx, cacheKey, hash)
+			}
+
+			recorder := &responseRecorder{ResponseWriter: c.Response().Writer}
+			c.Response().Writer = recorder
+
+			err = next(c)
+			c.Response().Writer = recorder.ResponseWriter
+
+			// failed requests did not write anything, the key can be retried
+			if err != nil || recorder.status == 0 || recorder.status >= http.StatusInternalServerError {
+				if delErr := h.Redis.Del(ctx, cacheKey).Err(); delErr != nil {
+					log.Println("idempotency:", delErr)
+				}
+				return err
+			}
+
+			saved := idempotentResponse{
+				RequestHash: hash,
+				Status:      recorder.status,
+				Header:      map[string]string{},
+				Body:        recorder.body.Bytes(),
+			}
+			for _, h := range idempotentHeaders {
+				if v := c.Response().Header().Get(h); v != "" {
+					saved.Header[h] = v
+				}
+			}
+
+			data, _ := json.Marshal(saved)
+			if err := h.Redis.Set(ctx, cacheKey, data, ttl).Err(); err != nil {
+				log.Println("idempotency:", err)
+			}
+
+			return nil
+		}
+	}
+}
+
+// requestHash fingerprints a request body. The boundary of a multipart body
+// changes on every request, a retried upload is recognised by its parts
+func requestHash(contentType string, body []byte) (string, error) {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") {
+		sum := sha256.Sum256(body)
+		return hex.EncodeToString(sum[:]), nil
+	}
+
+	hash := sha256.New()
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		content, err := io.ReadAll(part)
+		if err != nil {
+			return "", err
+		}
+
+		// every value is prefixed by its length so values can not run into each other
+		for _, v := range [][]byte{[]byte(part.FormName()), []byte(part.FileName()), content} {
+			binary.Write(hash, binary.BigEndian, uint64(len(v)))
+			hash.Write(v)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// replayIdempotent answers a request whose key was already used
+func (h *Handler) replayIdempotent(c echo.Context, ctx context.Context, cacheKey string, hash string) error {
+	data, err := h.Redis.Get(ctx, cacheKey).Bytes()
+	if err != nil {
+		log.Println("idempotency:", err)
+		return problem.Write(c, http.StatusServiceUnavailable, "Idempotency-Key can not be checked, try again later")
+	}
+
+	var saved idempotentResponse
+	if err := json.Unmarshal(data, &saved); err != nil {
+		return problem.Write(c, http.StatusInternalServerError, "Invalid stored response")
+	}
+
+	if saved.RequestHash != hash {
+		return problem.Write(c, http.StatusUnprocessableEntity, "Idempotency-Key was already used with another request body")
+	}
+
+	if saved.Status == 0 {
+		return problem.Write(c, http.StatusConflict, "A request with this Idempotency-Key is still in progress")
+	}
+
+	for h, v := range saved.Header {
+		c.Response().Header().Set(h, v)
+	}
+	c.Response().Header().Set(replayedHeader, "true")
+	c.Response().WriteHeader(saved.Status)
+	_, err = c.Response().Write(saved.Body)
+	return err
+}
@@ -0,0 +1,75 @@
+package controllers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"testing"
+)
+
+// upload is a multipart body with a file and a form field, boundary apart
+func upload(t *testing.T, boundary string, sheet string, file string) (string, []byte) {
+	t.Helper()
+
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.SetBoundary(boundary); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteField("sheet", sheet); err != nil {
+		t.Fatal(err)
+	}
+	part, err := w.CreateFormFile("file", "exports.xlsx")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write([]byte(file))
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return w.FormDataContentType(), body.Bytes()
+}
+
+func TestRequestHash(t *testing.T) {
+	hash := func(contentType string, body []byte) string {
+		t.Helper()
+		h, err := requestHash(contentType, body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return h
+	}
+
+	first := hash(upload(t, "boundary1", "2024", "rows"))
+
+	tests := []struct {
+		name  string
+		sheet string
+		file  string
+		same  bool
+	}{
+		{"retried upload", "2024", "rows", true},
+		{"other file", "2024", "other rows", false},
+		{"other field", "2023", "rows", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := hash(upload(t, "boundary2", tt.sheet, tt.file)); (got == first) != tt.same {
+				t.Errorf("same hash = %v, want %v", got == first, tt.same)
+			}
+		})
+	}
+}
+
+func TestRequestHashJSON(t *testing.T) {
+	a, _ := requestHash("application/json", []byte(`{"a":1}`))
+	b, _ := requestHash("application/json", []byte(`{"a":1}`))
+	c, _ := requestHash("application/json", []byte(`{"a":2}`))
+	if a != b || a == c {
+		t.Errorf("hashes = %s, %s, %s", a, b, c)
+	}
+
+	if _, err := requestHash("multipart/form-data; boundary=x", []byte("not multipart")); err == nil {
+		t.Error("a broken multipart body should fail")
+	}
+}
@@ -0,0 +1,458 @@
+package controllers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cache-api/importer"
+	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/response"
+	"go-cache-api/validation"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// maxImportSize bounds an uploaded file, in bytes
+	maxImportSize = 32 << 20
+	// importBatchSize is how many rows are inserted at once
+	importBatchSize = 1000
+	// importTimeout bounds the validation of a file on a dry run, and of a
+	// batch of rows in a job
+	importTimeout = 2 * time.Minute
+	// duplicateKeyCode is the mongo error code of a duplicate key
+	duplicateKeyCode = 11000
+)
+
+// importedExport is an accepted row waiting to be inserted
+type importedExport struct {
+	// report is the index of the row in the report
+	report int
+	export models.ExportData
+}
+
+// parseDryRun reads ?dryRun=, false when it is not set
+func parseDryRun(c echo.Context) (bool, error) {
+	v := c.QueryParam("dryRun")
+	if v == "" {
+		return false, nil
+	}
+	dryRun, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, errors.New("dryRun should be true or false")
+	}
+	return dryRun, nil
+}
+
+// readUpload reads the file of the multipart form
+func readUpload(c echo.Context) (string, []byte, error) {
+	header, err := c.FormFile("file")
+	if err != nil {
+		return "", nil, errors.New("a .xlsx or .csv file is required in the 'file' field")
+	}
+	if header.Size > maxImportSize {
+		return "", nil, fmt.Errorf("file should not be larger than %d MB", maxImportSize>>20)
+	}
+
+	src, err := header.Open()
+	if err != nil {
+		return "", nil, err
+	}
+	defer src.Close()
+
+	data, err := io.ReadAll(io.LimitReader(src, maxImportSize))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return header.Filename, data, nil
+}
+
+// validateImport checks the records of the file from start to end. It
+// returns the report of the rows and the rows accepted, with their product
+// linked like the exports created by the API before the rules of the model are
+// checked. duplicates are the records repeating the natural key of an earlier
+// one, from importer.Duplicates
+func (h *Handler) validateImport(ctx context.Context, records []importer.Record, start int, end int, duplicates map[int]int) (*response.ImportReport, []importedExport, error) {
+	report := &response.ImportReport{Rows: []response.ImportRow{}}
+
+	candidates := []importedExport{}
+	for i := start; i < end; i++ {
+		record := records[i]
+		report.Rows = append(report.Rows, response.ImportRow{Sheet: record.Sheet, Row: record.Line, Status: "accepted"})
+		index := len(report.Rows) - 1
+
+		export, errs := importer.ParseExport(record)
+		if errs != nil {
+			report.Rows[index].Status = "rejected"
+			report.Rows[index].Errors = errs
+			continue
+		}
+		export.Import = &models.ImportLineage{Sheet: record.Sheet, Row: record.Line, Checksum: record.Checksum}
+
+		if j, ok := duplicates[i]; ok {
+			report.Rows[index].Status = "conflicting"
+			report.Rows[index].Errors = validation.Errors{h.conflictError(recordPosition(records[j]))}
+			report.Conflicting++
+			continue
+		}
+
+		candidates = append(candidates, importedExport{report: index, export: export})
+	}
+
+	exports := make([]models.ExportData, len(candidates))
+	for i, candidate := range candidates {
+		exports[i] = candidate.export
+	}
+
+	linkErrs, err := h.linkProducts(ctx, exports)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rejected := map[int]validation.Errors{}
+	for _, fe := range linkErrs {
+		i := *fe.Index
+		fe.Index = nil
+		rejected[i] = append(rejected[i], fe)
+	}
+
+	accepted := []importedExport{}
+	for i, candidate := range candidates {
+		errs, ok := rejected[i]
+		if !ok {
+			errs = validation.Struct(exports[i])
+		}
+		if errs != nil {
+			report.Rows[candidate.report].Status = "rejected"
+			report.Rows[candidate.report].Errors = errs
+			continue
+		}
+
+		candidate.export = exports[i]
+		accepted = append(accepted, candidate)
+	}
+
+	report.Total = len(report.Rows)
+	report.Accepted = len(accepted)
+	report.Rejected = report.Total - report.Accepted - report.Conflicting
+
+	return report, accepted, nil
+}
+
+// recordPosition tells where a record is in its file, for messages
+func recordPosition(r importer.Record) string {
+	if r.Sheet == "" {
+		return fmt.Sprintf("row %d", r.Line)
+	}
+	return fmt.Sprintf("row %d of sheet %s", r.Line, r.Sheet)
+}
+
+// conflictError rejects a row sharing its natural key with other
+func (h *Handler) conflictError(other string) validation.FieldError {
+	return validation.FieldError{
+		Field:   h.exportKey.String(),
+		Rule:    "unique",
+		Message: fmt.Sprintf("%s are the same as %s", h.exportKey, other),
+	}
+}
+
+// writeImported writes the accepted rows by batch. A row matching an export
+// on the natural key updates it, the others are inserted. A row the database
+// refuses is reported as rejected, the others of its batch are still written.
+// Every written export is tagged with the lineage of its row and kept in the
+// records of the job so the import can be rolled back
+func (h *Handler) writeImported(ctx context.Context, job *models.ImportJob, report *response.ImportReport, accepted []importedExport) error {
+	for start := 0; start < len(accepted); start += importBatchSize {
+		end := start + importBatchSize
+		if end > len(accepted) {
+			end = len(accepted)
+		}
+		batch := accepted[start:end]
+
+		existing, err := h.matchImported(ctx, batch)
+		if err != nil {
+			return err
+		}
+
+		writes := []mongo.WriteModel{}
+		// writeIndex is the row of batch of each write
+		writeIndex := []int{}
+		// updated maps a row of batch to the export it updates
+		updated := map[int]primitive.ObjectID{}
+		updatedIDs := []primitive.ObjectID{}
+		for i, row := range batch {
+			result := &report.Rows[row.report]
+			row.export.Import.BatchID = job.ID
+			row.export.Import.Filename = job.Filename
+
+			export, ok := existing[h.exportKey.Value(row.export)]
+			if !ok {
+				writes = append(writes, mongo.NewInsertOneModel().SetDocument(row.export))
+				writeIndex = append(writeIndex, i)
+				continue
+			}
+
+			result.ID = export.ID.Hex()
+			if sameExport(export, row.export) {
+				result.Status = "unchanged"
+				report.Unchanged++
+				continue
+			}
+
+			writes = append(writes, mongo.NewUpdateOneModel().
+				SetFilter(bson.M{"_id": export.ID}).
+				SetUpdate(importUpdate(export, row.export)))
+			writeIndex = append(writeIndex, i)
+			updated[i] = export.ID
+			updatedIDs = append(updatedIDs, export.ID)
+		}
+		if len(writes) == 0 {
+			continue
+		}
+
+		before, err := h.exportAudit.snapshots(ctx, updatedIDs)
+		if err != nil {
+			return err
+		}
+
+		records := []models.ImportRecord{}
+		for _, i := range writeIndex {
+			records = append(records, h.importRecord(job, batch[i].export, updated[i], before))
+		}
+		if err := h.saveImportRecords(ctx, records); err != nil {
+			return err
+		}
+
+		failed := map[int]mongo.BulkWriteError{}
+		_, err = h.exportCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		if err != nil {
+			var bwe mongo.BulkWriteException
+			if !errors.As(err, &bwe) {
+				return err
+			}
+			for _, we := range bwe.WriteErrors {
+				failed[we.Index] = we
+			}
+		}
+
+		ids := []primitive.ObjectID{}
+		failedIDs := []primitive.ObjectID{}
+		for w, i := range writeIndex {
+			row := batch[i]
+			result := &report.Rows[row.report]
+
+			if we, ok := failed[w]; ok {
+				failedIDs = append(failedIDs, records[w].DocumentID)
+				report.Accepted--
+				if we.Code == duplicateKeyCode {
+					// an export with the same key was written since the batch was matched
+					result.Status = "conflicting"
+					result.Errors = validation.Errors{h.conflictError("an export written during the import")}
+					report.Conflicting++
+				} else {
+					result.Status = "rejected"
+					result.Errors = validation.Errors{{Rule: "insert", Message: we.Message}}
+					report.Rejected++
+				}
+				continue
+			}
+
+			if id, ok := updated[i]; ok {
+				result.Status = "updated"
+				ids = append(ids, id)
+				report.Updated++
+				continue
+			}
+
+			result.Status = "inserted"
+			result.ID = row.export.ID.Hex()
+			ids = append(ids, row.export.ID)
+			report.Inserted++
+		}
+
+		if err := h.discardImportRecords(ctx, job.ID, failedIDs); err != nil {
+			return err
+		}
+
+		h.exportAudit.recordAs(ctx, job.Actor, job.RequestID, "import", before, ids...)
+	}
+
+	return nil
+}
+
+// importRecord is the record of the write of export, updated is the id of
+// the export it updates and is zero for an insert
+func (h *Handler) importRecord(job *models.ImportJob, export models.ExportData, updated primitive.ObjectID, before map[primitive.ObjectID]bson.M) models.ImportRecord {
+	record := models.ImportRecord{
+		ID:         primitive.NewObjectID(),
+		BatchID:    job.ID,
+		Resource:   h.exportAudit.name,
+		DocumentID: export.ID,
+		Action:     "inserted",
+		Source:     *export.Import,
+		WrittenAt:  *export.UpdatedAt,
+		CreatedAt:  time.Now(),
+	}
+	if !updated.IsZero() {
+		record.DocumentID = updated
+		record.Action = "updated"
+		record.Before = before[updated]
+	}
+	return record
+}
+
+// matchImported finds the exports sharing the natural key of the rows of
+// batch, deleted ones included, by the value of their key
+func (h *Handler) matchImported(ctx context.Context, batch []importedExport) (map[string]models.ExportData, error) {
+	filters := []bson.M{}
+	for _, row := range batch {
+		filter, err := h.exportKey.Filter(row.export)
+		if err != nil {
+			return nil, err
+		}
+		filters = append(filters, filter)
+	}
+
+	found := []models.ExportData{}
+	cur, err := h.exportCollection.Find(ctx, bson.M{"$or": filters})
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	existing := map[string]models.ExportData{}
+	for _, export := range found {
+		existing[h.exportKey.Value(export)] = export
+	}
+	return existing, nil
+}
+
+// importMapping is the mapping of the columns of an uploaded file, the
+// 'mapping' form field names a configured mapping or holds one as json.
+// A file is read with the mapping named after resource by default
+func (h *Handler) importMapping(c echo.Context, resource auditResource) (importer.Mapping, error) {
+	v := strings.TrimSpace(c.FormValue("mapping"))
+	if v == "" {
+		v = resource.name
+	}
+
+	if strings.HasPrefix(v, "{") {
+		var m importer.Mapping
+		if err := json.Unmarshal([]byte(v), &m); err != nil {
+			return importer.Mapping{}, fmt.Errorf("mapping should be a json mapping: %v", err)
+		}
+		if err := m.Check(); err != nil {
+			return importer.Mapping{}, fmt.Errorf("invalid mapping: %v", err)
+		}
+		return m, nil
+	}
+
+	m, ok := h.importMappings[v]
+	if !ok {
+		return importer.Mapping{}, fmt.Errorf("there is no mapping named %s", v)
+	}
+	return m, nil
+}
+
+// importUpload is an uploaded file read with its mapping
+type importUpload struct {
+	dryRun   bool
+	filename string
+	data     []byte
+	mapping  importer.Mapping
+	records  []importer.Record
+}
+
+// readImport reads the uploaded file of an import into resource. It returns
+// nil once it has written the problem of a bad request
+func (h *Handler) readImport(c echo.Context, resource auditResource) (*importUpload, error) {
+	dryRun, err := parseDryRun(c)
+	if err != nil {
+		return nil, problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	filename, data, err := readUpload(c)
+	if err != nil {
+		return nil, problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	mapping, err := h.importMapping(c, resource)
+	if err != nil {
+		return nil, problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	sheets, err := importer.Read(filename, data)
+	if err == importer.ErrUnsupportedFile {
+		return nil, problem.Write(c, http.StatusUnsupportedMediaType, err.Error())
+	}
+	if err != nil {
+		return nil, problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	records, err := mapping.Records(sheets)
+	if err != nil {
+		return nil, problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	return &importUpload{dryRun: dryRun, filename: filename, data: data, mapping: mapping, records: records}, nil
+}
+
+// ImportExports validates every row of an uploaded .xlsx or .csv of exports,
+// its columns are found through the mapping of the request.
+// With ?dryRun=true nothing is written, the report tells which rows would be
+// accepted. Otherwise the file is imported by a background job, polled with GET /imports/:jobId
+func (h *Handler) ImportExports(c echo.Context) error {
+	upload, err := h.readImport(c, h.exportAudit)
+	if upload == nil {
+		return err
+	}
+
+	if !upload.dryRun {
+		return h.queueImport(c, h.exportAudit, upload.filename, upload.data, upload.mapping, len(upload.records))
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+
+	records := upload.records
+	report, _, err := h.validateImport(ctx, records, 0, len(records), importer.Duplicates(h.exportKey, records))
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find the products of exports")
+	}
+	report.DryRun = true
+
+	return c.JSON(http.StatusOK, report)
+}
+
+// ImportProducts is ImportExports for a file of products, every accepted row
+// is inserted as a new product
+func (h *Handler) ImportProducts(c echo.Context) error {
+	upload, err := h.readImport(c, h.productAudit)
+	if upload == nil {
+		return err
+	}
+
+	if !upload.dryRun {
+		return h.queueImport(c, h.productAudit, upload.filename, upload.data, upload.mapping, len(upload.records))
+	}
+
+	report, _ := validateProductImport(upload.records, 0, len(upload.records))
+	report.DryRun = true
+
+	return c.JSON(http.StatusOK, report)
+}
@@ -0,0 +1,468 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"time"
+
+	"go-cache-api/importer"
+	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/response"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// status of an import job
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobCompleted = "completed"
+	jobFailed    = "failed"
+	jobCancelled = "cancelled"
+)
+
+const (
+	// maxJobErrors bounds the rejected rows kept in a job document
+	maxJobErrors = 1000
+	// jobPollInterval is how often the worker looks for queued jobs it was not told about
+	jobPollInterval = 5 * time.Second
+	// jobLease is how long a running job stays with its server without a
+	// heartbeat, a job whose lease ran out is queued again
+	jobLease = time.Minute
+	// jobHeartbeat is how often a running job renews its lease
+	jobHeartbeat = jobLease / 3
+)
+
+// newJobOwner names a server running import jobs, apart from the other
+// servers sharing the database and the earlier runs of this one
+func newJobOwner() string {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return fmt.Sprintf("%s-%d-%s", host, os.Getpid(), primitive.NewObjectID().Hex())
+}
+
+// importFiles keeps the uploaded files of the jobs in GridFS
+func (h *Handler) importFiles() (*gridfs.Bucket, error) {
+	return gridfs.NewBucket(h.importJobCollection.Database(), options.GridFSBucket().SetName("importFiles"))
+}
+
+// queueImport stores the file and queues its job importing into resource,
+// the client polls the job at the Location of the 202 response
+func (h *Handler) queueImport(c echo.Context, resource auditResource, filename string, data []byte, mapping importer.Mapping, totalRows int) error {
+	rawMapping, err := bson.Marshal(mapping)
+	if err != nil {
+		return err
+	}
+
+	bucket, err := h.importFiles()
+	if err != nil {
+		return problem.Mongo(c, err, "Can not store the file")
+	}
+
+	fileID, err := bucket.UploadFromStream(filename, bytes.NewReader(data))
+	if err != nil {
+		return problem.Mongo(c, err, "Can not store the file")
+	}
+
+	actor, requestID := requestActor(c)
+	now := time.Now()
+	job := models.ImportJob{
+		ID:        primitive.NewObjectID(),
+		Resource:  resource.name,
+		Filename:  filename,
+		FileID:    fileID,
+		Mapping:   rawMapping,
+		Status:    jobQueued,
+		TotalRows: totalRows,
+		Errors:    []models.ImportRowError{},
+		Actor:     actor,
+		RequestID: requestID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if _, err := h.importJobCollection.InsertOne(ctx, job); err != nil {
+		return problem.Mongo(c, err, "Can not queue the import")
+	}
+
+	select {
+	case h.importWake <- struct{}{}:
+	default:
+	}
+
+	c.Response().Header().Set(echo.HeaderLocation, "/imports/"+job.ID.Hex())
+	return c.JSON(http.StatusAccepted, job)
+}
+
+// StartImportJobs runs the queued import jobs one after the other until ctx
+// is done. The jobs of a server that stopped renewing their lease are queued
+// again and resume after their last processed batch, the ones another server
+// is still running are left to it
+func (h *Handler) StartImportJobs(ctx context.Context) error {
+	if err := h.requeueExpired(ctx); err != nil {
+		return err
+	}
+
+	h.jobs.Add(1)
+	go func() {
+		defer h.jobs.Done()
+
+		ticker := time.NewTicker(jobPollInterval)
+		defer ticker.Stop()
+
+		for {
+			if err := h.requeueExpired(ctx); err != nil && ctx.Err() == nil {
+				log.Println("import jobs:", err)
+			}
+			for h.runNextImport(ctx) {
+			}
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-h.importWake:
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	return nil
+}
+
+// requeueExpired queues again the running jobs whose lease ran out. Jobs
+// started before leases were kept have none, they are queued again as well
+func (h *Handler) requeueExpired(ctx context.Context) error {
+	now := time.Now()
+	_, err := h.importJobCollection.UpdateMany(ctx,
+		bson.M{"status": jobRunning, "$or": bson.A{
+			bson.M{"leaseUntil": bson.M{"$lt": now}},
+			bson.M{"leaseUntil": bson.M{"$exists": false}},
+		}},
+		bson.M{"$set": bson.M{"status": jobQueued, "updatedAt": now}, "$unset": bson.M{"owner": "", "leaseUntil": ""}})
+	return err
+}
+
+// keepLease renews the lease of the job id every jobHeartbeat until the
+// returned func is called. The returned context is cancelled once the lease
+// is lost, the job was then queued again and another server may run it
+func (h *Handler) keepLease(ctx context.Context, id primitive.ObjectID) (context.Context, func()) {
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+
+	go func() {
+		defer close(stopped)
+
+		ticker := time.NewTicker(jobHeartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-runCtx.Done():
+				return
+			case <-ticker.C:
+			}
+
+			res, err := h.importJobCollection.UpdateOne(runCtx,
+				bson.M{"_id": id, "status": jobRunning, "owner": h.jobOwner},
+				bson.M{"$set": bson.M{"leaseUntil": time.Now().Add(jobLease)}})
+			if err != nil {
+				// the lease is renewed on the next beat, or lost once it ran out
+				log.Printf("import job %s: %v", id.Hex(), err)
+				continue
+			}
+			if res.MatchedCount == 0 {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return runCtx, func() {
+		close(done)
+		<-stopped
+		cancel()
+	}
+}
+
+// runNextImport claims the oldest queued job and runs it, it reports whether
+// there was one
+func (h *Handler) runNextImport(ctx context.Context) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+
+	now := time.Now()
+	var job models.ImportJob
+	err := h.importJobCollection.FindOneAndUpdate(ctx,
+		bson.M{"status": jobQueued},
+		// $min keeps the start of a resumed job
+		bson.M{
+			"$set": bson.M{"status": jobRunning, "owner": h.jobOwner, "leaseUntil": now.Add(jobLease), "updatedAt": now},
+			"$min": bson.M{"startedAt": now},
+		},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "createdAt", Value: 1}}).SetReturnDocument(options.After),
+	).Decode(&job)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return false
+	}
+	if err != nil {
+		log.Println("import jobs:", err)
+		return false
+	}
+
+	runCtx, stop := h.keepLease(ctx, job.ID)
+	status, err := h.runImport(runCtx, &job)
+	stop()
+	if ctx.Err() != nil {
+		// the server is stopping, the job is queued again for the next one
+		h.releaseJob(job.ID)
+		return false
+	}
+	if runCtx.Err() != nil {
+		log.Printf("import job %s: lost its lease, it is left to the server running it now", job.ID.Hex())
+		return true
+	}
+
+	finish := bson.M{"status": status, "finishedAt": time.Now(), "updatedAt": time.Now()}
+	if err != nil {
+		log.Printf("import job %s: %v", job.ID.Hex(), err)
+		finish["error"] = err.Error()
+	}
+	res, err := h.importJobCollection.UpdateOne(context.Background(),
+		bson.M{"_id": job.ID, "owner": h.jobOwner},
+		bson.M{"$set": finish, "$unset": bson.M{"leaseUntil": ""}})
+	if err != nil {
+		log.Printf("import job %s: %v", job.ID.Hex(), err)
+	}
+	if err == nil && res.MatchedCount == 0 {
+		// another server took the job over, its file is still needed
+		return true
+	}
+
+	if bucket, err := h.importFiles(); err == nil {
+		if err := bucket.Delete(job.FileID); err != nil {
+			log.Printf("import job %s: %v", job.ID.Hex(), err)
+		}
+	}
+
+	return true
+}
+
+// releaseJob queues again a job this server stops running before the end,
+// it resumes after its last processed batch without waiting for its lease
+func (h *Handler) releaseJob(id primitive.ObjectID) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := h.importJobCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": jobRunning, "owner": h.jobOwner},
+		bson.M{"$set": bson.M{"status": jobQueued, "updatedAt": time.Now()}, "$unset": bson.M{"owner": "", "leaseUntil": ""}})
+	if err != nil {
+		log.Printf("import job %s: %v", id.Hex(), err)
+	}
+}
+
+// runImport imports the rows of job from the first one not processed yet.
+// Progress is saved after each batch, a cancel request is honored between batches
+func (h *Handler) runImport(ctx context.Context, job *models.ImportJob) (string, error) {
+	if job.CancelRequested {
+		return jobCancelled, nil
+	}
+
+	bucket, err := h.importFiles()
+	if err != nil {
+		return jobFailed, err
+	}
+
+	var file bytes.Buffer
+	if _, err := bucket.DownloadToStream(job.FileID, &file); err != nil {
+		return jobFailed, fmt.Errorf("can not read the uploaded file: %v", err)
+	}
+
+	// jobs queued before mappings were stored read the mapping of their resource
+	mapping := h.importMappings[h.importResource(job).name]
+	if len(job.Mapping) > 0 {
+		mapping = importer.Mapping{}
+		if err := bson.Unmarshal(job.Mapping, &mapping); err != nil {
+			return jobFailed, err
+		}
+	}
+
+	sheets, err := importer.Read(job.Filename, file.Bytes())
+	if err != nil {
+		return jobFailed, err
+	}
+	records, err := mapping.Records(sheets)
+	if err != nil {
+		return jobFailed, err
+	}
+	// only exports have a natural key, rows of other resources never conflict
+	duplicates := map[int]int{}
+	if job.Resource != h.productAudit.name {
+		duplicates = importer.Duplicates(h.exportKey, records)
+	}
+
+	for start := job.Processed; start < len(records); start += importBatchSize {
+		if ctx.Err() != nil {
+			// the server is stopping, the job resumes at start on the next one
+			return jobFailed, ctx.Err()
+		}
+
+		end := start + importBatchSize
+		if end > len(records) {
+			end = len(records)
+		}
+
+		if err := h.importBatch(ctx, job, records, start, end, duplicates); err != nil {
+			return jobFailed, err
+		}
+
+		if job.CancelRequested {
+			return jobCancelled, nil
+		}
+	}
+
+	return jobCompleted, nil
+}
+
+// importBatch validates and writes the records from start to end, then saves
+// the progress of job. A batch run again after a stop finds its rows already
+// written, they count as unchanged
+func (h *Handler) importBatch(ctx context.Context, job *models.ImportJob, records []importer.Record, start int, end int, duplicates map[int]int) error {
+	// a batch is finished when the server stops, so its rows and the progress
+	// of job are written together
+	batchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), importTimeout)
+	defer cancel()
+
+	var report *response.ImportReport
+	if job.Resource == h.productAudit.name {
+		var accepted []importedProduct
+		report, accepted = validateProductImport(records, start, end)
+		if err := h.writeImportedProducts(batchCtx, job, report, accepted); err != nil {
+			return err
+		}
+	} else {
+		var accepted []importedExport
+		var err error
+		report, accepted, err = h.validateImport(batchCtx, records, start, end, duplicates)
+		if err != nil {
+			return err
+		}
+		if err := h.writeImported(batchCtx, job, report, accepted); err != nil {
+			return err
+		}
+	}
+
+	rejected := []models.ImportRowError{}
+	for _, row := range report.Rows {
+		if row.Status == "rejected" || row.Status == "conflicting" {
+			rejected = append(rejected, models.ImportRowError{Sheet: row.Sheet, Row: row.Row, Errors: row.Errors})
+		}
+	}
+
+	// a job that lost its lease leaves its progress to the server running it now
+	return h.importJobCollection.FindOneAndUpdate(batchCtx,
+		bson.M{"_id": job.ID, "owner": h.jobOwner},
+		bson.M{
+			"$set": bson.M{"processed": end, "updatedAt": time.Now()},
+			"$inc": bson.M{
+				"inserted":    report.Inserted,
+				"updated":     report.Updated,
+				"unchanged":   report.Unchanged,
+				"conflicting": report.Conflicting,
+				"failed":      report.Rejected,
+			},
+			"$push": bson.M{"errors": bson.M{"$each": rejected, "$slice": maxJobErrors}},
+		},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(job)
+}
+
+// importResource is the resource job imports into, jobs queued before
+// products could be imported hold exports
+func (h *Handler) importResource(job *models.ImportJob) auditResource {
+	if job.Resource == h.productAudit.name {
+		return h.productAudit
+	}
+	return h.exportAudit
+}
+
+// GetImportJob returns an import job and its progress
+func (h *Handler) GetImportJob(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := h.findImportJob(ctx, c)
+	if job == nil {
+		return err
+	}
+
+	return c.JSON(http.StatusOK, job)
+}
+
+// CancelImportJob cancels a queued job right away and a running one after
+// its current batch, the rows already inserted stay
+func (h *Handler) CancelImportJob(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	jobId, err := primitive.ObjectIDFromHex(c.Param("jobId"))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid job id")
+	}
+
+	now := time.Now()
+	var job models.ImportJob
+	err = h.importJobCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": jobId, "status": jobQueued},
+		bson.M{"$set": bson.M{"status": jobCancelled, "cancelRequested": true, "finishedAt": now, "updatedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	if err == nil {
+		if bucket, err := h.importFiles(); err == nil {
+			if err := bucket.Delete(job.FileID); err != nil {
+				log.Printf("import job %s: %v", job.ID.Hex(), err)
+			}
+		}
+		return c.JSON(http.StatusOK, job)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return problem.Mongo(c, err, "Failed to cancel the import")
+	}
+
+	err = h.importJobCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": jobId, "status": jobRunning},
+		bson.M{"$set": bson.M{"cancelRequested": true, "updatedAt": now}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&job)
+	if err == nil {
+		return c.JSON(http.StatusAccepted, job)
+	}
+	if !errors.Is(err, mongo.ErrNoDocuments) {
+		return problem.Mongo(c, err, "Failed to cancel the import")
+	}
+
+	if err := h.importJobCollection.FindOne(ctx, bson.M{"_id": jobId}).Decode(&job); err != nil {
+		return problem.Mongo(c, err, "Import job not found")
+	}
+	return problem.Write(c, http.StatusConflict, "Import job is already "+job.Status)
+}
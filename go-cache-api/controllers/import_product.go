@@ -0,0 +1,180 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"go-cache-api/importer"
+	"go-cache-api/models"
+	"go-cache-api/response"
+	"go-cache-api/validation"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// importedProduct is an accepted row waiting to be inserted
+type importedProduct struct {
+	// report is the index of the row in the report
+	report  int
+	product models.Product
+}
+
+// validateProductImport checks the records of a products file from start to
+// end, as validateImport. Products have no natural key, every accepted row is
+// a new product
+func validateProductImport(records []importer.Record, start int, end int) (*response.ImportReport, []importedProduct) {
+	report := &response.ImportReport{Rows: []response.ImportRow{}}
+
+	accepted := []importedProduct{}
+	for i := start; i < end; i++ {
+		record := records[i]
+		report.Rows = append(report.Rows, response.ImportRow{Sheet: record.Sheet, Row: record.Line, Status: "accepted"})
+		index := len(report.Rows) - 1
+
+		product, errs := importer.ParseProduct(record)
+		if errs == nil {
+			errs = validation.Struct(product)
+		}
+		if errs != nil {
+			report.Rows[index].Status = "rejected"
+			report.Rows[index].Errors = errs
+			continue
+		}
+		product.Import = &models.ImportLineage{Sheet: record.Sheet, Row: record.Line, Checksum: record.Checksum}
+
+		accepted = append(accepted, importedProduct{report: index, product: product})
+	}
+
+	report.Total = len(report.Rows)
+	report.Accepted = len(accepted)
+	report.Rejected = report.Total - report.Accepted
+
+	return report, accepted
+}
+
+// writeImportedProducts inserts the accepted rows of a batch. A row an
+// interrupted run of job already inserted is found by its lineage and counts
+// as unchanged. A row the database refuses is reported as rejected, the
+// others of its batch are still written
+func (h *Handler) writeImportedProducts(ctx context.Context, job *models.ImportJob, report *response.ImportReport, accepted []importedProduct) error {
+	existing, err := h.matchImportedProducts(ctx, job.ID, accepted)
+	if err != nil {
+		return err
+	}
+
+	docs := []interface{}{}
+	// writeIndex is the row of accepted of each document
+	writeIndex := []int{}
+	records := []models.ImportRecord{}
+	for i, row := range accepted {
+		result := &report.Rows[row.report]
+
+		if id, ok := existing[lineageKey(*row.product.Import)]; ok {
+			result.Status = "unchanged"
+			result.ID = id.Hex()
+			report.Unchanged++
+			continue
+		}
+
+		row.product.Import.BatchID = job.ID
+		row.product.Import.Filename = job.Filename
+		docs = append(docs, row.product)
+		writeIndex = append(writeIndex, i)
+		records = append(records, models.ImportRecord{
+			ID:         primitive.NewObjectID(),
+			BatchID:    job.ID,
+			Resource:   h.productAudit.name,
+			DocumentID: row.product.ID,
+			Action:     "inserted",
+			Source:     *row.product.Import,
+			WrittenAt:  *row.product.UpdatedAt,
+			CreatedAt:  time.Now(),
+		})
+	}
+	if len(docs) == 0 {
+		return nil
+	}
+
+	if err := h.saveImportRecords(ctx, records); err != nil {
+		return err
+	}
+
+	failed := map[int]mongo.BulkWriteError{}
+	_, err = h.productCollection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		var bwe mongo.BulkWriteException
+		if !errors.As(err, &bwe) {
+			return err
+		}
+		for _, we := range bwe.WriteErrors {
+			failed[we.Index] = we
+		}
+	}
+
+	ids := []primitive.ObjectID{}
+	failedIDs := []primitive.ObjectID{}
+	for w, i := range writeIndex {
+		row := accepted[i]
+		result := &report.Rows[row.report]
+
+		if we, ok := failed[w]; ok {
+			failedIDs = append(failedIDs, row.product.ID)
+			result.Status = "rejected"
+			result.Errors = validation.Errors{{Rule: "insert", Message: we.Message}}
+			report.Accepted--
+			report.Rejected++
+			continue
+		}
+
+		result.Status = "inserted"
+		result.ID = row.product.ID.Hex()
+		ids = append(ids, row.product.ID)
+		report.Inserted++
+	}
+
+	if err := h.discardImportRecords(ctx, job.ID, failedIDs); err != nil {
+		return err
+	}
+
+	h.productAudit.recordAs(ctx, job.Actor, job.RequestID, "import", nil, ids...)
+	return nil
+}
+
+// matchImportedProducts finds the products batchID already inserted for the
+// rows of accepted, by the key of their lineage
+func (h *Handler) matchImportedProducts(ctx context.Context, batchID primitive.ObjectID, accepted []importedProduct) (map[string]primitive.ObjectID, error) {
+	existing := map[string]primitive.ObjectID{}
+	if len(accepted) == 0 {
+		return existing, nil
+	}
+
+	rows := []int{}
+	for _, row := range accepted {
+		rows = append(rows, row.product.Import.Row)
+	}
+
+	found := []models.Product{}
+	cur, err := h.productCollection.Find(ctx, bson.M{"import.batchId": batchID, "import.row": bson.M{"$in": rows}})
+	if err != nil {
+		return nil, err
+	}
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	for _, product := range found {
+		existing[lineageKey(*product.Import)] = product.ID
+	}
+	return existing, nil
+}
+
+// lineageKey tells the rows of a file apart, a row has the same key in every
+// run of its job
+func lineageKey(l models.ImportLineage) string {
+	return fmt.Sprintf("%s\x00%d", l.Sheet, l.Row)
+}
@@ -0,0 +1,42 @@
+package controllers
+
+import (
+	"testing"
+
+	"go-cache-api/importer"
+)
+
+func TestValidateProductImport(t *testing.T) {
+	sheets := []importer.Sheet{{Name: "products", Rows: [][]string{
+		{"ชื่อสินค้า", "หมวดหมู่", "มูลค่า (บาท)", "มูลค่า (ดอลลาร์)", "ขนาดธุรกิจ"},
+		{"Rice", "Food", "1000", "30", "Small"},
+		{"Tea", "Drink", "", "", "Micro"},
+		{"", "Food", "10", "1", "Small"},
+		{"Sugar", "Food", "many", "1", "Small"},
+	}}}
+
+	records, err := importer.DefaultMappings()["products"].Records(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, accepted := validateProductImport(records, 0, len(records))
+	if report.Total != 4 || report.Accepted != 2 || report.Rejected != 2 {
+		t.Fatalf("report = %d total, %d accepted, %d rejected, want 4, 2, 2", report.Total, report.Accepted, report.Rejected)
+	}
+
+	want := []string{"accepted", "accepted", "rejected", "rejected"}
+	for i, row := range report.Rows {
+		if row.Status != want[i] {
+			t.Errorf("row %d status = %s, want %s: %v", row.Row, row.Status, want[i], row.Errors)
+		}
+	}
+
+	tea := accepted[1].product
+	if tea.ProductName != "Tea" || tea.ValueTHB != 0 || tea.BusinessSize != "Micro" {
+		t.Errorf("tea = %+v", tea)
+	}
+	if tea.Import == nil || tea.Import.Sheet != "products" || tea.Import.Row != 3 || tea.Import.Checksum == "" {
+		t.Errorf("lineage = %+v, want row 3 of sheet products", tea.Import)
+	}
+}
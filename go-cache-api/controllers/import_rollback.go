@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"go-cache-api/models"
+	"go-cache-api/problem"
+	"go-cache-api/repository"
+	"go-cache-api/response"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// importField holds the lineage of an imported document, only imports write it
+const importField = "import"
+
+// jobRolledBack is the status of an import job whose batch was rolled back
+const jobRolledBack = "rolledBack"
+
+// rollbackBatchSize is how many records of a batch are rolled back at once
+const rollbackBatchSize = 500
+
+// saveImportRecords keeps the records of a batch before its documents are
+// written. A record already kept by an interrupted run of the job keeps the
+// document it overwrote first, only the time of the new write is updated
+func (h *Handler) saveImportRecords(ctx context.Context, records []models.ImportRecord) error {
+	if len(records) == 0 {
+		return nil
+	}
+
+	writes := []mongo.WriteModel{}
+	for _, record := range records {
+		values, err := toBsonM(record)
+		if err != nil {
+			return err
+		}
+		delete(values, "writtenAt")
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"batchId": record.BatchID, "documentId": record.DocumentID}).
+			SetUpdate(bson.M{"$setOnInsert": values, "$set": bson.M{"writtenAt": record.WrittenAt}}).
+			SetUpsert(true))
+	}
+
+	_, err := h.importRecordCollection.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+	return err
+}
+
+// discardImportRecords drops the records of the writes that failed
+func (h *Handler) discardImportRecords(ctx context.Context, batchID primitive.ObjectID, ids []primitive.ObjectID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	_, err := h.importRecordCollection.DeleteMany(ctx, bson.M{"batchId": batchID, "documentId": bson.M{"$in": ids}})
+	return err
+}
+
+// findImportJob loads the job of the :jobId param, the id of a job is the id
+// of its import batch
+func (h *Handler) findImportJob(ctx context.Context, c echo.Context) (*models.ImportJob, error) {
+	jobId, err := primitive.ObjectIDFromHex(c.Param("jobId"))
+	if err != nil {
+		return nil, problem.Write(c, http.StatusBadRequest, "Invalid job id")
+	}
+
+	var job models.ImportJob
+	if err := h.importJobCollection.FindOne(ctx, bson.M{"_id": jobId}).Decode(&job); err != nil {
+		return nil, problem.Mongo(c, err, "Import job not found")
+	}
+	return &job, nil
+}
+
+// GetImportRecords returns a page of the documents an import batch inserted
+// or updated, in the order they were written
+func (h *Handler) GetImportRecords(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	job, err := h.findImportJob(ctx, c)
+	if job == nil {
+		return err
+	}
+
+	p, err := parsePagination(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	query := p.query(bson.M{"batchId": job.ID})
+	query.Sort = bson.D{{Key: "_id", Value: 1}}
+
+	records := []models.ImportRecord{}
+	total, err := findPage(ctx, repository.NewMongo[models.ImportRecord](h.importRecordCollection), query, &records)
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find import records")
+	}
+
+	for _, record := range records {
+		renameID(record.Before)
+	}
+
+	page := newPage(c, records, total, p)
+	setLinkHeader(c, page.Links)
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// RollbackImport undoes an import batch. The documents it inserted are deleted
+// and the ones it updated get back the values it overwrote. A document changed
+// since the import is left as it is and reported as skipped, a rollback
+// stopped by an error resumes with the records not rolled back yet
+func (h *Handler) RollbackImport(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), importTimeout)
+	defer cancel()
+
+	job, err := h.findImportJob(ctx, c)
+	if job == nil {
+		return err
+	}
+
+	switch job.Status {
+	case jobQueued, jobRunning:
+		return problem.Write(c, http.StatusConflict, "Import job is still "+job.Status+", cancel it first")
+	case jobRolledBack:
+		return problem.Write(c, http.StatusConflict, "Import job is already "+job.Status)
+	}
+
+	result := response.ImportRollback{BatchID: job.ID.Hex(), Skipped: []response.ImportRollbackSkip{}}
+
+	for {
+		records := []models.ImportRecord{}
+		opts := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(rollbackBatchSize)
+		cur, err := h.importRecordCollection.Find(ctx, bson.M{"batchId": job.ID, "rollback": bson.M{"$exists": false}}, opts)
+		if err == nil {
+			err = cur.All(ctx, &records)
+		}
+		if err != nil {
+			return problem.Mongo(c, err, "Can not find import records")
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		if err := h.rollbackRecords(ctx, c, h.importResource(job), records, &result); err != nil {
+			return problem.Mongo(c, err, "Failed to roll back the import")
+		}
+	}
+
+	now := time.Now()
+	_, err = h.importJobCollection.UpdateByID(ctx, job.ID, bson.M{"$set": bson.M{"status": jobRolledBack, "rolledBackAt": now, "updatedAt": now}})
+	if err != nil {
+		return problem.Mongo(c, err, "Failed to roll back the import")
+	}
+
+	return c.JSON(http.StatusOK, result)
+}
+
+// rollbackRecords rolls back records of documents of r and marks them done.
+// Only a document the import left as it is matches its filter
+func (h *Handler) rollbackRecords(ctx context.Context, c echo.Context, r auditResource, records []models.ImportRecord, result *response.ImportRollback) error {
+	ids := []primitive.ObjectID{}
+	for _, record := range records {
+		ids = append(ids, record.DocumentID)
+	}
+	before := r.before(ctx, ids...)
+
+	now := time.Now()
+	marks := []mongo.WriteModel{}
+	rolledBack := []primitive.ObjectID{}
+	for _, record := range records {
+		filter := bson.M{"_id": record.DocumentID, "updatedAt": record.WrittenAt}
+
+		var matched int64
+		if record.Action == "inserted" {
+			res, err := r.collection.DeleteOne(ctx, filter)
+			if err != nil {
+				return err
+			}
+			matched = res.DeletedCount
+		} else {
+			res, err := r.collection.ReplaceOne(ctx, filter, record.Before)
+			if err != nil {
+				return err
+			}
+			matched = res.MatchedCount
+		}
+
+		mark := bson.M{"rollback": "rolledBack", "rolledBackAt": now}
+		if matched == 0 {
+			reason := "the document was changed after the import"
+			if before[record.DocumentID] == nil {
+				reason = "the document no longer exists"
+			}
+			mark = bson.M{"rollback": "skipped", "rollbackReason": reason, "rolledBackAt": now}
+
+			result.Skipped = append(result.Skipped, response.ImportRollbackSkip{
+				DocumentID: record.DocumentID.Hex(),
+				Sheet:      record.Source.Sheet,
+				Row:        record.Source.Row,
+				Reason:     reason,
+			})
+		} else {
+			rolledBack = append(rolledBack, record.DocumentID)
+			result.RolledBack++
+		}
+
+		marks = append(marks, mongo.NewUpdateOneModel().SetFilter(bson.M{"_id": record.ID}).SetUpdate(bson.M{"$set": mark}))
+	}
+
+	if _, err := h.importRecordCollection.BulkWrite(ctx, marks); err != nil {
+		return err
+	}
+
+	r.record(ctx, c, "rollback", before, rolledBack...)
+	return nil
+}
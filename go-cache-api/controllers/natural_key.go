@@ -0,0 +1,52 @@
+package controllers
+
+import (
+	"reflect"
+
+	"go-cache-api/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// sameExport reports whether an imported row would leave export as it is. A
+// row without a product keeps the product of the export
+func sameExport(export models.ExportData, row models.ExportData) bool {
+	if row.ProductId != nil && !reflect.DeepEqual(export.ProductId, row.ProductId) {
+		return false
+	}
+	return export.DeletedAt == nil &&
+		export.ProductName == row.ProductName &&
+		export.Category == row.Category &&
+		export.ValueTHB == row.ValueTHB &&
+		export.ValueUSD == row.ValueUSD &&
+		export.BusinessSize == row.BusinessSize &&
+		export.Country == row.Country &&
+		export.Month == row.Month &&
+		export.Year == row.Year
+}
+
+// importUpdate writes the fields of an imported row over the export it
+// matches, a row matching a deleted export restores it
+func importUpdate(export models.ExportData, row models.ExportData) bson.M {
+	set := bson.M{
+		"productName":  row.ProductName,
+		"category":     row.Category,
+		"valueTHB":     row.ValueTHB,
+		"valueUSD":     row.ValueUSD,
+		"businessSize": row.BusinessSize,
+		"country":      row.Country,
+		"month":        row.Month,
+		"year":         row.Year,
+		"updatedAt":    row.UpdatedAt,
+		importField:    row.Import,
+	}
+	if row.ProductId != nil {
+		set["productId"] = row.ProductId
+	}
+
+	update := bson.M{"$set": set}
+	if export.DeletedAt != nil {
+		update["$unset"] = bson.M{deletedAtField: ""}
+	}
+	return update
+}
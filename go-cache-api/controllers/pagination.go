@@ -0,0 +1,168 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"go-cache-api/repository"
+	"go-cache-api/response"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	limitDefault = 10
+	limitMax     = 1000
+)
+
+type pagination struct {
+	Limit  int
+	Offset int
+	// Cursor is set when the client paginates with ?cursor=, it replaces the offset
+	Cursor *keysetCursor
+	// usePage is true when the client paginates with ?page= instead of ?offset=,
+	// links are then generated in the same style
+	usePage bool
+}
+
+// parsePagination reads limit and either page or offset from the query string
+func parsePagination(c echo.Context) (pagination, error) {
+	var err error
+	p := pagination{Limit: limitDefault}
+
+	if c.QueryParam("limit") != "" {
+		p.Limit, err = strconv.Atoi(c.QueryParam("limit"))
+		if err != nil {
+			return p, errors.New("Invalid type limit!")
+		}
+		if p.Limit < 1 || p.Limit > limitMax {
+			return p, fmt.Errorf("limit should be between 1 and %d", limitMax)
+		}
+	}
+
+	if c.QueryParam("cursor") != "" {
+		if c.QueryParam("page") != "" || c.QueryParam("offset") != "" {
+			return p, errors.New("cursor can not be combined with page or offset")
+		}
+		p.Cursor, err = decodeCursor(c.QueryParam("cursor"))
+		if err != nil {
+			return p, err
+		}
+	} else if c.QueryParam("page") != "" {
+		page, err := strconv.Atoi(c.QueryParam("page"))
+		if err != nil {
+			return p, errors.New("Invalid type page!")
+		}
+		if page > 0 {
+			p.Offset = (page - 1) * p.Limit
+		}
+		p.usePage = true
+	} else if c.QueryParam("offset") != "" {
+		p.Offset, err = strconv.Atoi(c.QueryParam("offset"))
+		if err != nil {
+			return p, errors.New("Invalid type offset!")
+		}
+		if p.Offset < 0 {
+			return p, errors.New("offset should not be negative")
+		}
+	}
+
+	return p, nil
+}
+
+// query is the requested page of the documents matching filter
+func (p pagination) query(filter bson.M) repository.Query {
+	return repository.Query{Filter: filter, Limit: int64(p.Limit), Skip: int64(p.Offset)}
+}
+
+// pageReader is what a page is read from, the repositories are one
+type pageReader interface {
+	Find(ctx context.Context, q repository.Query, results interface{}) error
+	Count(ctx context.Context, filter bson.M) (int64, error)
+}
+
+// findPage decodes the page of q into results and returns the number of
+// documents matched by its filter
+func findPage(ctx context.Context, documents pageReader, q repository.Query, results interface{}) (int64, error) {
+	if err := documents.Find(ctx, q, results); err != nil {
+		return 0, err
+	}
+
+	return documents.Count(ctx, q.Filter)
+}
+
+// newPage wraps items in the page envelope and builds its navigation links
+func newPage(c echo.Context, items interface{}, total int64, p pagination) *response.Page {
+	page := &response.Page{
+		Items:  items,
+		Total:  total,
+		Limit:  p.Limit,
+		Offset: p.Offset,
+		Page:   p.Offset/p.Limit + 1,
+	}
+
+	lastOffset := 0
+	if total > 0 {
+		lastOffset = int((total-1)/int64(p.Limit)) * p.Limit
+	}
+
+	page.Links.Self = pageLink(c, p, p.Offset)
+	page.Links.First = pageLink(c, p, 0)
+	page.Links.Last = pageLink(c, p, lastOffset)
+
+	if int64(p.Offset+p.Limit) < total {
+		page.Links.Next = pageLink(c, p, p.Offset+p.Limit)
+	}
+
+	if p.Offset > 0 {
+		prev := p.Offset - p.Limit
+		if prev < 0 {
+			prev = 0
+		}
+		page.Links.Prev = pageLink(c, p, prev)
+	}
+
+	return page
+}
+
+// pageLink returns the current request URL moved to offset
+func pageLink(c echo.Context, p pagination, offset int) string {
+	q := url.Values{}
+	for k, v := range c.QueryParams() {
+		q[k] = append([]string(nil), v...)
+	}
+
+	q.Set("limit", strconv.Itoa(p.Limit))
+	if p.usePage {
+		q.Del("offset")
+		q.Set("page", strconv.Itoa(offset/p.Limit+1))
+	} else {
+		q.Del("page")
+		q.Set("offset", strconv.Itoa(offset))
+	}
+
+	return c.Request().URL.Path + "?" + q.Encode()
+}
+
+// setLinkHeader writes the page links as an RFC 8288 Link header
+func setLinkHeader(c echo.Context, links response.PageLinks) {
+	rels := []string{}
+	for _, l := range []struct{ rel, href string }{
+		{"first", links.First},
+		{"prev", links.Prev},
+		{"next", links.Next},
+		{"last", links.Last},
+	} {
+		if l.href != "" {
+			rels = append(rels, fmt.Sprintf("<%s>; rel=\"%s\"", l.href, l.rel))
+		}
+	}
+
+	if len(rels) > 0 {
+		c.Response().Header().Set("Link", strings.Join(rels, ", "))
+	}
+}
@@ -0,0 +1,261 @@
+package controllers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"go-cache-api/models"
+	"go-cache-api/patch"
+	"go-cache-api/problem"
+	"go-cache-api/validation"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// readOnlyFields can not be changed by a patch
+var readOnlyFields = []string{"id", "score", "createdAt", "updatedAt", "deletedAt", "import"}
+
+// patchError carries the status code of a failed patch
+type patchError struct {
+	Status int
+	Err    error
+}
+
+func (e *patchError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *patchError) Unwrap() error {
+	return e.Err
+}
+
+// patchDocument applies the merge patch or JSON patch of the request body to
+// current, decodes the patched document into result, validates it and returns
+// the $set / $unset update of the fields that changed
+func patchDocument(c echo.Context, current interface{}, result interface{}, validate func(interface{}) error) (bson.M, error) {
+	body, err := io.ReadAll(c.Request().Body)
+	if err != nil {
+		return nil, &patchError{http.StatusBadRequest, errors.New("Invalid request payload")}
+	}
+
+	return applyPatch(current, c.Request().Header.Get("Content-Type"), body, result, validate)
+}
+
+// applyPatch is patchDocument for a patch of the given content type
+func applyPatch(current interface{}, contentType string, body []byte, result interface{}, validate func(interface{}) error) (bson.M, error) {
+	var doc map[string]interface{}
+	b, err := json.Marshal(current)
+	if err != nil {
+		return nil, &patchError{http.StatusInternalServerError, err}
+	}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, &patchError{http.StatusInternalServerError, err}
+	}
+
+	patched, err := patch.Apply(doc, contentType, body)
+	if err == patch.ErrUnsupportedMediaType {
+		return nil, &patchError{http.StatusUnsupportedMediaType, err}
+	}
+	if err != nil {
+		return nil, &patchError{http.StatusBadRequest, err}
+	}
+
+	for _, f := range readOnlyFields {
+		if !reflect.DeepEqual(doc[f], patched[f]) {
+			return nil, &patchError{http.StatusUnprocessableEntity, fmt.Errorf("field '%s' is read only", f)}
+		}
+	}
+
+	// the patched document has to be a valid model
+	b, err = json.Marshal(patched)
+	if err != nil {
+		return nil, &patchError{http.StatusBadRequest, err}
+	}
+	decoder := json.NewDecoder(bytes.NewReader(b))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(result); err != nil {
+		return nil, &patchError{http.StatusUnprocessableEntity, err}
+	}
+
+	if err := validate(result); err != nil {
+		return nil, &patchError{http.StatusUnprocessableEntity, err}
+	}
+
+	values, err := toBsonM(result)
+	if err != nil {
+		return nil, &patchError{http.StatusInternalServerError, err}
+	}
+
+	// the update is the diff of the validated document, validate may change
+	// fields the patch did not touch like the product fields of an export
+	var validated map[string]interface{}
+	b, err = json.Marshal(result)
+	if err != nil {
+		return nil, &patchError{http.StatusInternalServerError, err}
+	}
+	if err := json.Unmarshal(b, &validated); err != nil {
+		return nil, &patchError{http.StatusInternalServerError, err}
+	}
+
+	set := bson.M{}
+	unset := bson.M{}
+	for jsonName, bsonName := range modelFields(reflect.ValueOf(result).Elem().Interface()) {
+		if IsStringInSlice(jsonName, readOnlyFields) {
+			continue
+		}
+
+		value, ok := validated[jsonName]
+		if !ok || value == nil {
+			if doc[jsonName] != nil {
+				unset[bsonName] = ""
+			}
+			continue
+		}
+
+		if !reflect.DeepEqual(doc[jsonName], value) {
+			set[bsonName] = values[bsonName]
+		}
+	}
+
+	update := bson.M{}
+	if len(set) > 0 {
+		update["$set"] = set
+	}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+
+	return update, nil
+}
+
+// patchByID writes update and stamps updatedAt
+func patchByID(ctx context.Context, documents store, id primitive.ObjectID, update bson.M, updatedAt time.Time) error {
+	set, ok := update["$set"].(bson.M)
+	if !ok {
+		set = bson.M{}
+		update["$set"] = set
+	}
+	set["updatedAt"] = updatedAt
+
+	_, err := documents.Update(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// validateModel checks the validate tags of a product or an export
+func validateModel(v interface{}) error {
+	if errs := validation.Struct(v); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+// patchErrorResponse writes a failed patch, listing the broken rules when the
+// patched document is not valid
+func patchErrorResponse(c echo.Context, err error) error {
+	status := http.StatusBadRequest
+	var pe *patchError
+	if errors.As(err, &pe) {
+		status = pe.Status
+	}
+
+	var errs validation.Errors
+	if errors.As(err, &errs) {
+		p := problem.New(c, status, problem.CodeValidation, "Validation failed")
+		p.Errors = errs
+		return problem.Send(c, p)
+	}
+
+	return problem.Write(c, status, err.Error())
+}
+
+// PatchProduct applies an RFC 7396 merge patch or an RFC 6902 JSON patch to a product
+func (h *Handler) PatchProduct(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	productId, err := primitive.ObjectIDFromHex(c.Param("productId"))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid product id")
+	}
+
+	filter := notDeleted()
+	filter["_id"] = productId
+
+	var product models.Product
+	err = h.Products.Get(ctx, filter, nil, &product)
+	if err != nil {
+		return problem.Mongo(c, err, "Product not found")
+	}
+
+	var patched models.Product
+	update, err := patchDocument(c, product, &patched, validateModel)
+	if err != nil {
+		return patchErrorResponse(c, err)
+	}
+
+	if len(update) == 0 {
+		return c.JSON(http.StatusOK, product)
+	}
+
+	before := h.productAudit.before(ctx, productId)
+
+	updateTime := time.Now()
+	if err := patchByID(ctx, h.Products, productId, update, updateTime); err != nil {
+		return problem.Mongo(c, err, "Failed to update product")
+	}
+
+	h.productAudit.record(ctx, c, "update", before, productId)
+	patched.UpdatedAt = &updateTime
+
+	return c.JSON(http.StatusOK, patched)
+}
+
+// PatchExport applies an RFC 7396 merge patch or an RFC 6902 JSON patch to an export
+func (h *Handler) PatchExport(c echo.Context) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	exportId, err := primitive.ObjectIDFromHex(c.Param("exportId"))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid export id")
+	}
+
+	filter := notDeleted()
+	filter["_id"] = exportId
+
+	var export models.ExportData
+	err = h.Exports.Get(ctx, filter, nil, &export)
+	if err != nil {
+		return problem.Mongo(c, err, "Export not found")
+	}
+
+	var patched models.ExportData
+	update, err := patchDocument(c, export, &patched, h.validateExport(ctx))
+	if err != nil {
+		return patchErrorResponse(c, err)
+	}
+
+	if len(update) == 0 {
+		return c.JSON(http.StatusOK, export)
+	}
+
+	before := h.exportAudit.before(ctx, exportId)
+
+	updateTime := time.Now()
+	if err := patchByID(ctx, h.Exports, exportId, update, updateTime); err != nil {
+		return problem.Mongo(c, err, "Failed to update export")
+	}
+
+	h.exportAudit.record(ctx, c, "update", before, exportId)
+	patched.UpdatedAt = &updateTime
+
+	return c.JSON(http.StatusOK, patched)
+}
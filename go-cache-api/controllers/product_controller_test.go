@@ -0,0 +1,243 @@
+package controllers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"go-cache-api/models"
+
+	"github.com/labstack/echo"
+)
+
+func createProducts(t *testing.T, e *echo.Echo, products ...models.Product) []models.Product {
+	t.Helper()
+
+	var created struct {
+		Products []models.Product `json:"products"`
+	}
+	decode(t, do(t, e, http.MethodPost, "/products", products), http.StatusOK, &created)
+	return created.Products
+}
+
+func TestCreateAndGetProduct(t *testing.T) {
+	e := newServer()
+
+	created := createProducts(t, e, models.Product{ProductName: "Rice", Category: "Food", ValueTHB: 400, ValueUSD: 12, BusinessSize: "Small"})
+	if len(created) != 1 || created[0].ID.IsZero() || created[0].CreatedAt == nil {
+		t.Fatalf("created = %+v", created)
+	}
+
+	var product models.Product
+	decode(t, do(t, e, http.MethodGet, "/products/"+created[0].ID.Hex(), nil), http.StatusOK, &product)
+	if product.ProductName != "Rice" || product.ValueTHB != 400 || product.BusinessSize != "Small" {
+		t.Errorf("product = %+v", product)
+	}
+}
+
+func TestCreateProductsValidation(t *testing.T) {
+	tests := []struct {
+		name    string
+		product models.Product
+		field   string
+		rule    string
+	}{
+		{"missing name", models.Product{BusinessSize: "Small"}, "productName", "required"},
+		{"missing business size", models.Product{ProductName: "Rice"}, "businessSize", "required"},
+		{"negative value", models.Product{ProductName: "Rice", BusinessSize: "Small", ValueTHB: -1}, "valueTHB", "gte"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newServer()
+
+			rules := validationRules(t, do(t, e, http.MethodPost, "/products", []models.Product{tt.product}))
+			if rules[tt.field] != tt.rule {
+				t.Errorf("rules = %v, want %s on %s", rules, tt.rule, tt.field)
+			}
+
+			var list page[models.Product]
+			decode(t, do(t, e, http.MethodGet, "/products", nil), http.StatusOK, &list)
+			if list.Total != 0 {
+				t.Errorf("an invalid product was created, total = %d", list.Total)
+			}
+		})
+	}
+}
+
+func TestGetProducts(t *testing.T) {
+	e := newServer()
+	createProducts(t, e,
+		models.Product{ProductName: "Rice", Category: "Food", ValueTHB: 400, BusinessSize: "Small"},
+		models.Product{ProductName: "Tea", Category: "Drink", ValueTHB: 100, BusinessSize: "Micro"},
+		models.Product{ProductName: "Corn", Category: "Food", ValueTHB: 250, BusinessSize: "Large"},
+	)
+
+	tests := []struct {
+		name  string
+		query string
+		total int64
+		names []string
+	}{
+		{"sorted", "?sortby=valueTHB", 3, []string{"Tea", "Corn", "Rice"}},
+		{"sorted descending", "?sortby=productName:desc", 3, []string{"Tea", "Rice", "Corn"}},
+		{"limited", "?sortby=productName&limit=2", 3, []string{"Corn", "Rice"}},
+		{"second page", "?sortby=productName&limit=2&page=2", 3, []string{"Tea"}},
+		{"filtered", "?category=Food&sortby=productName", 2, []string{"Corn", "Rice"}},
+		{"range", "?valueTHB[gte]=200&valueTHB[lt]=400", 1, []string{"Corn"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var list page[models.Product]
+			decode(t, do(t, e, http.MethodGet, "/products"+tt.query, nil), http.StatusOK, &list)
+
+			names := []string{}
+			for _, product := range list.Items {
+				names = append(names, product.ProductName)
+			}
+			if list.Total != tt.total || len(names) != len(tt.names) {
+				t.Fatalf("total = %d, names = %v, want %d and %v", list.Total, names, tt.total, tt.names)
+			}
+			for i := range names {
+				if names[i] != tt.names[i] {
+					t.Fatalf("names = %v, want %v", names, tt.names)
+				}
+			}
+		})
+	}
+}
+
+func TestGetProductsBadQuery(t *testing.T) {
+	e := newServer()
+
+	for _, query := range []string{"?limit=0", "?limit=abc", "?sortby=unknown", "?unknown=1"} {
+		rec := do(t, e, http.MethodGet, "/products"+query, nil)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("GET /products%s status = %d, want 400", query, rec.Code)
+		}
+	}
+}
+
+func TestGetProductNotFound(t *testing.T) {
+	e := newServer()
+
+	if rec := do(t, e, http.MethodGet, "/products/not-an-id", nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("invalid id status = %d, want 400", rec.Code)
+	}
+	if rec := do(t, e, http.MethodGet, "/products/000000000000000000000000", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("unknown id status = %d, want 404", rec.Code)
+	}
+}
+
+func TestEditProduct(t *testing.T) {
+	e := newServer()
+	id := createProducts(t, e, models.Product{ProductName: "Rice", Category: "Food", BusinessSize: "Small"})[0].ID.Hex()
+
+	edit := models.Product{ProductName: "Jasmine rice", Category: "Food", ValueTHB: 500, BusinessSize: "Medium"}
+	decode(t, do(t, e, http.MethodPut, "/products/"+id, edit), http.StatusOK, nil)
+
+	var product models.Product
+	decode(t, do(t, e, http.MethodGet, "/products/"+id, nil), http.StatusOK, &product)
+	if product.ProductName != "Jasmine rice" || product.ValueTHB != 500 || product.BusinessSize != "Medium" {
+		t.Errorf("product = %+v", product)
+	}
+
+	edit.ValueTHB = -1
+	if rules := validationRules(t, do(t, e, http.MethodPut, "/products/"+id, edit)); rules["valueTHB"] != "gte" {
+		t.Errorf("rules = %v", rules)
+	}
+}
+
+func TestPatchProduct(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		status      int
+		productName string
+	}{
+		{"merge patch", "application/merge-patch+json", `{"productName":"Jasmine rice"}`, http.StatusOK, "Jasmine rice"},
+		{"json patch", "application/json-patch+json", `[{"op":"replace","path":"/productName","value":"Jasmine rice"}]`, http.StatusOK, "Jasmine rice"},
+		{"failed test", "application/json-patch+json", `[{"op":"test","path":"/productName","value":"Corn"}]`, http.StatusBadRequest, "Rice"},
+		{"invalid result", "application/merge-patch+json", `{"productName":""}`, http.StatusUnprocessableEntity, "Rice"},
+		{"read only field", "application/merge-patch+json", `{"createdAt":null}`, http.StatusUnprocessableEntity, "Rice"},
+		{"unsupported type", "text/plain", `productName=Corn`, http.StatusUnsupportedMediaType, "Rice"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := newServer()
+			id := createProducts(t, e, models.Product{ProductName: "Rice", Category: "Food", BusinessSize: "Small"})[0].ID.Hex()
+
+			req := httptest.NewRequest(http.MethodPatch, "/products/"+id, strings.NewReader(tt.body))
+			req.Header.Set(echo.HeaderContentType, tt.contentType)
+			rec := httptest.NewRecorder()
+			e.ServeHTTP(rec, req)
+			if rec.Code != tt.status {
+				t.Fatalf("status = %d, want %d: %s", rec.Code, tt.status, rec.Body.String())
+			}
+
+			var product models.Product
+			decode(t, do(t, e, http.MethodGet, "/products/"+id, nil), http.StatusOK, &product)
+			if product.ProductName != tt.productName {
+				t.Errorf("productName = %q, want %q", product.ProductName, tt.productName)
+			}
+		})
+	}
+}
+
+func TestSoftDeleteAndRestoreProduct(t *testing.T) {
+	e := newServer()
+	id := createProducts(t, e, models.Product{ProductName: "Rice", Category: "Food", BusinessSize: "Small"})[0].ID.Hex()
+
+	decode(t, do(t, e, http.MethodDelete, "/products/"+id+"?deleteType=1", nil), http.StatusOK, nil)
+
+	if rec := do(t, e, http.MethodGet, "/products/"+id, nil); rec.Code != http.StatusNotFound {
+		t.Errorf("soft deleted product status = %d, want 404", rec.Code)
+	}
+
+	var trash page[models.Product]
+	decode(t, do(t, e, http.MethodGet, "/products/trash", nil), http.StatusOK, &trash)
+	if trash.Total != 1 || trash.Items[0].ID.Hex() != id || trash.Items[0].DeletedAt == nil {
+		t.Fatalf("trash = %+v", trash)
+	}
+	deletedAt := *trash.Items[0].DeletedAt
+
+	if rec := do(t, e, http.MethodDelete, "/products/"+id+"?deleteType=1", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("second soft delete status = %d, want 404", rec.Code)
+	}
+	decode(t, do(t, e, http.MethodGet, "/products/trash", nil), http.StatusOK, &trash)
+	if !trash.Items[0].DeletedAt.Equal(deletedAt) {
+		t.Errorf("deletedAt = %v after a second soft delete, want %v", trash.Items[0].DeletedAt, deletedAt)
+	}
+
+	decode(t, do(t, e, http.MethodPost, "/products/"+id+"/restore", nil), http.StatusOK, nil)
+	decode(t, do(t, e, http.MethodGet, "/products/"+id, nil), http.StatusOK, nil)
+
+	decode(t, do(t, e, http.MethodGet, "/products/trash", nil), http.StatusOK, &trash)
+	if trash.Total != 0 {
+		t.Errorf("restored product is still in the trash, total = %d", trash.Total)
+	}
+}
+
+func TestHardDeleteProduct(t *testing.T) {
+	e := newServer()
+	id := createProducts(t, e, models.Product{ProductName: "Rice", Category: "Food", BusinessSize: "Small"})[0].ID.Hex()
+
+	if rec := do(t, e, http.MethodDelete, "/products/"+id, nil); rec.Code != http.StatusBadRequest {
+		t.Errorf("delete without deleteType status = %d, want 400", rec.Code)
+	}
+
+	decode(t, do(t, e, http.MethodDelete, "/products/"+id+"?deleteType=0", nil), http.StatusOK, nil)
+
+	var trash page[models.Product]
+	decode(t, do(t, e, http.MethodGet, "/products/trash", nil), http.StatusOK, &trash)
+	if trash.Total != 0 {
+		t.Errorf("hard deleted product is in the trash, total = %d", trash.Total)
+	}
+	if rec := do(t, e, http.MethodPost, "/products/"+id+"/restore", nil); rec.Code != http.StatusNotFound {
+		t.Errorf("restore of a hard deleted product status = %d, want 404", rec.Code)
+	}
+}
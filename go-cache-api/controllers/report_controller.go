@@ -0,0 +1,304 @@
+package controllers
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"time"
+
+	"go-cache-api/download"
+	"go-cache-api/problem"
+	"go-cache-api/response"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// maxReportYears bounds the periods of a report
+const maxReportYears = 100
+
+// reportFilters are the fields a report can be restricted to, a comma
+// separated value matches any of its values
+var reportFilters = []string{"country", "category", "businessSize"}
+
+// reportInterval is the length of the periods of a report
+type reportInterval struct {
+	name string
+	// group is the $group _id of a period
+	group bson.M
+	// layout parses ?from= and ?to=
+	layout string
+	// yearLength is the number of periods in a year
+	yearLength int
+}
+
+var (
+	monthlyReport = reportInterval{
+		name:       "monthly",
+		group:      bson.M{"year": "$year", "month": "$month"},
+		layout:     "2006-01",
+		yearLength: 12,
+	}
+	yearlyReport = reportInterval{
+		name:       "yearly",
+		group:      bson.M{"year": "$year"},
+		layout:     "2006",
+		yearLength: 1,
+	}
+)
+
+// index numbers the periods so the one before a period is index-1
+func (ri reportInterval) index(year int, month int) int {
+	if ri.yearLength == 1 {
+		return year
+	}
+	return year*12 + month - 1
+}
+
+func (ri reportInterval) period(index int) (int, int) {
+	if ri.yearLength == 1 {
+		return index, 0
+	}
+	return index / 12, index%12 + 1
+}
+
+// parseBound reads ?from= or ?to=, -1 when it is not set
+func (ri reportInterval) parseBound(c echo.Context, param string) (int, error) {
+	v := c.QueryParam(param)
+	if v == "" {
+		return -1, nil
+	}
+
+	t, err := time.Parse(ri.layout, v)
+	if err != nil {
+		return 0, fmt.Errorf("%s should be formatted as %s", param, ri.layout)
+	}
+	return ri.index(t.Year(), int(t.Month())), nil
+}
+
+// reportTotals is a period as grouped by the aggregation
+type reportTotals struct {
+	ID struct {
+		Year  int `bson:"year"`
+		Month int `bson:"month"`
+	} `bson:"_id"`
+	Count    int64 `bson:"count"`
+	ValueTHB int64 `bson:"valueTHB"`
+	ValueUSD int64 `bson:"valueUSD"`
+}
+
+// compare is the change from previous to current
+func compare(current, previous response.ReportPeriod) *response.ReportChange {
+	return &response.ReportChange{
+		ValueTHB:       current.ValueTHB - previous.ValueTHB,
+		ValueUSD:       current.ValueUSD - previous.ValueUSD,
+		ValueTHBGrowth: growth(current.ValueTHB, previous.ValueTHB),
+		ValueUSDGrowth: growth(current.ValueUSD, previous.ValueUSD),
+	}
+}
+
+// growth is the change in percent rounded to two decimals
+func growth(current, previous int64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	g := math.Round(float64(current-previous)/float64(previous)*10000) / 100
+	return &g
+}
+
+// exportReport sends the export totals of every period of the interval
+func (h *Handler) exportReport(c echo.Context, ri reportInterval) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	for name := range c.QueryParams() {
+		if name != "from" && name != "to" && name != "format" && !IsStringInSlice(name, reportFilters) {
+			return problem.Write(c, http.StatusBadRequest, fmt.Sprintf("unknown query parameter '%s'", name))
+		}
+	}
+
+	from, err := ri.parseBound(c, "from")
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+	to, err := ri.parseBound(c, "to")
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+	if from >= 0 && to >= 0 && from > to {
+		return problem.Write(c, http.StatusBadRequest, "from should not be after to")
+	}
+	if from >= 0 && to >= 0 && to-from >= maxReportYears*ri.yearLength {
+		return problem.Write(c, http.StatusBadRequest, fmt.Sprintf("a report covers at most %d years", maxReportYears))
+	}
+
+	match := notDeleted()
+	filters := map[string][]string{}
+	for _, name := range reportFilters {
+		values := normalizeFields(c.QueryParams()[name])
+		if len(values) > 0 {
+			match[name] = bson.M{"$in": values}
+			filters[name] = values
+		}
+	}
+
+	// the year before from is loaded too, the first periods are compared to it
+	years := bson.M{}
+	if from >= 0 {
+		year, _ := ri.period(from)
+		years["$gte"] = year - 1
+	}
+	if to >= 0 {
+		year, _ := ri.period(to)
+		years["$lte"] = year
+	}
+	if len(years) > 0 {
+		match["year"] = years
+	}
+
+	format, err := downloadFormat(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	load := func() (interface{}, error) {
+		cur, err := h.exportCollection.Aggregate(ctx, []bson.M{
+			{"$match": match},
+			{"$group": bson.M{
+				"_id":      ri.group,
+				"count":    bson.M{"$sum": 1},
+				"valueTHB": bson.M{"$sum": "$valueTHB"},
+				"valueUSD": bson.M{"$sum": "$valueUSD"},
+			}},
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		var totals []reportTotals
+		if err := cur.All(ctx, &totals); err != nil {
+			return nil, err
+		}
+
+		return buildReport(ri, totals, from, to, filters), nil
+	}
+
+	if format != nil {
+		report, err := load()
+		if err != nil {
+			return problem.Mongo(c, err, "Can not build the report")
+		}
+		return downloadReport(c, format, report.(*response.Report))
+	}
+
+	cacheKey := generateCacheKey(c, "reports:exports:"+ri.name)
+
+	return h.serveCached(c, ctx, cacheKey, load)
+}
+
+// buildReport lays totals out on consecutive periods between from and to,
+// or between the first and the last period with exports when they are not set
+func buildReport(ri reportInterval, totals []reportTotals, from int, to int, filters map[string][]string) *response.Report {
+	report := &response.Report{Interval: ri.name, Filters: filters, Periods: []response.ReportPeriod{}}
+
+	byIndex := map[int]response.ReportPeriod{}
+	indexes := []int{}
+	for _, t := range totals {
+		i := ri.index(t.ID.Year, t.ID.Month)
+		byIndex[i] = response.ReportPeriod{Count: t.Count, ValueTHB: t.ValueTHB, ValueUSD: t.ValueUSD}
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	// periods before known hold no data, there is nothing to compare them to
+	known, first, last := from-ri.yearLength, from, to
+	if len(indexes) > 0 {
+		if from < 0 {
+			known, first = indexes[0], indexes[0]
+		}
+		if to < 0 {
+			last = indexes[len(indexes)-1]
+		}
+	}
+	if first < 0 || last < 0 {
+		return report
+	}
+
+	at := func(i int) response.ReportPeriod {
+		p := byIndex[i]
+		p.Year, p.Month = ri.period(i)
+		return p
+	}
+
+	for i := first; i <= last; i++ {
+		p := at(i)
+		if ri.yearLength > 1 && i-1 >= known {
+			p.MonthOverMonth = compare(p, at(i-1))
+		}
+		if i-ri.yearLength >= known {
+			p.YearOverYear = compare(p, at(i-ri.yearLength))
+		}
+		report.Periods = append(report.Periods, p)
+	}
+
+	return report
+}
+
+func (h *Handler) MonthlyExportReport(c echo.Context) error {
+	return h.exportReport(c, monthlyReport)
+}
+
+func (h *Handler) YearlyExportReport(c echo.Context) error {
+	return h.exportReport(c, yearlyReport)
+}
+
+// downloadReport sends a report as a file, the changes are flattened into
+// columns named after them
+func downloadReport(c echo.Context, f *download.Format, report *response.Report) error {
+	monthly := report.Interval == monthlyReport.name
+
+	changes := []string{"yearOverYear"}
+	if monthly {
+		changes = []string{"monthOverMonth", "yearOverYear"}
+	}
+
+	columns := []string{"year"}
+	if monthly {
+		columns = append(columns, "month")
+	}
+	columns = append(columns, "count", "valueTHB", "valueUSD")
+	for _, name := range changes {
+		columns = append(columns, name+"ValueTHB", name+"ValueUSD", name+"ValueTHBGrowth", name+"ValueUSDGrowth")
+	}
+
+	i := 0
+	return streamDownload(c, f, "exports-"+report.Interval, columns, func() ([]interface{}, bool, error) {
+		if i == len(report.Periods) {
+			return nil, false, nil
+		}
+		p := report.Periods[i]
+		i++
+
+		row := []interface{}{p.Year}
+		if monthly {
+			row = append(row, p.Month)
+		}
+		row = append(row, p.Count, p.ValueTHB, p.ValueUSD)
+
+		periodChanges := []*response.ReportChange{p.YearOverYear}
+		if monthly {
+			periodChanges = []*response.ReportChange{p.MonthOverMonth, p.YearOverYear}
+		}
+
+		for _, change := range periodChanges {
+			if change == nil {
+				row = append(row, nil, nil, nil, nil)
+				continue
+			}
+			row = append(row, change.ValueTHB, change.ValueUSD, change.ValueTHBGrowth, change.ValueUSDGrowth)
+		}
+		return row, true, nil
+	})
+}
@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-cache-api/search"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// searchIndex is the text index of the searchable fields of a collection,
+// see search.TextIndex. The index is created by the migrations
+type searchIndex struct {
+	collection *mongo.Collection
+	weights    map[string]int32
+}
+
+// searchQuery is the ?search= of a list endpoint, nil when there is none
+type searchQuery struct {
+	text string
+}
+
+// parseSearch reads ?search=. Search results are ranked by relevance so they
+// are paginated by offset, a cursor only follows the sort values
+func parseSearch(c echo.Context, p pagination) (*searchQuery, error) {
+	if c.QueryParam("search") == "" {
+		return nil, nil
+	}
+
+	text, err := search.Query(c.QueryParam("search"))
+	if err != nil {
+		return nil, err
+	}
+
+	if p.Cursor != nil {
+		return nil, errors.New("cursor can not be combined with search")
+	}
+
+	return &searchQuery{text: text}, nil
+}
+
+// apply restricts filter to the documents matching the search
+func (q *searchQuery) apply(filter bson.M) {
+	if q == nil {
+		return
+	}
+	filter["$text"] = bson.M{"$search": q.text}
+}
+
+// sort puts the most relevant documents first, sorts only breaks the ties
+func (q *searchQuery) sort(sorts bson.D) bson.D {
+	if q == nil {
+		return sorts
+	}
+	return append(bson.D{{Key: "score", Value: bson.M{"$meta": "textScore"}}}, sorts...)
+}
+
+// projection adds the relevance score to projection, a nil projection still
+// returns every field
+func (q *searchQuery) projection(projection bson.M) bson.M {
+	if q == nil {
+		return projection
+	}
+
+	withScore := bson.M{"score": bson.M{"$meta": "textScore"}}
+	for k, v := range projection {
+		if k != "score" {
+			withScore[k] = v
+		}
+	}
+	return withScore
+}
+
+// findListPage runs a list query, by cursor unless it is a search
+func findListPage(ctx context.Context, documents pageReader, filter bson.M, sorts bson.D, projection bson.M, q *searchQuery, p pagination, results interface{}) (int64, string, error) {
+	if q == nil {
+		return findCursorPage(ctx, documents, filter, sorts, projection, p, results)
+	}
+
+	query := p.query(filter)
+	query.Sort = q.sort(sorts)
+	query.Projection = q.projection(projection)
+	total, err := findPage(ctx, documents, query, results)
+	return total, "", err
+}
+
+// reindex computes the search terms of the documents matched by filter
+func (s searchIndex) reindex(ctx context.Context, filter bson.M) error {
+	return search.Reindex(ctx, s.collection, s.weights, filter)
+}
+
+// index refreshes the search terms of the written documents of ids, a
+// failure only leaves them out of date until the next write
+func (s searchIndex) index(ctx context.Context, ids ...primitive.ObjectID) {
+	if len(ids) == 0 {
+		return
+	}
+	if err := s.reindex(ctx, bson.M{"_id": bson.M{"$in": ids}}); err != nil {
+		log.Println("search index:", err)
+	}
+}
@@ -0,0 +1,167 @@
+package controllers
+
+import (
+	"context"
+	"go-cache-api/models"
+	"go-cache-api/problem"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// deletedAtField marks a soft deleted document, it is the only field name used
+// for soft delete in products and exports
+const deletedAtField = "deletedAt"
+
+// notDeleted is the base filter of every read, it hides soft deleted documents
+func notDeleted() bson.M {
+	return bson.M{deletedAtField: bson.M{"$exists": false}}
+}
+
+// onlyDeleted matches the documents in the trash
+func onlyDeleted() bson.M {
+	return bson.M{deletedAtField: bson.M{"$exists": true}}
+}
+
+// listTrash returns a page of soft deleted documents, the most recently deleted first
+func listTrash(c echo.Context, documents store, results interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	p, err := parsePagination(c)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
+	}
+
+	q := p.query(onlyDeleted())
+	q.Sort = bson.D{{Key: deletedAtField, Value: -1}, {Key: "_id", Value: -1}}
+
+	total, err := findPage(ctx, documents, q, results)
+	if err != nil {
+		return problem.Mongo(c, err, "Can not find data in trash")
+	}
+
+	page := newPage(c, results, total, p)
+	setLinkHeader(c, page.Links)
+
+	return c.JSON(http.StatusOK, page)
+}
+
+// restoreDeleted takes the document out of the trash
+func restoreDeleted(c echo.Context, r auditResource, param string, name string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	id, err := primitive.ObjectIDFromHex(c.Param(param))
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, "Invalid "+name+" id")
+	}
+
+	filter := onlyDeleted()
+	filter["_id"] = id
+
+	before := r.before(ctx, id)
+
+	result, err := r.store.Update(ctx, filter, bson.M{
+		"$unset": bson.M{deletedAtField: ""},
+		"$set":   bson.M{"updatedAt": time.Now()},
+	})
+	if err != nil {
+		return problem.Mongo(c, err, "Failed to restore "+name)
+	}
+
+	if result.Matched == 0 {
+		return problem.Write(c, http.StatusNotFound, "Deleted "+name+" not found")
+	}
+
+	r.record(ctx, c, "restore", before, id)
+
+	return c.JSON(http.StatusOK, echo.Map{"message": id.Hex() + " has been restored"})
+}
+
+func (h *Handler) GetProductsTrash(c echo.Context) error {
+	return listTrash(c, h.Products, &[]models.Product{})
+}
+
+func (h *Handler) RestoreProduct(c echo.Context) error {
+	return restoreDeleted(c, h.productAudit, "productId", "product")
+}
+
+func (h *Handler) GetExportsTrash(c echo.Context) error {
+	return listTrash(c, h.Exports, &[]models.ExportData{})
+}
+
+func (h *Handler) RestoreExport(c echo.Context) error {
+	return restoreDeleted(c, h.exportAudit, "exportId", "export")
+}
+
+// PurgeSoftDeleted hard deletes the documents soft deleted before now - retention,
+// the purged documents stay in their history
+func (h *Handler) PurgeSoftDeleted(ctx context.Context, retention time.Duration) error {
+	filter := bson.M{deletedAtField: bson.M{"$lt": time.Now().Add(-retention)}}
+
+	for _, r := range []auditResource{h.productAudit, h.exportAudit} {
+		cur, err := r.collection.Find(ctx, filter, options.Find().SetProjection(bson.M{"_id": 1}))
+		if err != nil {
+			return err
+		}
+
+		var docs []bson.M
+		if err := cur.All(ctx, &docs); err != nil {
+			return err
+		}
+		if len(docs) == 0 {
+			continue
+		}
+
+		ids := []primitive.ObjectID{}
+		for _, doc := range docs {
+			ids = append(ids, doc["_id"].(primitive.ObjectID))
+		}
+
+		before := r.before(ctx, ids...)
+
+		result, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+		if err != nil {
+			return err
+		}
+
+		r.record(ctx, nil, "purge", before, ids...)
+
+		if result.DeletedCount > 0 {
+			log.Printf("purged %d soft deleted documents from %s", result.DeletedCount, r.collection.Name())
+		}
+	}
+
+	return nil
+}
+
+// StartSoftDeletePurge runs PurgeSoftDeleted every interval until ctx is done
+func (h *Handler) StartSoftDeletePurge(ctx context.Context, interval time.Duration, retention time.Duration) {
+	h.jobs.Add(1)
+	go func() {
+		defer h.jobs.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			purgeCtx, cancel := context.WithTimeout(ctx, time.Minute)
+			if err := h.PurgeSoftDeleted(purgeCtx, retention); err != nil {
+				log.Println("purge soft deleted:", err)
+			}
+			cancel()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
@@ -0,0 +1,286 @@
+package download
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Format is a file format a result can be downloaded in
+type Format struct {
+	Name        string
+	ContentType string
+}
+
+var (
+	CSV  = &Format{Name: "csv", ContentType: "text/csv; charset=utf-8"}
+	XLSX = &Format{Name: "xlsx", ContentType: "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"}
+)
+
+var formats = []*Format{CSV, XLSX}
+
+// Negotiate picks the format of a response, ?format= first and the Accept
+// header otherwise. It returns nil when the response is JSON
+func Negotiate(format string, accept string) (*Format, error) {
+	if format != "" {
+		if format == "json" {
+			return nil, nil
+		}
+		for _, f := range formats {
+			if f.Name == format {
+				return f, nil
+			}
+		}
+		return nil, fmt.Errorf("format should be one of json, csv, xlsx")
+	}
+
+	// the first acceptable format wins, anything else is answered with JSON
+	for _, part := range strings.Split(accept, ",") {
+		mediaType := strings.TrimSpace(strings.Split(part, ";")[0])
+		if mediaType == "application/json" {
+			return nil, nil
+		}
+		for _, f := range formats {
+			if mediaType == strings.Split(f.ContentType, ";")[0] {
+				return f, nil
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// Filename is the name of a download of name in f
+func (f *Format) Filename(name string) string {
+	return name + "." + f.Name
+}
+
+// Writer writes the rows of a download one by one, nothing is buffered
+// beyond what Flush sends
+type Writer interface {
+	Write(row []interface{}) error
+	// Flush sends the rows written so far
+	Flush() error
+	// Close ends the file, the underlying writer stays open
+	Close() error
+}
+
+// NewWriter returns the writer of f, sheet names the worksheet of an XLSX file
+func NewWriter(f *Format, w io.Writer, sheet string) (Writer, error) {
+	switch f {
+	case CSV:
+		return newCSVWriter(w)
+	case XLSX:
+		return newXLSXWriter(w, sheet)
+	}
+	return nil, errors.New("unknown download format")
+}
+
+// Cell formats a value of a mongo document as text
+func Cell(v interface{}) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case primitive.ObjectID:
+		return v.Hex()
+	case primitive.DateTime:
+		return v.Time().UTC().Format(time.RFC3339)
+	case time.Time:
+		return v.UTC().Format(time.RFC3339)
+	case *time.Time:
+		if v == nil {
+			return ""
+		}
+		return v.UTC().Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case *float64:
+		if v == nil {
+			return ""
+		}
+		return strconv.FormatFloat(*v, 'f', -1, 64)
+	}
+	return fmt.Sprint(v)
+}
+
+// number returns the value of a numeric cell
+func number(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case int, int32, int64:
+		return fmt.Sprint(v), true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case *float64:
+		if v != nil {
+			return strconv.FormatFloat(*v, 'f', -1, 64), true
+		}
+	}
+	return "", false
+}
+
+// csvText is the text of a CSV cell that is not a number. A spreadsheet
+// opening a CSV runs a text starting with = + - @ a tab or a carriage return
+// as a formula, it is kept as text by a leading quote. The cells of an XLSX
+// are inline strings, they are never run and are written as they are
+func csvText(v interface{}) string {
+	t := Cell(v)
+	if t != "" && strings.ContainsRune("=+-@\t\r", rune(t[0])) {
+		return "'" + t
+	}
+	return t
+}
+
+type csvWriter struct {
+	w *csv.Writer
+}
+
+// newCSVWriter starts the file with a byte order mark, Excel reads a CSV
+// without one in the local code page and Thai text comes out garbled
+func newCSVWriter(w io.Writer) (*csvWriter, error) {
+	if _, err := io.WriteString(w, "\xEF\xBB\xBF"); err != nil {
+		return nil, err
+	}
+	return &csvWriter{w: csv.NewWriter(w)}, nil
+}
+
+func (cw *csvWriter) Write(row []interface{}) error {
+	record := make([]string, len(row))
+	for i, v := range row {
+		if n, ok := number(v); ok {
+			record[i] = n
+			continue
+		}
+		record[i] = csvText(v)
+	}
+	return cw.w.Write(record)
+}
+
+func (cw *csvWriter) Flush() error {
+	cw.w.Flush()
+	return cw.w.Error()
+}
+
+func (cw *csvWriter) Close() error {
+	return cw.Flush()
+}
+
+// the parts of a workbook holding a single worksheet
+const (
+	xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"><Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/><Default Extension="xml" ContentType="application/xml"/><Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/><Override PartName="/xl/worksheets/sheet1.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/></Types>`
+
+	xlsxRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/></Relationships>`
+
+	xlsxWorkbook = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets><sheet name="%s" sheetId="1" r:id="rId1"/></sheets></workbook>`
+
+	xlsxWorkbookRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet1.xml"/></Relationships>`
+
+	xlsxSheetStart = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main"><sheetData>`
+
+	xlsxSheetEnd = `</sheetData></worksheet>`
+)
+
+// xlsxWriter streams the worksheet into the zip archive. Strings are written
+// inline, a shared string table would need every row before the first one is sent
+type xlsxWriter struct {
+	zw    *zip.Writer
+	sheet io.Writer
+	rows  int
+}
+
+func newXLSXWriter(w io.Writer, sheet string) (*xlsxWriter, error) {
+	var name strings.Builder
+	if err := xml.EscapeText(&name, []byte(sheet)); err != nil {
+		return nil, err
+	}
+
+	zw := zip.NewWriter(w)
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", xlsxContentTypes},
+		{"_rels/.rels", xlsxRels},
+		{"xl/workbook.xml", fmt.Sprintf(xlsxWorkbook, name.String())},
+		{"xl/_rels/workbook.xml.rels", xlsxWorkbookRels},
+	}
+	for _, part := range parts {
+		f, err := zw.Create(part.name)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := io.WriteString(f, part.content); err != nil {
+			return nil, err
+		}
+	}
+
+	sw, err := zw.Create("xl/worksheets/sheet1.xml")
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.WriteString(sw, xlsxSheetStart); err != nil {
+		return nil, err
+	}
+
+	return &xlsxWriter{zw: zw, sheet: sw}, nil
+}
+
+// column is the letter of the ith column, A to Z then AA
+func column(i int) string {
+	name := ""
+	for i++; i > 0; i = (i - 1) / 26 {
+		name = string(rune('A'+(i-1)%26)) + name
+	}
+	return name
+}
+
+func (xw *xlsxWriter) Write(row []interface{}) error {
+	xw.rows++
+
+	var b strings.Builder
+	fmt.Fprintf(&b, `<row r="%d">`, xw.rows)
+	for i, v := range row {
+		ref := column(i) + strconv.Itoa(xw.rows)
+
+		if n, ok := number(v); ok {
+			fmt.Fprintf(&b, `<c r="%s"><v>%s</v></c>`, ref, n)
+			continue
+		}
+
+		cell := Cell(v)
+		if cell == "" {
+			continue
+		}
+		fmt.Fprintf(&b, `<c r="%s" t="inlineStr"><is><t xml:space="preserve">`, ref)
+		if err := xml.EscapeText(&b, []byte(cell)); err != nil {
+			return err
+		}
+		b.WriteString(`</t></is></c>`)
+	}
+	b.WriteString(`</row>`)
+
+	_, err := io.WriteString(xw.sheet, b.String())
+	return err
+}
+
+func (xw *xlsxWriter) Flush() error {
+	return xw.zw.Flush()
+}
+
+func (xw *xlsxWriter) Close() error {
+	if _, err := io.WriteString(xw.sheet, xlsxSheetEnd); err != nil {
+		return err
+	}
+	return xw.zw.Close()
+}
@@ -0,0 +1,167 @@
+package download
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/xml"
+	"io"
+	"testing"
+)
+
+// cells are the values a formula could hide in, written to CSV and XLSX
+var cells = []struct {
+	name  string
+	value interface{}
+	csv   string
+	xlsx  string
+}{
+	{"text", "Rice", "Rice", "Rice"},
+	{"thai", "ข้าว", "ข้าว", "ข้าว"},
+	{"number", 42, "42", "42"},
+	{"negative number", -3.5, "-3.5", "-3.5"},
+	{"formula", "=1+1", "'=1+1", "=1+1"},
+	{"plus", "+66", "'+66", "+66"},
+	{"minus", "-A12", "'-A12", "-A12"},
+	{"at", "@SUM(A1)", "'@SUM(A1)", "@SUM(A1)"},
+	{"tab", "\tx", "'\tx", "\tx"},
+	{"empty", nil, "", ""},
+}
+
+func TestCSVWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(CSV, &b, "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := []interface{}{}
+	for _, c := range cells {
+		row = append(row, c.value)
+	}
+	if err := w.Write(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.HasPrefix(b.Bytes(), []byte("\xEF\xBB\xBF")) {
+		t.Error("the CSV does not start with a byte order mark")
+	}
+	record, err := csv.NewReader(bytes.NewReader(b.Bytes()[3:])).Read()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, c := range cells {
+		if record[i] != c.csv {
+			t.Errorf("%s: cell = %q, want %q", c.name, record[i], c.csv)
+		}
+	}
+}
+
+func TestXLSXWriter(t *testing.T) {
+	var b bytes.Buffer
+	w, err := NewWriter(XLSX, &b, "exports")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	row := []interface{}{}
+	for _, c := range cells {
+		row = append(row, c.value)
+	}
+	if err := w.Write(row); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	values := sheetValues(t, b.Bytes())
+	for i, c := range cells {
+		ref := column(i) + "1"
+		if values[ref] != c.xlsx {
+			t.Errorf("%s: cell %s = %q, want %q", c.name, ref, values[ref], c.xlsx)
+		}
+	}
+}
+
+// sheetValues reads the cells of the worksheet of an XLSX file by reference
+func sheetValues(t *testing.T, file []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(file), int64(len(file)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := zr.Open("xl/worksheets/sheet1.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var sheet struct {
+		Rows []struct {
+			Cells []struct {
+				Ref    string `xml:"r,attr"`
+				Value  string `xml:"v"`
+				Inline string `xml:"is>t"`
+			} `xml:"c"`
+		} `xml:"sheetData>row"`
+	}
+	if err := xml.Unmarshal(data, &sheet); err != nil {
+		t.Fatal(err)
+	}
+
+	values := map[string]string{}
+	for _, row := range sheet.Rows {
+		for _, c := range row.Cells {
+			values[c.Ref] = c.Value + c.Inline
+		}
+	}
+	return values
+}
+
+func TestNegotiate(t *testing.T) {
+	tests := []struct {
+		format string
+		accept string
+		want   *Format
+		err    bool
+	}{
+		{"", "", nil, false},
+		{"json", "text/csv", nil, false},
+		{"csv", "", CSV, false},
+		{"xlsx", "application/json", XLSX, false},
+		{"pdf", "", nil, true},
+		{"", "text/csv; q=0.9", CSV, false},
+		{"", "application/json, text/csv", nil, false},
+		{"", "text/html, application/vnd.openxmlformats-officedocument.spreadsheetml.sheet", XLSX, false},
+		{"", "*/*", nil, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.format+" "+tt.accept, func(t *testing.T) {
+			got, err := Negotiate(tt.format, tt.accept)
+			if (err != nil) != tt.err {
+				t.Fatalf("error = %v, want error %v", err, tt.err)
+			}
+			if got != tt.want {
+				t.Errorf("format = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColumn(t *testing.T) {
+	for i, want := range map[int]string{0: "A", 25: "Z", 26: "AA", 27: "AB", 701: "ZZ", 702: "AAA"} {
+		if got := column(i); got != want {
+			t.Errorf("column(%d) = %s, want %s", i, got, want)
+		}
+	}
+}
@@ -4,246 +4,138 @@ import (
 	"context"
 	"fmt"
 	"go-cache-api/configs"
-	"go-cache-api/models"
+	"go-cache-api/importer"
+	"go-cache-api/validation"
 	"log"
-	"strconv"
-	"strings"
-	"time"
+	"os"
 
-	"github.com/tealeg/xlsx"
-	// "go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-var (
-	// productCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "products")
-	exportCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "exports")
-)
+// readRecords reads a spreadsheet through a mapping of the import mappings,
+// the columns are found by their header so the layout of the file can change
+func readRecords(fileName string, mappingName string, imports configs.Import) []importer.Record {
+	data, err := os.ReadFile(fileName)
+	if err != nil {
+		log.Fatal("Error opening Excel file:", err)
+	}
 
-func InsetExportIntoMongo() {
-	excelFileName := "file/exportdata.xlsx"
+	mappings, err := importer.LoadMappings(imports.MappingsFile)
+	if err != nil {
+		log.Fatal("Error loading import mappings:", err)
+	}
+	mapping, ok := mappings[mappingName]
+	if !ok {
+		log.Fatal("No import mapping named ", mappingName)
+	}
 
-	xlFile, err := xlsx.OpenFile(excelFileName)
+	sheets, err := importer.Read(fileName, data)
 	if err != nil {
-		log.Fatal("Error opening Excel file:", err)
+		log.Fatal("Error reading Excel file:", err)
+	}
+	records, err := mapping.Records(sheets)
+	if err != nil {
+		log.Fatal("Error reading Excel file:", err)
 	}
+	return records
+}
 
-	sheet := xlFile.Sheets[0]
+func InsetExportIntoMongo(db *mongo.Database, imports configs.Import) {
+	records := readRecords("file/exportdata.xlsx", "exports", imports)
 
-	var exportdata []models.ExportData
+	// rows are upserted on their natural key so loading the file again does
+	// not add a copy of every row
+	key, err := importer.NewNaturalKey(imports.NaturalKey)
+	if err != nil {
+		log.Fatal("import natural key: ", err)
+	}
 
-	for rowIndex, row := range sheet.Rows {
-		if rowIndex == 0 {
+	var writes []mongo.WriteModel
+	for _, record := range records {
+		data, errs := importer.ParseExport(record)
+		if errs == nil {
+			errs = validation.Struct(data)
+		}
+		if errs != nil {
+			fmt.Printf("Error in row %d of %s: %s\n", record.Line, record.Sheet, errs)
 			continue
 		}
 
-		if row != nil && len(row.Cells) >= 8 {
-
-			valueTHBStr := strings.TrimSpace(row.Cells[4].String())
-			valueUSDStr := strings.TrimSpace(row.Cells[5].String())
-			valueTHB, err := strconv.Atoi(valueTHBStr)
-			if err != nil {
-				fmt.Printf("Error converting ValueTHB for row %d: %s\n", rowIndex, err)
-				continue
-			}
-			valueUSD, err := strconv.Atoi(valueUSDStr)
-			if err != nil {
-				fmt.Printf("Error converting ValueUSD for row %d: %s\n", rowIndex, err)
-				continue
-			}
-
-			monthStr := strings.TrimSpace(row.Cells[6].String())
-			monthInt, err := strconv.Atoi(monthStr)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-
-			yearStr := strings.TrimSpace(row.Cells[7].String())
-			yearInt, err := strconv.Atoi(yearStr)
-			if err != nil {
-				fmt.Println(err)
-				continue
-			}
-
-			createAt := time.Now()
+		filter, err := key.Filter(data)
+		if err != nil {
+			fmt.Println("Error:", err)
+			continue
+		}
 
-			data := models.ExportData{
-				ID:           primitive.NewObjectID(),
-				ProductName:  row.Cells[2].String(),
-				Category:     row.Cells[1].String(),
-				ValueTHB:     valueTHB,
-				ValueUSD:     valueUSD,
-				BusinessSize: row.Cells[3].String(),
-				Country:      row.Cells[0].String(),
-				Month:        monthInt,
-				Year:         yearInt,
-				CreatedAt:    &createAt,
-				UpdatedAt:    &createAt,
-			}
-			exportdata = append(exportdata, data)
+		update := bson.M{
+			"$set": bson.M{
+				"productName":  data.ProductName,
+				"category":     data.Category,
+				"valueTHB":     data.ValueTHB,
+				"valueUSD":     data.ValueUSD,
+				"businessSize": data.BusinessSize,
+				"country":      data.Country,
+				"month":        data.Month,
+				"year":         data.Year,
+				"updatedAt":    data.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"_id": data.ID, "createdAt": data.CreatedAt},
 		}
+		writes = append(writes, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
 	}
-
-	var exportInterfaces []interface{}
-	for _, exportInterface := range exportdata {
-		exportInterfaces = append(exportInterfaces, exportInterface)
+	if len(writes) == 0 {
+		return
 	}
 
-	_, err = exportCollection.InsertMany(context.TODO(), exportInterfaces)
+	result, err := db.Collection("exports").BulkWrite(context.TODO(), writes, options.BulkWrite().SetOrdered(false))
 	if err != nil {
 		fmt.Println("Error:", err)
+		return
 	}
+	fmt.Printf("Exports inserted: %d, already loaded: %d\n", result.UpsertedCount, result.MatchedCount)
 }
 
-// func InsetExportIntoMongo() {
-// 	excelFileName := "file/test1.xlsx"
-
-// 	xlFile, err := xlsx.OpenFile(excelFileName)
-// 	if err != nil {
-// 		log.Fatal("Error opening Excel file:", err)
-// 	}
-
-// 	sheet := xlFile.Sheets[1]
-
-// 	var exports []models.Export
-
-// 	for rowIndex, row := range sheet.Rows {
-// 		if rowIndex == 0 {
-// 			continue
-// 		}
-
-// 		if row != nil && len(row.Cells) >= 4 {
-
-// 			productIDStr := strings.TrimSpace(row.Cells[0].String())
-// 			productId, err := primitive.ObjectIDFromHex(productIDStr)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				continue
-// 			}
-// 			var product models.Product
-// 			err = productCollection.FindOne(context.Background(), bson.M{"_id": productId}).Decode(&product)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 			}
+// InsetProductIntoMongo loads the products of a spreadsheet, a product is
+// upserted on its name, category and business size as exports are linked on them
+func InsetProductIntoMongo(db *mongo.Database, imports configs.Import) {
+	records := readRecords("file/productdata.xlsx", "products", imports)
 
-// 			monthStr := strings.TrimSpace(row.Cells[2].String())
-// 			monthInt, err := strconv.Atoi(monthStr)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				continue
-// 			}
-
-// 			yearStr := strings.TrimSpace(row.Cells[3].String())
-// 			yearInt, err := strconv.Atoi(yearStr)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				continue
-// 			}
-
-// 			createAt := time.Now()
-
-// 			data := models.Export{
-// 				ID: primitive.NewObjectID(),
-// 				Product: models.Product{
-// 					ID:           productId,
-// 					ProductName:  product.ProductName,
-// 					Category:     product.Category,
-// 					ValueTHB:     product.ValueTHB,
-// 					ValueUSD:     product.ValueUSD,
-// 					BusinessSize: product.BusinessSize,
-// 					CreatedAt:    product.CreatedAt,
-// 					UpdatedAt:    product.UpdatedAt,
-// 				},
-// 				Country:   row.Cells[1].String(),
-// 				Month:     monthInt,
-// 				Year:      yearInt,
-// 				CreatedAt: &createAt,
-// 				UpdatedAt: &createAt,
-// 			}
-// 			exports = append(exports, data)
-// 		}
-// 	}
-
-// 	var interfaceSlice []interface{}
-// 	for _, productType := range exports {
-// 		interfaceSlice = append(interfaceSlice, productType)
-// 	}
-
-// 	_, err = exportCollection.InsertMany(context.TODO(), interfaceSlice)
-// 	if err != nil {
-// 		fmt.Println("Error:", err)
-// 	}
-// }
-
-// func InsetExportIntoMongo() {
-// 	excelFileName := "file/test1.xlsx"
-
-// 	xlFile, err := xlsx.OpenFile(excelFileName)
-// 	if err != nil {
-// 		log.Fatal("Error opening Excel file:", err)
-// 	}
-
-// 	sheet := xlFile.Sheets[1]
-
-// 	var exports []models.Export
-
-// 	for rowIndex, row := range sheet.Rows {
-// 		if rowIndex == 0 {
-// 			continue
-// 		}
-
-// 		if row != nil && len(row.Cells) >= 4 {
-
-// 			productIDStr := strings.TrimSpace(row.Cells[0].String())
-// 			productId, err := primitive.ObjectIDFromHex(productIDStr)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				continue
-// 			}
-// 			var product models.Product
-// 			err = productCollection.FindOne(context.Background(), bson.M{"_id": productId}).Decode(&product)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 			}
-
-// 			monthStr := strings.TrimSpace(row.Cells[2].String())
-// 			monthInt, err := strconv.Atoi(monthStr)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				continue
-// 			}
-
-// 			yearStr := strings.TrimSpace(row.Cells[3].String())
-// 			yearInt, err := strconv.Atoi(yearStr)
-// 			if err != nil {
-// 				fmt.Println(err)
-// 				continue
-// 			}
-
-// 			createAt := time.Now()
-
-// 			data := models.Export{
-// 				ID: primitive.NewObjectID(),
-// 				ProductId: productId,
-// 				Country:   row.Cells[1].String(),
-// 				Month:     monthInt,
-// 				Year:      yearInt,
-// 				CreatedAt: &createAt,
-// 				UpdatedAt: &createAt,
-// 			}
-// 			exports = append(exports, data)
-// 		}
-// 	}
+	var writes []mongo.WriteModel
+	for _, record := range records {
+		data, errs := importer.ParseProduct(record)
+		if errs == nil {
+			errs = validation.Struct(data)
+		}
+		if errs != nil {
+			fmt.Printf("Error in row %d of %s: %s\n", record.Line, record.Sheet, errs)
+			continue
+		}
 
-// 	var interfaceSlice []interface{}
-// 	for _, productType := range exports {
-// 		interfaceSlice = append(interfaceSlice, productType)
-// 	}
+		filter := bson.M{
+			"productName":  data.ProductName,
+			"category":     data.Category,
+			"businessSize": data.BusinessSize,
+		}
+		update := bson.M{
+			"$set": bson.M{
+				"valueTHB":  data.ValueTHB,
+				"valueUSD":  data.ValueUSD,
+				"updatedAt": data.UpdatedAt,
+			},
+			"$setOnInsert": bson.M{"_id": data.ID, "createdAt": data.CreatedAt},
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().SetFilter(filter).SetUpdate(update).SetUpsert(true))
+	}
+	if len(writes) == 0 {
+		return
+	}
 
-// 	_, err = exportCollection.InsertMany(context.TODO(), interfaceSlice)
-// 	if err != nil {
-// 		fmt.Println("Error:", err)
-// 	}
-// }
+	result, err := db.Collection("products").BulkWrite(context.TODO(), writes, options.BulkWrite().SetOrdered(false))
+	if err != nil {
+		fmt.Println("Error:", err)
+		return
+	}
+	fmt.Printf("Products inserted: %d, already loaded: %d\n", result.UpsertedCount, result.MatchedCount)
+}
@@ -0,0 +1,160 @@
+package importer
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"go-cache-api/models"
+	"go-cache-api/validation"
+
+	"github.com/tealeg/xlsx"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxRows bounds the rows of an imported file
+const MaxRows = 100000
+
+var (
+	ErrUnsupportedFile = errors.New("file should be a .xlsx or a .csv")
+	ErrEmptyFile       = errors.New("file has no rows")
+	ErrTooManyRows     = fmt.Errorf("file has more than %d rows", MaxRows)
+)
+
+// Sheet is a sheet of an imported file, a .csv file has a single one
+type Sheet struct {
+	Name string
+	Rows [][]string
+}
+
+// Read returns the sheets of an .xlsx file or the single sheet of a .csv
+// file, named after the file, every cell as text
+func Read(filename string, data []byte) ([]Sheet, error) {
+	var sheets []Sheet
+	var err error
+
+	switch strings.ToLower(filepath.Ext(filename)) {
+	case ".xlsx":
+		sheets, err = readXLSX(data)
+	case ".csv":
+		var rows [][]string
+		rows, err = readCSV(data)
+		sheets = []Sheet{{Name: strings.TrimSuffix(filepath.Base(filename), filepath.Ext(filename)), Rows: rows}}
+	default:
+		return nil, ErrUnsupportedFile
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for _, sheet := range sheets {
+		total += len(sheet.Rows)
+	}
+	if total == 0 {
+		return nil, ErrEmptyFile
+	}
+	if total > MaxRows+len(sheets) {
+		return nil, ErrTooManyRows
+	}
+	return sheets, nil
+}
+
+func readXLSX(data []byte) ([]Sheet, error) {
+	file, err := xlsx.OpenBinary(data)
+	if err != nil {
+		return nil, fmt.Errorf("can not read the spreadsheet: %v", err)
+	}
+	if len(file.Sheets) == 0 {
+		return nil, ErrEmptyFile
+	}
+
+	sheets := []Sheet{}
+	for _, sheet := range file.Sheets {
+		rows := [][]string{}
+		for _, row := range sheet.Rows {
+			cells := []string{}
+			if row != nil {
+				for _, cell := range row.Cells {
+					cells = append(cells, cell.String())
+				}
+			}
+			rows = append(rows, cells)
+		}
+		sheets = append(sheets, Sheet{Name: sheet.Name, Rows: rows})
+	}
+	return sheets, nil
+}
+
+// readCSV reads a UTF-8 csv, the byte order mark Excel writes is skipped
+func readCSV(data []byte) ([][]string, error) {
+	data = bytes.TrimPrefix(data, []byte("\xEF\xBB\xBF"))
+
+	r := csv.NewReader(bytes.NewReader(data))
+	r.FieldsPerRecord = -1
+
+	rows := [][]string{}
+	for {
+		record, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("can not read the csv: %v", err)
+		}
+		rows = append(rows, record)
+	}
+	return rows, nil
+}
+
+// Blank reports whether a row has no value at all, blank rows are skipped
+func Blank(row []string) bool {
+	for _, cell := range row {
+		if strings.TrimSpace(cell) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseExport builds the export of a record read with an exports mapping.
+// The returned errors are the cells that can not be read, the rules of the
+// model are checked by the caller
+func ParseExport(r Record) (models.ExportData, validation.Errors) {
+	var export models.ExportData
+	errs := append(validation.Errors{}, r.Errors...)
+	errs = append(errs, r.Decode(&export)...)
+
+	now := time.Now()
+	export.ID = primitive.NewObjectID()
+	export.CreatedAt = &now
+	export.UpdatedAt = &now
+
+	if len(errs) == 0 {
+		return export, nil
+	}
+	return export, errs
+}
+
+// ParseProduct builds the product of a record read with a products mapping,
+// as ParseExport
+func ParseProduct(r Record) (models.Product, validation.Errors) {
+	var product models.Product
+	errs := append(validation.Errors{}, r.Errors...)
+	errs = append(errs, r.Decode(&product)...)
+
+	now := time.Now()
+	product.ID = primitive.NewObjectID()
+	product.CreatedAt = &now
+	product.UpdatedAt = &now
+
+	if len(errs) == 0 {
+		return product, nil
+	}
+	return product, errs
+}
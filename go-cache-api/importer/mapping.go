@@ -0,0 +1,375 @@
+package importer
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-cache-api/validation"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// types a cell can be converted to
+const (
+	TypeString   = "string"
+	TypeInt      = "int"
+	TypeNumber   = "number"
+	TypeBool     = "bool"
+	TypeObjectID = "objectId"
+	TypeDate     = "date"
+)
+
+// AllSheets in Mapping.Sheets reads every sheet of a file
+const AllSheets = "*"
+
+// Mapping tells which cells of a file hold which fields of a model. Columns
+// are found by their header, a file without a header is read by position
+type Mapping struct {
+	// Sheets are the names of the sheets to read, the first sheet when empty
+	Sheets  []string `json:"sheets,omitempty" bson:"sheets,omitempty"`
+	Columns []Column `json:"columns" bson:"columns"`
+}
+
+// Column maps a column of a file to a field of a model
+type Column struct {
+	// Field is the json name of the field
+	Field string `json:"field" bson:"field"`
+	// Headers are the other names of the column, the field name always matches
+	Headers []string `json:"headers,omitempty" bson:"headers,omitempty"`
+	// Position is where the column is in a file without a header, 1 is the
+	// first column. A column without one is only read from a header
+	Position int `json:"position,omitempty" bson:"position,omitempty"`
+	// Type is one of string, int, number, bool, objectId or date, string by default
+	Type string `json:"type,omitempty" bson:"type,omitempty"`
+	// Default is the value of a blank cell, read as a cell of Type
+	Default string `json:"default,omitempty" bson:"default,omitempty"`
+	// Required columns must be in the header unless they have a Default
+	Required bool `json:"required,omitempty" bson:"required,omitempty"`
+}
+
+// DefaultMappings are the layouts of the spreadsheets the data was first
+// loaded from, with the Thai headers they are also found with
+func DefaultMappings() map[string]Mapping {
+	return map[string]Mapping{
+		"exports": {Columns: []Column{
+			{Field: "country", Headers: []string{"ประเทศ"}, Position: 1, Required: true},
+			{Field: "category", Headers: []string{"หมวดหมู่", "หมวดสินค้า"}, Position: 2, Required: true},
+			{Field: "productName", Headers: []string{"product", "ชื่อสินค้า", "สินค้า"}, Position: 3, Required: true},
+			{Field: "businessSize", Headers: []string{"ขนาดธุรกิจ", "ขนาดกิจการ"}, Position: 4, Required: true},
+			{Field: "valueTHB", Headers: []string{"มูลค่า (บาท)", "มูลค่าบาท"}, Position: 5, Type: TypeInt, Required: true},
+			{Field: "valueUSD", Headers: []string{"มูลค่า (ดอลลาร์)", "มูลค่าดอลลาร์"}, Position: 6, Type: TypeInt, Required: true},
+			{Field: "month", Headers: []string{"เดือน"}, Position: 7, Type: TypeInt, Required: true},
+			{Field: "year", Headers: []string{"ปี"}, Position: 8, Type: TypeInt, Required: true},
+			{Field: "productId", Headers: []string{"รหัสสินค้า"}, Type: TypeObjectID},
+		}},
+		"products": {Columns: []Column{
+			{Field: "productName", Headers: []string{"product", "ชื่อสินค้า", "สินค้า"}, Position: 1, Required: true},
+			{Field: "category", Headers: []string{"หมวดหมู่", "หมวดสินค้า"}, Position: 2},
+			{Field: "valueTHB", Headers: []string{"มูลค่า (บาท)", "มูลค่าบาท"}, Position: 3, Type: TypeInt, Default: "0"},
+			{Field: "valueUSD", Headers: []string{"มูลค่า (ดอลลาร์)", "มูลค่าดอลลาร์"}, Position: 4, Type: TypeInt, Default: "0"},
+			{Field: "businessSize", Headers: []string{"ขนาดธุรกิจ", "ขนาดกิจการ"}, Position: 5, Required: true},
+		}},
+	}
+}
+
+// LoadMappings returns the default mappings with the ones of a json file
+// over them, the file maps a name to a mapping. No file keeps the defaults
+func LoadMappings(path string) (map[string]Mapping, error) {
+	mappings := DefaultMappings()
+	if path == "" {
+		return mappings, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	loaded := map[string]Mapping{}
+	if err := json.Unmarshal(data, &loaded); err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	for name, m := range loaded {
+		if err := m.Check(); err != nil {
+			return nil, fmt.Errorf("%s: mapping %s: %v", path, name, err)
+		}
+		mappings[name] = m
+	}
+	return mappings, nil
+}
+
+// Check reports a mapping that can not be read
+func (m Mapping) Check() error {
+	if len(m.Columns) == 0 {
+		return fmt.Errorf("mapping has no columns")
+	}
+
+	fields := map[string]bool{}
+	for _, col := range m.Columns {
+		if col.Field == "" {
+			return fmt.Errorf("every column needs a field")
+		}
+		if fields[col.Field] {
+			return fmt.Errorf("%s is mapped twice", col.Field)
+		}
+		fields[col.Field] = true
+
+		if col.Position < 0 {
+			return fmt.Errorf("position of %s should be 1 or more", col.Field)
+		}
+		switch col.Type {
+		case "", TypeString, TypeInt, TypeNumber, TypeBool, TypeObjectID, TypeDate:
+		default:
+			return fmt.Errorf("type of %s should be one of string, int, number, bool, objectId, date", col.Field)
+		}
+		if col.Default != "" {
+			if _, err := col.convert(col.Default); err != nil {
+				return fmt.Errorf("default of %s: %v", col.Field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Record is a row of a file read through a mapping
+type Record struct {
+	Sheet string
+	// Line is the line of the row in its sheet, the header is line 1
+	Line int
+	// Checksum is the sha256 of the cells of the row, in hex
+	Checksum string
+	// Values holds the converted cells by field, blank cells without a default are left out
+	Values map[string]interface{}
+	// Errors are the cells that could not be converted
+	Errors validation.Errors
+}
+
+// Records reads the rows of the sheets of m, blank rows are skipped. A sheet
+// whose first row names none of the columns is read by position
+func (m Mapping) Records(sheets []Sheet) ([]Record, error) {
+	selected, err := m.selectSheets(sheets)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []Record{}
+	for _, sheet := range selected {
+		if len(sheet.Rows) == 0 {
+			continue
+		}
+
+		cols, hasHeader := m.bind(sheet.Rows[0])
+		rows, firstLine := sheet.Rows, 1
+		if hasHeader {
+			rows, firstLine = sheet.Rows[1:], 2
+		}
+		if missing := m.missing(cols, hasHeader); len(missing) > 0 {
+			return nil, fmt.Errorf("sheet %s is missing the columns %s", sheet.Name, strings.Join(missing, ", "))
+		}
+
+		for i, row := range rows {
+			if Blank(row) {
+				continue
+			}
+			record := m.record(cols, row)
+			record.Sheet = sheet.Name
+			record.Line = firstLine + i
+			record.Checksum = checksum(row)
+			records = append(records, record)
+		}
+	}
+
+	if len(records) == 0 {
+		return nil, ErrEmptyFile
+	}
+	return records, nil
+}
+
+func (m Mapping) selectSheets(sheets []Sheet) ([]Sheet, error) {
+	if len(m.Sheets) == 0 {
+		return sheets[:1], nil
+	}
+	if len(m.Sheets) == 1 && m.Sheets[0] == AllSheets {
+		return sheets, nil
+	}
+
+	selected := []Sheet{}
+	for _, name := range m.Sheets {
+		found := false
+		for _, sheet := range sheets {
+			if sheet.Name == name {
+				selected = append(selected, sheet)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("file has no sheet %s", name)
+		}
+	}
+	return selected, nil
+}
+
+// checksum identifies the content of a row, the cells are trimmed as they are read
+func checksum(row []string) string {
+	h := sha256.New()
+	for i, cell := range row {
+		if i > 0 {
+			h.Write([]byte{0x1f})
+		}
+		h.Write([]byte(strings.TrimSpace(cell)))
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// normalizeName makes "Product Name", "product_name" and "productName" equal
+func normalizeName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return strings.NewReplacer(" ", "", "_", "", "-", "", "(", "", ")", "", ".", "").Replace(name)
+}
+
+// bind finds the position of the columns of m in header, by the positions of
+// m when the header names none of them
+func (m Mapping) bind(header []string) (map[string]int, bool) {
+	names := map[string]string{}
+	for _, col := range m.Columns {
+		names[normalizeName(col.Field)] = col.Field
+		for _, h := range col.Headers {
+			names[normalizeName(h)] = col.Field
+		}
+	}
+
+	cols := map[string]int{}
+	for i, cell := range header {
+		if field, ok := names[normalizeName(cell)]; ok {
+			if _, dup := cols[field]; !dup {
+				cols[field] = i
+			}
+		}
+	}
+	if len(cols) > 0 {
+		return cols, true
+	}
+
+	for _, col := range m.Columns {
+		if col.Position > 0 {
+			cols[col.Field] = col.Position - 1
+		}
+	}
+	return cols, false
+}
+
+// missing lists the required columns not found, without a default
+func (m Mapping) missing(cols map[string]int, hasHeader bool) []string {
+	missing := []string{}
+	for _, col := range m.Columns {
+		if _, ok := cols[col.Field]; ok || !col.Required || col.Default != "" {
+			continue
+		}
+		if hasHeader {
+			missing = append(missing, col.Field)
+		} else {
+			missing = append(missing, col.Field+" (no position for a file without a header)")
+		}
+	}
+	return missing
+}
+
+func (m Mapping) record(cols map[string]int, row []string) Record {
+	record := Record{Values: map[string]interface{}{}}
+	for _, col := range m.Columns {
+		v := ""
+		if i, ok := cols[col.Field]; ok && i < len(row) {
+			v = strings.TrimSpace(row[i])
+		}
+		if v == "" {
+			v = col.Default
+		}
+		if v == "" {
+			continue
+		}
+
+		value, err := col.convert(v)
+		if err != nil {
+			record.Errors = append(record.Errors, validation.FieldError{
+				Field:   col.Field,
+				Rule:    col.Type,
+				Message: fmt.Sprintf("%s %v, got '%s'", col.Field, err, v),
+			})
+			continue
+		}
+		record.Values[col.Field] = value
+	}
+	return record
+}
+
+// convert reads a cell as the type of col
+func (col Column) convert(v string) (interface{}, error) {
+	switch col.Type {
+	case TypeInt:
+		v = strings.ReplaceAll(v, ",", "")
+		if n, err := strconv.Atoi(v); err == nil {
+			return n, nil
+		}
+		// spreadsheets may keep whole numbers as 2023.0
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f != float64(int(f)) {
+			return nil, fmt.Errorf("should be a whole number")
+		}
+		return int(f), nil
+	case TypeNumber:
+		f, err := strconv.ParseFloat(strings.ReplaceAll(v, ",", ""), 64)
+		if err != nil {
+			return nil, fmt.Errorf("should be a number")
+		}
+		return f, nil
+	case TypeBool:
+		b, err := strconv.ParseBool(strings.ToLower(v))
+		if err != nil {
+			return nil, fmt.Errorf("should be true or false")
+		}
+		return b, nil
+	case TypeObjectID:
+		if _, err := primitive.ObjectIDFromHex(v); err != nil {
+			return nil, fmt.Errorf("should be an object id")
+		}
+		return v, nil
+	case TypeDate:
+		for _, layout := range []string{"2006-01-02", time.RFC3339, "02/01/2006"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, nil
+			}
+		}
+		return nil, fmt.Errorf("should be a date as 2006-01-02")
+	}
+	return v, nil
+}
+
+// Decode fills v, a pointer to a model, with the values of r. A value the
+// field of the model can not hold is returned as the error of the field
+func (r Record) Decode(v interface{}) validation.Errors {
+	data, err := json.Marshal(r.Values)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err == nil {
+		return nil
+	}
+
+	var typeErr *json.UnmarshalTypeError
+	if errors.As(err, &typeErr) {
+		return validation.Errors{{
+			Field:   typeErr.Field,
+			Rule:    "type",
+			Message: fmt.Sprintf("%s can not be a %s, check the type of its column", typeErr.Field, typeErr.Value),
+		}}
+	}
+	return validation.Errors{{Rule: "type", Message: err.Error()}}
+}
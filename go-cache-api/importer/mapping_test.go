@@ -0,0 +1,250 @@
+package importer
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testMapping reads a price list, by header or by position
+var testMapping = Mapping{Columns: []Column{
+	{Field: "productName", Headers: []string{"ชื่อสินค้า"}, Position: 1, Required: true},
+	{Field: "valueTHB", Headers: []string{"มูลค่า (บาท)"}, Position: 2, Type: TypeInt, Required: true},
+	{Field: "rate", Position: 3, Type: TypeNumber, Default: "1.5"},
+	{Field: "active", Type: TypeBool, Default: "true"},
+	{Field: "since", Type: TypeDate},
+}}
+
+func TestRecordsByHeader(t *testing.T) {
+	sheets := []Sheet{{Name: "prices", Rows: [][]string{
+		{"Since", "ชื่อสินค้า", "Value THB", "Rate"},
+		{"2024-01-31", " Rice ", "1,200", ""},
+		{"", "", "", ""},
+		{"", "Tea", "2023.0", "2"},
+	}}}
+
+	records, err := testMapping.Records(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2, the blank row is skipped", len(records))
+	}
+
+	rice := records[0]
+	want := map[string]interface{}{
+		"productName": "Rice",
+		"valueTHB":    1200,
+		"rate":        1.5,
+		"active":      true,
+		"since":       time.Date(2024, 1, 31, 0, 0, 0, 0, time.UTC),
+	}
+	if !reflect.DeepEqual(rice.Values, want) {
+		t.Errorf("values = %v, want %v", rice.Values, want)
+	}
+	if rice.Sheet != "prices" || rice.Line != 2 || rice.Checksum == "" {
+		t.Errorf("record = %+v, want line 2 of sheet prices", rice)
+	}
+
+	tea := records[1]
+	if tea.Line != 4 || tea.Values["valueTHB"] != 2023 || tea.Values["rate"] != 2.0 {
+		t.Errorf("tea = %+v", tea)
+	}
+	if _, ok := tea.Values["since"]; ok {
+		t.Error("a blank cell without a default is set")
+	}
+}
+
+func TestRecordsByPosition(t *testing.T) {
+	sheets := []Sheet{{Name: "prices", Rows: [][]string{
+		{"Rice", "100", "2"},
+		{"Tea", "50"},
+	}}}
+
+	records, err := testMapping.Records(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 || records[0].Line != 1 {
+		t.Fatalf("records = %+v, want both rows from line 1", records)
+	}
+	if records[1].Values["productName"] != "Tea" || records[1].Values["rate"] != 1.5 {
+		t.Errorf("tea = %v", records[1].Values)
+	}
+}
+
+func TestRecordsConversionErrors(t *testing.T) {
+	sheets := []Sheet{{Name: "prices", Rows: [][]string{
+		{"productName", "valueTHB", "since", "active"},
+		{"Rice", "12.5", "31 Jan", "maybe"},
+	}}}
+
+	records, err := testMapping.Records(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rules := map[string]string{}
+	for _, e := range records[0].Errors {
+		rules[e.Field] = e.Rule
+	}
+	want := map[string]string{"valueTHB": TypeInt, "since": TypeDate, "active": TypeBool}
+	if !reflect.DeepEqual(rules, want) {
+		t.Errorf("errors = %v, want %v", rules, want)
+	}
+	if records[0].Values["productName"] != "Rice" {
+		t.Errorf("the readable cells are not kept: %v", records[0].Values)
+	}
+}
+
+func TestRecordsMissingColumn(t *testing.T) {
+	sheets := []Sheet{{Name: "prices", Rows: [][]string{
+		{"productName", "rate"},
+		{"Rice", "1"},
+	}}}
+
+	_, err := testMapping.Records(sheets)
+	if err == nil || !strings.Contains(err.Error(), "valueTHB") {
+		t.Errorf("error = %v, want valueTHB missing", err)
+	}
+}
+
+func TestRecordsEmpty(t *testing.T) {
+	sheets := []Sheet{{Name: "prices", Rows: [][]string{{"productName", "valueTHB"}, {" ", ""}}}}
+
+	if _, err := testMapping.Records(sheets); err != ErrEmptyFile {
+		t.Errorf("error = %v, want ErrEmptyFile", err)
+	}
+}
+
+func TestRecordsSheets(t *testing.T) {
+	sheets := []Sheet{
+		{Name: "2023", Rows: [][]string{{"productName", "valueTHB"}, {"Rice", "1"}}},
+		{Name: "2024", Rows: [][]string{{"productName", "valueTHB"}, {"Tea", "2"}, {"Salt", "3"}}},
+	}
+
+	tests := []struct {
+		name   string
+		sheets []string
+		want   []string
+		err    bool
+	}{
+		{"first sheet by default", nil, []string{"2023"}, false},
+		{"every sheet", []string{AllSheets}, []string{"2023", "2024", "2024"}, false},
+		{"named sheets", []string{"2024"}, []string{"2024", "2024"}, false},
+		{"unknown sheet", []string{"2025"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := testMapping
+			m.Sheets = tt.sheets
+
+			records, err := m.Records(sheets)
+			if (err != nil) != tt.err {
+				t.Fatalf("Records error = %v, want error %v", err, tt.err)
+			}
+
+			got := []string{}
+			for _, r := range records {
+				got = append(got, r.Sheet)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("sheets of the records = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDefaultMappingsReadThaiHeaders(t *testing.T) {
+	sheets := []Sheet{{Name: "exports", Rows: [][]string{
+		{"ประเทศ", "หมวดสินค้า", "สินค้า", "ขนาดกิจการ", "มูลค่าบาท", "มูลค่าดอลลาร์", "เดือน", "ปี"},
+		{"Japan", "Food", "Rice", "Small", "1000", "30", "1", "2024"},
+	}}}
+
+	records, err := DefaultMappings()["exports"].Records(sheets)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	export, errs := ParseExport(records[0])
+	if errs != nil {
+		t.Fatal(errs)
+	}
+	if export.Country != "Japan" || export.Category != "Food" || export.ProductName != "Rice" || export.ValueTHB != 1000 || export.Year != 2024 {
+		t.Errorf("export = %+v", export)
+	}
+	if export.ID.IsZero() || export.CreatedAt == nil {
+		t.Error("the export has no id or creation time")
+	}
+}
+
+func TestDecodeTypeError(t *testing.T) {
+	m := Mapping{Columns: []Column{{Field: "productName"}, {Field: "valueTHB"}}}
+	records, err := m.Records([]Sheet{{Name: "products", Rows: [][]string{{"productName", "valueTHB"}, {"Rice", "many"}}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, errs := ParseProduct(records[0])
+	if len(errs) != 1 || errs[0].Field != "valueTHB" || errs[0].Rule != "type" {
+		t.Errorf("errors = %v, want the type of valueTHB", errs)
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		name string
+		m    Mapping
+		err  string
+	}{
+		{"valid", testMapping, ""},
+		{"no columns", Mapping{}, "no columns"},
+		{"no field", Mapping{Columns: []Column{{Headers: []string{"name"}}}}, "needs a field"},
+		{"mapped twice", Mapping{Columns: []Column{{Field: "name"}, {Field: "name"}}}, "mapped twice"},
+		{"negative position", Mapping{Columns: []Column{{Field: "name", Position: -1}}}, "position"},
+		{"unknown type", Mapping{Columns: []Column{{Field: "name", Type: "text"}}}, "type of name"},
+		{"bad default", Mapping{Columns: []Column{{Field: "year", Type: TypeInt, Default: "soon"}}}, "default of year"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.m.Check()
+			if tt.err == "" && err != nil || tt.err != "" && (err == nil || !strings.Contains(err.Error(), tt.err)) {
+				t.Errorf("Check() = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestLoadMappings(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "mappings.json")
+	data := `{"exports": {"sheets": ["*"], "columns": [{"field": "country", "headers": ["nation"]}]}, "prices": {"columns": [{"field": "price", "type": "number"}]}}`
+	if err := os.WriteFile(path, []byte(data), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	mappings, err := LoadMappings(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mappings["exports"].Columns) != 1 || mappings["exports"].Sheets[0] != AllSheets {
+		t.Errorf("exports = %+v, want the mapping of the file", mappings["exports"])
+	}
+	if _, ok := mappings["products"]; !ok {
+		t.Error("the default products mapping is dropped")
+	}
+	if mappings["prices"].Columns[0].Type != TypeNumber {
+		t.Errorf("prices = %+v", mappings["prices"])
+	}
+
+	if err := os.WriteFile(path, []byte(`{"bad": {"columns": []}}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadMappings(path); err == nil || !strings.Contains(err.Error(), "mapping bad") {
+		t.Errorf("error = %v, want mapping bad rejected", err)
+	}
+}
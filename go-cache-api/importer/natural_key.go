@@ -0,0 +1,140 @@
+package importer
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"go-cache-api/models"
+	"go-cache-api/validation"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NaturalKey is the fields identifying an export row apart from its id. Two
+// exports can not share all of them, an imported row matching an export on
+// the key updates it instead of adding a copy
+type NaturalKey struct {
+	// Fields are the json names of the key, Keys their bson names
+	Fields []string
+	Keys   []string
+}
+
+// keyFields are the fields of an export a key can be made of, the ones
+// written by the API itself are left out
+var keyFields = []string{"country", "category", "productName", "businessSize", "valueTHB", "valueUSD", "month", "year", "productId"}
+
+// DefaultNaturalKey is the natural key of exports unless another one is configured
+var DefaultNaturalKey = []string{"country", "productName", "month", "year"}
+
+// NewNaturalKey returns the key made of fields, named as in the json of an export
+func NewNaturalKey(fields []string) (NaturalKey, error) {
+	bsonNames := map[string]string{}
+	t := reflect.TypeOf(models.ExportData{})
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		bsonNames[strings.Split(f.Tag.Get("json"), ",")[0]] = strings.Split(f.Tag.Get("bson"), ",")[0]
+	}
+
+	k := NaturalKey{}
+	for _, field := range fields {
+		if !isKeyField(field) {
+			return NaturalKey{}, fmt.Errorf("%s can not be part of the natural key of exports, use %s", field, strings.Join(keyFields, ", "))
+		}
+		k.Fields = append(k.Fields, field)
+		k.Keys = append(k.Keys, bsonNames[field])
+	}
+	if len(k.Fields) == 0 {
+		return NaturalKey{}, fmt.Errorf("the natural key of exports has no field")
+	}
+	return k, nil
+}
+
+func isKeyField(field string) bool {
+	for _, f := range keyFields {
+		if f == field {
+			return true
+		}
+	}
+	return false
+}
+
+// Index is the key of the unique index backing k
+func (k NaturalKey) Index() bson.D {
+	index := bson.D{}
+	for _, key := range k.Keys {
+		index = append(index, bson.E{Key: key, Value: 1})
+	}
+	return index
+}
+
+// Filter matches the export sharing the key of export. A field missing from
+// export matches a missing field, as the unique index does
+func (k NaturalKey) Filter(export models.ExportData) (bson.M, error) {
+	data, err := bson.Marshal(export)
+	if err != nil {
+		return nil, err
+	}
+	var doc bson.M
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{}
+	for _, key := range k.Keys {
+		filter[key] = doc[key]
+	}
+	return filter, nil
+}
+
+// Value is the key of export as text, equal for exports sharing the key
+func (k NaturalKey) Value(export models.ExportData) string {
+	v := reflect.ValueOf(export)
+	t := v.Type()
+
+	parts := []string{}
+	for _, field := range k.Fields {
+		for i := 0; i < t.NumField(); i++ {
+			if strings.Split(t.Field(i).Tag.Get("json"), ",")[0] != field {
+				continue
+			}
+			f := v.Field(i)
+			if f.Kind() == reflect.Ptr {
+				if f.IsNil() {
+					parts = append(parts, "")
+					continue
+				}
+				f = f.Elem()
+			}
+			parts = append(parts, fmt.Sprint(f.Interface()))
+		}
+	}
+	return strings.Join(parts, "\x00")
+}
+
+// String names the fields of k, for messages
+func (k NaturalKey) String() string {
+	return strings.Join(k.Fields, ", ")
+}
+
+// Duplicates finds the records repeating the key of an earlier record, it
+// maps the index of each to the index of the first record with its key.
+// Records that would be rejected are left out
+func Duplicates(k NaturalKey, records []Record) map[int]int {
+	first := map[string]int{}
+	duplicates := map[int]int{}
+	for i, record := range records {
+		export, errs := ParseExport(record)
+		if errs != nil || validation.Struct(export) != nil {
+			continue
+		}
+
+		value := k.Value(export)
+		if j, ok := first[value]; ok {
+			duplicates[i] = j
+			continue
+		}
+		first[value] = i
+	}
+	return duplicates
+}
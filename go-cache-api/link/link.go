@@ -0,0 +1,125 @@
+// Package link links exports to their product. An export names its product
+// by productId, the exports written before that are matched to the product
+// with the same name, category and business size
+package link
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"go-cache-api/repository"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Key is what an export without productId is matched to its product on
+type Key struct {
+	ProductName  string `bson:"productName"`
+	Category     string `bson:"category"`
+	BusinessSize string `bson:"businessSize"`
+}
+
+// Matcher finds products by Key, remembering what it found
+type Matcher struct {
+	products repository.ProductRepository
+	found    map[Key]*primitive.ObjectID
+}
+
+func NewMatcher(products repository.ProductRepository) Matcher {
+	return Matcher{products: products, found: map[Key]*primitive.ObjectID{}}
+}
+
+// Match returns the id of the product of key that is not deleted, nil when
+// there is none
+func (m Matcher) Match(ctx context.Context, key Key) (*primitive.ObjectID, error) {
+	if id, ok := m.found[key]; ok {
+		return id, nil
+	}
+
+	filter := bson.M{
+		"deletedAt":    bson.M{"$exists": false},
+		"productName":  key.ProductName,
+		"category":     key.Category,
+		"businessSize": key.BusinessSize,
+	}
+
+	var product struct {
+		ID primitive.ObjectID `bson:"_id"`
+	}
+	err := m.products.Get(ctx, filter, nil, &product)
+	if err != nil && !errors.Is(err, repository.ErrNotFound) {
+		return nil, err
+	}
+
+	var id *primitive.ObjectID
+	if err == nil {
+		id = &product.ID
+	}
+	m.found[key] = id
+
+	return id, nil
+}
+
+// Exports sets the productId of the exports created before exports
+// referenced products, matching them on name, category and business size.
+// Exports without a matching product are left unlinked
+func Exports(ctx context.Context, exports *mongo.Collection, products repository.ProductRepository) error {
+	cur, err := exports.Aggregate(ctx, []bson.M{
+		{"$match": bson.M{"productId": bson.M{"$exists": false}}},
+		{"$group": bson.M{"_id": bson.M{
+			"productName":  "$productName",
+			"category":     "$category",
+			"businessSize": "$businessSize",
+		}}},
+	})
+	if err != nil {
+		return err
+	}
+
+	var groups []struct {
+		Key Key `bson:"_id"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return err
+	}
+
+	var linked, unmatched int64
+	matcher := NewMatcher(products)
+	for _, group := range groups {
+		id, err := matcher.Match(ctx, group.Key)
+		if err != nil {
+			return err
+		}
+
+		filter := bson.M{
+			"productId":    bson.M{"$exists": false},
+			"productName":  group.Key.ProductName,
+			"category":     group.Key.Category,
+			"businessSize": group.Key.BusinessSize,
+		}
+
+		if id == nil {
+			count, err := exports.CountDocuments(ctx, filter)
+			if err != nil {
+				return err
+			}
+			unmatched += count
+			continue
+		}
+
+		result, err := exports.UpdateMany(ctx, filter, bson.M{"$set": bson.M{"productId": *id}})
+		if err != nil {
+			return err
+		}
+		linked += result.ModifiedCount
+	}
+
+	if linked > 0 || unmatched > 0 {
+		log.Printf("linked %d exports to their product, %d have no matching product", linked, unmatched)
+	}
+
+	return nil
+}
@@ -1,23 +1,123 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"go-cache-api/configs"
+	"go-cache-api/controllers"
+	"go-cache-api/migrations"
+	"go-cache-api/problem"
 	"go-cache-api/routes"
+	"net/http"
+	"os"
+	"os/signal"
+	"shared/health"
+	"shared/migrate"
+	"syscall"
+	"time"
+
 	"github.com/labstack/echo"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// pendingMigrations fails while migrations of db are not applied, the api
+// serves a database it expects to be migrated
+func pendingMigrations(db *mongo.Database, all []migrate.Migration) health.Check {
+	return func(ctx context.Context) error {
+		pending, err := migrate.Pending(ctx, db, all)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations are pending, from version %d", len(pending), pending[0].Version)
+		}
+		return nil
+	}
+}
+
 func main() {
 	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(problem.RequestID)
+
+	cfg, err := configs.Load()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// the handlers share one mongo client and one redis client
+	client := configs.ConnectDB(cfg.Mongo)
+	redisClient := configs.ConnectRedis(cfg.Redis)
+	db := client.Database(cfg.Mongo.Database)
+	h, err := controllers.NewHandler(db, redisClient, cfg.Import)
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	key, err := cfg.Import.Key()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+	all := migrations.All(key)
+
+	checker := health.New()
+	checker.Add("mongo", health.Mongo(client))
+	checker.Add("redis", func(ctx context.Context) error { return redisClient.Ping(ctx).Err() })
+	checker.Add("migrations", pendingMigrations(db, all))
+	routes.HealthRoute(e, checker)
 
-	configs.ConnectDB()
-	routes.ProductRoute(e)
-	routes.ExportRoute(e)
-	routes.ExploreRoutes(e)
+	routes.ProductRoute(e, h, cfg)
+	routes.ExportRoute(e, h, cfg)
+	routes.ImportRoute(e, h, cfg)
+	routes.ExploreRoutes(e, h)
 	routes.UseCaseCache(e)
 
+	if cfg.MigrateOnStart {
+		if _, err := migrate.Run(context.Background(), db, all); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
+
+	// the background jobs stop on SIGTERM or ctrl-c
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if err := h.StartImportJobs(ctx); err != nil {
+		e.Logger.Fatal(err)
+	}
+	h.StartSoftDeletePurge(ctx, 24*time.Hour, cfg.SoftDelete.Retention())
+
+	// file.InsetProductIntoMongo(db, cfg.Import) //แก้ไฟล์
+	// file.InsetExportIntoMongo(db, cfg.Import)	//แก้ไฟล์
+
+	go func() {
+		if err := e.Start(cfg.Server.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	// the probes see the service is not ready while it still serves
+	checker.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
 
-	// file.InsetProductIntoMongo() //แก้ไฟล์
-	// file.InsetExportIntoMongo()	//แก้ไฟล์
+	// the requests in flight and the background jobs finish, then the clients
+	// disconnect, all within the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
 
-	e.Logger.Fatal(e.Start(":8000"))
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
+	if err := h.Wait(shutdownCtx); err != nil {
+		e.Logger.Error("background jobs did not stop: ", err)
+	}
+	if err := redisClient.Close(); err != nil {
+		e.Logger.Error(err)
+	}
+	if err := client.Disconnect(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
 }
@@ -0,0 +1,137 @@
+package migrations
+
+import (
+	"context"
+
+	"go-cache-api/importer"
+	"go-cache-api/link"
+	"go-cache-api/repository"
+	"go-cache-api/search"
+	"shared/migrate"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// All are the migrations of the database, a new migration is added at the end
+// with the next version and an applied one is never changed. key is the
+// configured natural key of exports, its migration is applied again when it
+// changes
+func All(key importer.NaturalKey) []migrate.Migration {
+	return []migrate.Migration{
+		{
+			Version:     1,
+			Description: "index history and import jobs",
+			Indexes: []migrate.Index{
+				{Collection: "history", Keys: bson.D{{Key: "resource", Value: 1}, {Key: "documentId", Value: 1}, {Key: "createdAt", Value: -1}}},
+				{Collection: "imports", Keys: bson.D{{Key: "status", Value: 1}, {Key: "createdAt", Value: 1}}},
+				{
+					Collection: "importRecords",
+					Keys:       bson.D{{Key: "batchId", Value: 1}, {Key: "documentId", Value: 1}},
+					Options:    options.Index().SetUnique(true),
+				},
+			},
+		},
+		{
+			Version:     2,
+			Description: "index the filters and sorts of products and exports",
+			// sorts end with _id so keyset pages are read from the index
+			Indexes: append(append(
+				sortIndexes("products", "productName", "category", "valueTHB", "valueUSD", "createdAt", "updatedAt"),
+				sortIndexes("exports", "productName", "category", "valueTHB", "valueUSD", "country", "month", "year", "createdAt", "updatedAt")...),
+				// products are matched on these when exports are linked
+				migrate.Index{Collection: "products", Keys: bson.D{{Key: "productName", Value: 1}, {Key: "category", Value: 1}, {Key: "businessSize", Value: 1}}},
+				migrate.Index{Collection: "products", Keys: bson.D{{Key: "deletedAt", Value: 1}}},
+				// the default sort of exports, and the country filter with it
+				migrate.Index{Collection: "exports", Keys: bson.D{{Key: "year", Value: -1}, {Key: "month", Value: -1}, {Key: "_id", Value: -1}}},
+				migrate.Index{Collection: "exports", Keys: bson.D{{Key: "country", Value: 1}, {Key: "year", Value: -1}, {Key: "month", Value: -1}}},
+				migrate.Index{Collection: "exports", Keys: bson.D{{Key: "productId", Value: 1}}},
+				migrate.Index{Collection: "exports", Keys: bson.D{{Key: "deletedAt", Value: 1}}},
+				migrate.Index{Collection: "exports", Keys: bson.D{{Key: "import.batchId", Value: 1}}, Options: options.Index().SetSparse(true)},
+			),
+		},
+		{
+			Version:     3,
+			Description: "validate products and exports with JSON Schema",
+			Validators: []migrate.Validator{
+				{Collection: "products", Schema: bson.M{
+					"bsonType": "object",
+					"required": []string{"productName", "businessSize"},
+					"properties": bson.M{
+						"productName":  bson.M{"bsonType": "string", "minLength": 1},
+						"category":     bson.M{"bsonType": "string"},
+						"valueTHB":     numberSchema(0),
+						"valueUSD":     numberSchema(0),
+						"businessSize": bson.M{"bsonType": "string", "minLength": 1},
+					},
+				}},
+				{Collection: "exports", Schema: bson.M{
+					"bsonType": "object",
+					"required": []string{"productName", "category", "businessSize", "country", "month", "year"},
+					"properties": bson.M{
+						"productId":    bson.M{"bsonType": "objectId"},
+						"productName":  bson.M{"bsonType": "string", "minLength": 1},
+						"category":     bson.M{"bsonType": "string", "minLength": 1},
+						"valueTHB":     numberSchema(0),
+						"valueUSD":     numberSchema(0),
+						"businessSize": bson.M{"bsonType": "string", "minLength": 1},
+						"country":      bson.M{"bsonType": "string", "minLength": 1},
+						"month":        bson.M{"bsonType": []string{"int", "long"}, "minimum": 1, "maximum": 12},
+						"year":         bson.M{"bsonType": []string{"int", "long"}, "minimum": 1},
+					},
+				}},
+			},
+		},
+		{
+			Version:     4,
+			Description: "link the exports created before exports referenced products",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return link.Exports(ctx, db.Collection(repository.ExportCollection), repository.NewMongoProducts(db))
+			},
+		},
+		{
+			Version:     5,
+			Description: "dedupe exports on their natural key and index it unique",
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				return uniqueNaturalKey(ctx, db, repository.ExportCollection, key)
+			},
+			Checksum: key.String(),
+		},
+		{
+			Version:     6,
+			Description: "index products and exports for search",
+			Indexes: []migrate.Index{
+				textIndex(repository.ProductCollection, search.ProductWeights),
+				textIndex(repository.ExportCollection, search.ExportWeights),
+			},
+			// the documents written before search was indexed get their terms
+			Up: func(ctx context.Context, db *mongo.Database) error {
+				missing := bson.M{search.Field: bson.M{"$exists": false}}
+				if err := search.Reindex(ctx, db.Collection(repository.ProductCollection), search.ProductWeights, missing); err != nil {
+					return err
+				}
+				return search.Reindex(ctx, db.Collection(repository.ExportCollection), search.ExportWeights, missing)
+			},
+		},
+	}
+}
+
+// sortIndexes indexes every sortable field of a collection with _id
+func sortIndexes(collection string, fields ...string) []migrate.Index {
+	indexes := []migrate.Index{}
+	for _, field := range fields {
+		indexes = append(indexes, migrate.Index{Collection: collection, Keys: bson.D{{Key: field, Value: 1}, {Key: "_id", Value: 1}}})
+	}
+	return indexes
+}
+
+// textIndex is the search index of a collection, see search.TextIndex
+func textIndex(collection string, weights map[string]int32) migrate.Index {
+	keys, opts := search.TextIndex(weights)
+	return migrate.Index{Collection: collection, Keys: keys, Options: opts}
+}
+
+func numberSchema(minimum int) bson.M {
+	return bson.M{"bsonType": []string{"int", "long", "double"}, "minimum": minimum}
+}
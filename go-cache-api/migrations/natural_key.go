@@ -0,0 +1,154 @@
+package migrations
+
+import (
+	"context"
+	"log"
+
+	"go-cache-api/importer"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// naturalKeyIndex is the name of the unique index on the natural key of exports
+	naturalKeyIndex = "naturalKey"
+	// duplicateCollection keeps the exports removed because they repeated the
+	// natural key of another export
+	duplicateCollection = "exportDuplicates"
+)
+
+// uniqueNaturalKey makes the natural key of exports unique. The exports
+// sharing a key are deduped first, the one kept is the most recently
+// updated of the ones not deleted
+func uniqueNaturalKey(ctx context.Context, db *mongo.Database, collection string, key importer.NaturalKey) error {
+	exports := db.Collection(collection)
+
+	// an index left by another key would reject the exports the key keeps apart
+	if err := dropOtherIndex(ctx, exports, naturalKeyIndex, key.Index()); err != nil {
+		return err
+	}
+
+	duplicates, err := duplicateExports(ctx, exports, key)
+	if err != nil {
+		return err
+	}
+	if err := moveDocuments(ctx, exports, db.Collection(duplicateCollection), duplicates); err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		log.Printf("moved %d exports sharing the natural key %s to %s", len(duplicates), key, duplicateCollection)
+	}
+
+	_, err = exports.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    key.Index(),
+		Options: options.Index().SetName(naturalKeyIndex).SetUnique(true),
+	})
+	return err
+}
+
+// dropOtherIndex drops the index name unless its keys are keys
+func dropOtherIndex(ctx context.Context, coll *mongo.Collection, name string, keys bson.D) error {
+	specs, err := coll.Indexes().ListSpecifications(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, spec := range specs {
+		if spec.Name != name {
+			continue
+		}
+
+		var existing bson.D
+		if err := bson.Unmarshal(spec.KeysDocument, &existing); err != nil {
+			return err
+		}
+		if sameIndexKeys(existing, keys) {
+			return nil
+		}
+		_, err := coll.Indexes().DropOne(ctx, name)
+		return err
+	}
+	return nil
+}
+
+func sameIndexKeys(a, b bson.D) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i].Key != b[i].Key {
+			return false
+		}
+	}
+	return true
+}
+
+// duplicateExports returns the ids of the exports repeating the key of
+// another export. A missing field is the same as null, like in the index
+func duplicateExports(ctx context.Context, exports *mongo.Collection, key importer.NaturalKey) ([]interface{}, error) {
+	group := bson.M{}
+	for _, k := range key.Keys {
+		group[k] = bson.M{"$ifNull": bson.A{"$" + k, nil}}
+	}
+
+	cur, err := exports.Aggregate(ctx, []bson.M{
+		// the export kept comes first, deleted ones last as a missing deletedAt sorts first
+		{"$sort": bson.D{{Key: "deletedAt", Value: 1}, {Key: "updatedAt", Value: -1}, {Key: "_id", Value: -1}}},
+		{"$group": bson.M{"_id": group, "ids": bson.M{"$push": "$_id"}, "count": bson.M{"$sum": 1}}},
+		{"$match": bson.M{"count": bson.M{"$gt": 1}}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var groups []struct {
+		IDs []interface{} `bson:"ids"`
+	}
+	if err := cur.All(ctx, &groups); err != nil {
+		return nil, err
+	}
+
+	duplicates := []interface{}{}
+	for _, g := range groups {
+		duplicates = append(duplicates, g.IDs[1:]...)
+	}
+	return duplicates, nil
+}
+
+// moveDocuments copies the documents of ids to target then deletes them, a
+// run stopped midway copies them again
+func moveDocuments(ctx context.Context, source *mongo.Collection, target *mongo.Collection, ids []interface{}) error {
+	for start := 0; start < len(ids); start += 500 {
+		end := start + 500
+		if end > len(ids) {
+			end = len(ids)
+		}
+		batch := ids[start:end]
+
+		cur, err := source.Find(ctx, bson.M{"_id": bson.M{"$in": batch}})
+		if err != nil {
+			return err
+		}
+		var docs []bson.M
+		if err := cur.All(ctx, &docs); err != nil {
+			return err
+		}
+
+		writes := []mongo.WriteModel{}
+		for _, doc := range docs {
+			writes = append(writes, mongo.NewReplaceOneModel().SetFilter(bson.M{"_id": doc["_id"]}).SetReplacement(doc).SetUpsert(true))
+		}
+		if len(writes) > 0 {
+			if _, err := target.BulkWrite(ctx, writes); err != nil {
+				return err
+			}
+		}
+
+		if _, err := source.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": batch}}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
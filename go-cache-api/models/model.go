@@ -1,21 +1,29 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
+	"go-cache-api/validation"
+
+	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type Product struct {
 	ID           primitive.ObjectID `json:"id" bson:"_id"`
-	ProductName  string             `json:"productName" bson:"productName"`
+	ProductName  string             `json:"productName" bson:"productName" validate:"required"`
 	Category     string             `json:"category" bson:"category"`
-	ValueTHB     int                `json:"valueTHB" bson:"valueTHB"`
-	ValueUSD     int                `json:"valueUSD" bson:"valueUSD"`
-	BusinessSize string             `json:"businessSize" bson:"businessSize"`
+	ValueTHB     int                `json:"valueTHB" bson:"valueTHB" validate:"gte=0"`
+	ValueUSD     int                `json:"valueUSD" bson:"valueUSD" validate:"gte=0"`
+	BusinessSize string             `json:"businessSize" bson:"businessSize" validate:"required"`
 	CreatedAt    *time.Time         `json:"createdAt" bson:"createdAt"`
 	UpdatedAt    *time.Time         `json:"updatedAt" bson:"updatedAt"`
-	//deletedAt
+	DeletedAt    *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Import is the import that inserted the product, it is only set by imports
+	Import *ImportLineage `json:"import,omitempty" bson:"import,omitempty"`
+	// Score is the relevance of a search result, it is never stored
+	Score float64 `json:"score,omitempty" bson:"score,omitempty" validate:"isdefault"`
 }
 
 type Export struct {
@@ -26,32 +34,173 @@ type Export struct {
 	Year      int                `json:"year" bson:"year"`
 	CreatedAt *time.Time         `json:"createdAt" bson:"createdAt"`
 	UpdatedAt *time.Time         `json:"updatedAt" bson:"updatedAt"`
-	//deletedAt
+	DeletedAt *time.Time         `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
 }
 
+// ExportData is an export row, the product fields are copied from the product
+// it references so exports can be filtered and explored on their own
 type ExportData struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	ProductName  string             `json:"productName" bson:"productName"`
-	Category     string             `json:"category" bson:"category"`
-	ValueTHB     int                `json:"valueTHB" bson:"valueTHB"`
-	ValueUSD     int                `json:"valueUSD" bson:"valueUSD"`
-	BusinessSize string             `json:"businessSize" bson:"businessSize"`
-	Country      string             `json:"country" bson:"country"`
-	Month        int                `json:"month" bson:"month"`
-	Year         int                `json:"year" bson:"year"`
-	CreatedAt    *time.Time         `json:"createdAt" bson:"createdAt"`
-	UpdatedAt    *time.Time         `json:"updatedAt" bson:"updatedAt"`
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductId    *primitive.ObjectID `json:"productId,omitempty" bson:"productId,omitempty"`
+	ProductName  string              `json:"productName" bson:"productName" validate:"required"`
+	Category     string              `json:"category" bson:"category" validate:"required"`
+	ValueTHB     int                 `json:"valueTHB" bson:"valueTHB" validate:"gte=0"`
+	ValueUSD     int                 `json:"valueUSD" bson:"valueUSD" validate:"gte=0"`
+	BusinessSize string              `json:"businessSize" bson:"businessSize" validate:"required"`
+	Country      string              `json:"country" bson:"country" validate:"required"`
+	Month        int                 `json:"month" bson:"month" validate:"required,min=1,max=12"`
+	Year         int                 `json:"year" bson:"year" validate:"required,min=1"`
+	CreatedAt    *time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    *time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeletedAt    *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	// Import is the import that last wrote the export, it is only set by imports
+	Import *ImportLineage `json:"import,omitempty" bson:"import,omitempty"`
+	// Score is the relevance of a search result, it is never stored
+	Score float64 `json:"score,omitempty" bson:"score,omitempty" validate:"isdefault"`
 }
 
+// ImportLineage is where an imported document comes from
+type ImportLineage struct {
+	// BatchID is the id of the import job
+	BatchID  primitive.ObjectID `json:"batchId" bson:"batchId"`
+	Filename string             `json:"filename" bson:"filename"`
+	Sheet    string             `json:"sheet,omitempty" bson:"sheet,omitempty"`
+	// Row is the line of the row in its sheet, the header is line 1
+	Row int `json:"row" bson:"row"`
+	// Checksum is the sha256 of the cells of the row
+	Checksum string `json:"checksum" bson:"checksum"`
+}
+
+// ExportWithProduct is an export with its product joined by $lookup, product
+// is null when the export is not linked or its product is deleted. The product
+// fields of the export are kept for the exports without a product
 type ExportWithProduct struct {
-	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Product   Product            `json:"product" bson:"product"`
-	Country   string             `json:"country" bson:"country"`
-	Month     int                `json:"month" bson:"month"`
-	Year      int                `json:"year" bson:"year"`
-	CreatedAt *time.Time         `json:"createdAt" bson:"createdAt"`
-	UpdatedAt *time.Time         `json:"updatedAt" bson:"updatedAt"`
-	//deletedAt
+	ID           primitive.ObjectID  `json:"id" bson:"_id,omitempty"`
+	ProductId    *primitive.ObjectID `json:"productId,omitempty" bson:"productId,omitempty"`
+	Product      *Product            `json:"product" bson:"product"`
+	ProductName  string              `json:"productName" bson:"productName"`
+	Category     string              `json:"category" bson:"category"`
+	ValueTHB     int                 `json:"valueTHB" bson:"valueTHB"`
+	ValueUSD     int                 `json:"valueUSD" bson:"valueUSD"`
+	BusinessSize string              `json:"businessSize" bson:"businessSize"`
+	Country      string              `json:"country" bson:"country"`
+	Month        int                 `json:"month" bson:"month"`
+	Year         int                 `json:"year" bson:"year"`
+	CreatedAt    *time.Time          `json:"createdAt" bson:"createdAt"`
+	UpdatedAt    *time.Time          `json:"updatedAt" bson:"updatedAt"`
+	DeletedAt    *time.Time          `json:"deletedAt,omitempty" bson:"deletedAt,omitempty"`
+	Import       *ImportLineage      `json:"import,omitempty" bson:"import,omitempty"`
+	Score        float64             `json:"score,omitempty" bson:"score,omitempty"`
+}
+
+// bulk write
+type BulkRequest struct {
+	// Ordered stops at the first failing operation, it defaults to true
+	Ordered    *bool           `json:"ordered,omitempty"`
+	Operations []BulkOperation `json:"operations"`
+}
+
+// BulkOperation is one of insert, update, upsert or delete. Update takes the
+// fields to change in document, a null field is removed
+type BulkOperation struct {
+	Op       string          `json:"op"`
+	ID       string          `json:"id,omitempty"`
+	Document json.RawMessage `json:"document,omitempty"`
+	// Hard deletes the document instead of moving it to the trash
+	Hard bool `json:"hard,omitempty"`
+}
+
+// History is one entry of the audit trail of a product or an export
+type History struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	Resource   string             `json:"resource" bson:"resource"`
+	DocumentID primitive.ObjectID `json:"documentId" bson:"documentId"`
+	// Action is create, update, delete, restore, revert, purge, import or rollback
+	Action    string        `json:"action" bson:"action"`
+	Actor     string        `json:"actor" bson:"actor"`
+	RequestID string        `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	Changes   []FieldChange `json:"changes" bson:"changes"`
+	// Snapshot is the document as this version left it, the deleted document for a hard delete
+	Snapshot bson.M `json:"snapshot" bson:"snapshot"`
+	// RevertedFrom is the history entry a revert restored
+	RevertedFrom *primitive.ObjectID `json:"revertedFrom,omitempty" bson:"revertedFrom,omitempty"`
+	CreatedAt    time.Time           `json:"createdAt" bson:"createdAt"`
+}
+
+// FieldChange is the old and new value of a field, a missing value is null
+type FieldChange struct {
+	Field string      `json:"field" bson:"field"`
+	Old   interface{} `json:"old" bson:"old"`
+	New   interface{} `json:"new" bson:"new"`
+}
+
+// ImportJob is an import running in the background. The uploaded file is kept
+// until the job ends so an interrupted job resumes from Processed
+type ImportJob struct {
+	ID       primitive.ObjectID `json:"id" bson:"_id"`
+	Resource string             `json:"resource" bson:"resource"`
+	Filename string             `json:"filename" bson:"filename"`
+	FileID   primitive.ObjectID `json:"-" bson:"fileId"`
+	// Mapping is the importer mapping the file is read with
+	Mapping bson.Raw `json:"-" bson:"mapping"`
+	// Status is queued, running, completed, failed, cancelled or rolledBack
+	Status string `json:"status" bson:"status"`
+	// TotalRows is the number of rows under the header, Processed the ones already handled
+	TotalRows int `json:"totalRows" bson:"totalRows"`
+	Processed int `json:"processed" bson:"processed"`
+	Inserted  int `json:"inserted" bson:"inserted"`
+	Updated   int `json:"updated" bson:"updated"`
+	Unchanged int `json:"unchanged" bson:"unchanged"`
+	// Conflicting rows share their natural key with an earlier row of the file
+	Conflicting int `json:"conflicting" bson:"conflicting"`
+	Failed      int `json:"failed" bson:"failed"`
+	// Errors are the first rejected and conflicting rows, Failed and
+	// Conflicting count all of them
+	Errors []ImportRowError `json:"errors" bson:"errors"`
+	// Error is why the job failed
+	Error           string     `json:"error,omitempty" bson:"error,omitempty"`
+	CancelRequested bool       `json:"cancelRequested" bson:"cancelRequested"`
+	Actor           string     `json:"actor" bson:"actor"`
+	RequestID       string     `json:"requestId,omitempty" bson:"requestId,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt" bson:"createdAt"`
+	StartedAt       *time.Time `json:"startedAt" bson:"startedAt,omitempty"`
+	FinishedAt      *time.Time `json:"finishedAt" bson:"finishedAt,omitempty"`
+	RolledBackAt    *time.Time `json:"rolledBackAt,omitempty" bson:"rolledBackAt,omitempty"`
+	UpdatedAt       time.Time  `json:"updatedAt" bson:"updatedAt"`
+	// Owner is the server running the job. It holds the job until LeaseUntil
+	// and renews the lease while the job runs
+	Owner      string     `json:"owner,omitempty" bson:"owner,omitempty"`
+	LeaseUntil *time.Time `json:"leaseUntil,omitempty" bson:"leaseUntil,omitempty"`
+}
+
+// ImportRecord is a document an import batch inserted or updated, with the
+// document it overwrote so the batch can be rolled back
+type ImportRecord struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id"`
+	BatchID    primitive.ObjectID `json:"batchId" bson:"batchId"`
+	Resource   string             `json:"resource" bson:"resource"`
+	DocumentID primitive.ObjectID `json:"documentId" bson:"documentId"`
+	// Action is inserted or updated
+	Action string        `json:"action" bson:"action"`
+	Source ImportLineage `json:"source" bson:"source"`
+	// Before is the document the update overwrote, nil for an insert
+	Before bson.M `json:"before,omitempty" bson:"before,omitempty"`
+	// WrittenAt is the updatedAt the import gave the document, a document
+	// updated since is left alone by a rollback
+	WrittenAt time.Time `json:"writtenAt" bson:"writtenAt"`
+	// Rollback is rolledBack or skipped once the batch is rolled back
+	Rollback       string     `json:"rollback,omitempty" bson:"rollback,omitempty"`
+	RollbackReason string     `json:"rollbackReason,omitempty" bson:"rollbackReason,omitempty"`
+	RolledBackAt   *time.Time `json:"rolledBackAt,omitempty" bson:"rolledBackAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt" bson:"createdAt"`
+}
+
+// ImportRowError is a rejected row of an import job
+type ImportRowError struct {
+	Sheet string `json:"sheet,omitempty" bson:"sheet,omitempty"`
+	// Row is the line of the row in its sheet, the header is line 1
+	Row    int               `json:"row" bson:"row"`
+	Errors validation.Errors `json:"errors" bson:"errors"`
 }
 
 // explore
@@ -95,11 +244,14 @@ type Explores struct {
 	Results        []interface{} `json:"results"`
 }
 
-// Exception model or error response
+// Exception model or error response, an RFC 7807 problem details object
 type Exception struct {
-	Code   string `json:"code,omitempty"`
-	Type   string `json:"type,omitempty"`
-	Title  string `json:"title,omitempty"`
-	Status *int   `json:"status,omitempty"`
-	Detail string `json:"detail,omitempty"`
+	Code      string      `json:"code,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Title     string      `json:"title,omitempty"`
+	Status    *int        `json:"status,omitempty"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
 }
@@ -0,0 +1,333 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+const (
+	MergePatchType = "application/merge-patch+json"
+	JSONPatchType  = "application/json-patch+json"
+)
+
+// Operation is one operation of an RFC 6902 JSON Patch document
+type Operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from,omitempty"`
+	Value json.RawMessage `json:"value,omitempty"`
+}
+
+// Apply applies body to doc according to contentType, either a merge patch or a JSON Patch.
+// doc is a decoded JSON document and is not modified
+func Apply(doc map[string]interface{}, contentType string, body []byte) (map[string]interface{}, error) {
+	target := deepCopy(doc).(map[string]interface{})
+
+	switch strings.TrimSpace(strings.Split(contentType, ";")[0]) {
+	case MergePatchType:
+		var p interface{}
+		if err := json.Unmarshal(body, &p); err != nil {
+			return nil, errors.New("merge patch is not valid JSON")
+		}
+
+		result, ok := MergePatch(target, p).(map[string]interface{})
+		if !ok {
+			return nil, errors.New("merge patch should be a JSON object")
+		}
+		return result, nil
+
+	case JSONPatchType:
+		var ops []Operation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return nil, errors.New("JSON patch should be an array of operations")
+		}
+
+		result, err := JSONPatch(target, ops)
+		if err != nil {
+			return nil, err
+		}
+
+		obj, ok := result.(map[string]interface{})
+		if !ok {
+			return nil, errors.New("JSON patch should keep the document an object")
+		}
+		return obj, nil
+	}
+
+	return nil, ErrUnsupportedMediaType
+}
+
+// ErrUnsupportedMediaType is returned by Apply for anything else than a merge patch or a JSON patch
+var ErrUnsupportedMediaType = fmt.Errorf("Content-Type should be %s or %s", MergePatchType, JSONPatchType)
+
+// MergePatch applies an RFC 7396 merge patch to target. A null member removes
+// the field, objects are merged recursively and anything else replaces the target
+func MergePatch(target interface{}, patch interface{}) interface{} {
+	p, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	t, ok := target.(map[string]interface{})
+	if !ok {
+		t = map[string]interface{}{}
+	}
+
+	for k, v := range p {
+		if v == nil {
+			delete(t, k)
+			continue
+		}
+		t[k] = MergePatch(t[k], v)
+	}
+
+	return t
+}
+
+// JSONPatch applies the operations of an RFC 6902 JSON Patch in order, it
+// stops on the first failing operation
+func JSONPatch(doc interface{}, ops []Operation) (interface{}, error) {
+	var err error
+
+	for i, op := range ops {
+		doc, err = applyOperation(doc, op)
+		if err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %s", i, op.Op, op.Path, err.Error())
+		}
+	}
+
+	return doc, nil
+}
+
+func applyOperation(doc interface{}, op Operation) (interface{}, error) {
+	path, err := parsePointer(op.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return nil, errors.New("value is required")
+		}
+
+		var value interface{}
+		if err := json.Unmarshal(op.Value, &value); err != nil {
+			return nil, errors.New("value is not valid JSON")
+		}
+
+		switch op.Op {
+		case "add":
+			return add(doc, path, value)
+		case "replace":
+			// the empty path is the whole document, it is replaced by value
+			if len(path) == 0 {
+				return value, nil
+			}
+			if doc, err = remove(doc, path); err != nil {
+				return nil, err
+			}
+			return add(doc, path, value)
+		default:
+			current, err := get(doc, path)
+			if err != nil {
+				return nil, err
+			}
+			if !equalJSON(current, value) {
+				return nil, errors.New("test failed")
+			}
+			return doc, nil
+		}
+
+	case "remove":
+		return remove(doc, path)
+
+	case "move", "copy":
+		from, err := parsePointer(op.From)
+		if err != nil {
+			return nil, err
+		}
+
+		value, err := get(doc, from)
+		if err != nil {
+			return nil, err
+		}
+
+		if op.Op == "move" {
+			if strings.HasPrefix(op.Path+"/", op.From+"/") && op.Path != op.From {
+				return nil, errors.New("can not move a value into one of its children")
+			}
+			if doc, err = remove(doc, from); err != nil {
+				return nil, err
+			}
+		} else {
+			value = deepCopy(value)
+		}
+
+		return add(doc, path, value)
+	}
+
+	return nil, fmt.Errorf("not support operation '%s'", op.Op)
+}
+
+// parsePointer splits an RFC 6901 JSON pointer into its unescaped tokens
+func parsePointer(pointer string) ([]string, error) {
+	if pointer == "" {
+		return []string{}, nil
+	}
+
+	if !strings.HasPrefix(pointer, "/") {
+		return nil, fmt.Errorf("invalid path '%s'", pointer)
+	}
+
+	tokens := strings.Split(pointer[1:], "/")
+	for i, t := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+	}
+
+	return tokens, nil
+}
+
+func get(doc interface{}, path []string) (interface{}, error) {
+	for _, token := range path {
+		switch node := doc.(type) {
+		case map[string]interface{}:
+			v, ok := node[token]
+			if !ok {
+				return nil, fmt.Errorf("path '%s' does not exist", token)
+			}
+			doc = v
+		case []interface{}:
+			i, err := arrayIndex(token, len(node)-1)
+			if err != nil {
+				return nil, err
+			}
+			doc = node[i]
+		default:
+			return nil, fmt.Errorf("path '%s' does not exist", token)
+		}
+	}
+
+	return doc, nil
+}
+
+func add(doc interface{}, path []string, value interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+		return doc, nil
+	case []interface{}:
+		i := len(node)
+		if last != "-" {
+			if i, err = arrayIndex(last, len(node)); err != nil {
+				return nil, err
+			}
+		}
+
+		arr := append(node[:i:i], append([]interface{}{value}, node[i:]...)...)
+		return replaceParent(doc, path[:len(path)-1], arr)
+	}
+
+	return nil, fmt.Errorf("can not add '%s' to a scalar", last)
+}
+
+func remove(doc interface{}, path []string) (interface{}, error) {
+	if len(path) == 0 {
+		return nil, errors.New("can not remove the whole document")
+	}
+
+	parent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		if _, ok := node[last]; !ok {
+			return nil, fmt.Errorf("path '%s' does not exist", last)
+		}
+		delete(node, last)
+		return doc, nil
+	case []interface{}:
+		i, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+
+		arr := append(node[:i:i], node[i+1:]...)
+		return replaceParent(doc, path[:len(path)-1], arr)
+	}
+
+	return nil, fmt.Errorf("path '%s' does not exist", last)
+}
+
+// replaceParent stores arr at path, arrays are values so they are written back after being resized
+func replaceParent(doc interface{}, path []string, arr []interface{}) (interface{}, error) {
+	if len(path) == 0 {
+		return arr, nil
+	}
+
+	grandParent, err := get(doc, path[:len(path)-1])
+	if err != nil {
+		return nil, err
+	}
+	last := path[len(path)-1]
+
+	switch node := grandParent.(type) {
+	case map[string]interface{}:
+		node[last] = arr
+	case []interface{}:
+		i, err := arrayIndex(last, len(node)-1)
+		if err != nil {
+			return nil, err
+		}
+		node[i] = arr
+	}
+
+	return doc, nil
+}
+
+func arrayIndex(token string, max int) (int, error) {
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max || (len(token) > 1 && token[0] == '0') {
+		return 0, fmt.Errorf("invalid array index '%s'", token)
+	}
+	return i, nil
+}
+
+func equalJSON(a, b interface{}) bool {
+	return reflect.DeepEqual(a, b)
+}
+
+func deepCopy(v interface{}) interface{} {
+	switch node := v.(type) {
+	case map[string]interface{}:
+		m := make(map[string]interface{}, len(node))
+		for k, e := range node {
+			m[k] = deepCopy(e)
+		}
+		return m
+	case []interface{}:
+		arr := make([]interface{}, len(node))
+		for i, e := range node {
+			arr[i] = deepCopy(e)
+		}
+		return arr
+	}
+	return v
+}
@@ -0,0 +1,96 @@
+package patch
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+// object decodes a JSON object
+func object(t *testing.T, s string) map[string]interface{} {
+	t.Helper()
+
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("decode %s: %v", s, err)
+	}
+	return m
+}
+
+func TestApply(t *testing.T) {
+	doc := `{"name":"Rice","tags":["a","b"],"size":{"label":"Small","rank":1}}`
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		want        string
+		err         bool
+	}{
+		{"merge sets a field", MergePatchType, `{"name":"Tea"}`, `{"name":"Tea","tags":["a","b"],"size":{"label":"Small","rank":1}}`, false},
+		{"merge null removes", MergePatchType, `{"tags":null}`, `{"name":"Rice","size":{"label":"Small","rank":1}}`, false},
+		{"merge nested", MergePatchType, `{"size":{"rank":null,"label":"Micro"}}`, `{"name":"Rice","tags":["a","b"],"size":{"label":"Micro"}}`, false},
+		{"merge replaces arrays", MergePatchType, `{"tags":["c"]}`, `{"name":"Rice","tags":["c"],"size":{"label":"Small","rank":1}}`, false},
+		{"merge charset", MergePatchType + "; charset=utf-8", `{}`, doc, false},
+		{"merge not an object", MergePatchType, `["name"]`, ``, true},
+		{"merge invalid", MergePatchType, `{`, ``, true},
+		{"add", JSONPatchType, `[{"op":"add","path":"/category","value":"Food"}]`, `{"name":"Rice","category":"Food","tags":["a","b"],"size":{"label":"Small","rank":1}}`, false},
+		{"add to array", JSONPatchType, `[{"op":"add","path":"/tags/1","value":"x"}]`, `{"name":"Rice","tags":["a","x","b"],"size":{"label":"Small","rank":1}}`, false},
+		{"append to array", JSONPatchType, `[{"op":"add","path":"/tags/-","value":"x"}]`, `{"name":"Rice","tags":["a","b","x"],"size":{"label":"Small","rank":1}}`, false},
+		{"remove", JSONPatchType, `[{"op":"remove","path":"/tags/0"}]`, `{"name":"Rice","tags":["b"],"size":{"label":"Small","rank":1}}`, false},
+		{"replace", JSONPatchType, `[{"op":"replace","path":"/size/rank","value":2}]`, `{"name":"Rice","tags":["a","b"],"size":{"label":"Small","rank":2}}`, false},
+		{"replace root", JSONPatchType, `[{"op":"replace","path":"","value":{"name":"Tea"}}]`, `{"name":"Tea"}`, false},
+		{"replace root with a scalar", JSONPatchType, `[{"op":"replace","path":"","value":1}]`, ``, true},
+		{"move", JSONPatchType, `[{"op":"move","from":"/size/label","path":"/label"}]`, `{"name":"Rice","label":"Small","tags":["a","b"],"size":{"rank":1}}`, false},
+		{"move into a child", JSONPatchType, `[{"op":"move","from":"/size","path":"/size/inner"}]`, ``, true},
+		{"copy", JSONPatchType, `[{"op":"copy","from":"/name","path":"/label"}]`, `{"name":"Rice","label":"Rice","tags":["a","b"],"size":{"label":"Small","rank":1}}`, false},
+		{"test passes", JSONPatchType, `[{"op":"test","path":"/name","value":"Rice"},{"op":"remove","path":"/tags"}]`, `{"name":"Rice","size":{"label":"Small","rank":1}}`, false},
+		{"test fails", JSONPatchType, `[{"op":"test","path":"/name","value":"Tea"}]`, ``, true},
+		{"escaped pointer", JSONPatchType, `[{"op":"add","path":"/a~1b~0c","value":1}]`, `{"name":"Rice","a/b~c":1,"tags":["a","b"],"size":{"label":"Small","rank":1}}`, false},
+		{"missing path", JSONPatchType, `[{"op":"remove","path":"/price"}]`, ``, true},
+		{"leading zero index", JSONPatchType, `[{"op":"remove","path":"/tags/01"}]`, ``, true},
+		{"missing value", JSONPatchType, `[{"op":"add","path":"/price"}]`, ``, true},
+		{"unknown op", JSONPatchType, `[{"op":"rename","path":"/name"}]`, ``, true},
+		{"not an array", JSONPatchType, `{"op":"remove","path":"/name"}`, ``, true},
+		{"other media type", "application/json", `{}`, ``, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			original := object(t, doc)
+
+			got, err := Apply(original, tt.contentType, []byte(tt.body))
+			if (err != nil) != tt.err {
+				t.Fatalf("Apply error = %v, want error %v", err, tt.err)
+			}
+			if !reflect.DeepEqual(original, object(t, doc)) {
+				t.Errorf("Apply modified doc: %v", original)
+			}
+			if tt.err {
+				return
+			}
+			if want := object(t, tt.want); !reflect.DeepEqual(got, want) {
+				t.Errorf("Apply = %v, want %v", got, want)
+			}
+		})
+	}
+}
+
+func TestApplyUnsupportedMediaType(t *testing.T) {
+	if _, err := Apply(map[string]interface{}{}, "application/json", []byte(`{}`)); err != ErrUnsupportedMediaType {
+		t.Errorf("error = %v, want ErrUnsupportedMediaType", err)
+	}
+}
+
+func TestJSONPatchStopsAtFailure(t *testing.T) {
+	doc := map[string]interface{}{"name": "Rice"}
+	ops := []Operation{
+		{Op: "remove", Path: "/name"},
+		{Op: "remove", Path: "/name"},
+	}
+
+	_, err := JSONPatch(doc, ops)
+	if err == nil || err.Error() != "operation 1 (remove /name): path 'name' does not exist" {
+		t.Errorf("error = %v, want the failure of operation 1", err)
+	}
+}
@@ -0,0 +1,97 @@
+// Package problem sends the errors of the api as problem details, it is the
+// echo side of the shared problem package
+package problem
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+
+	"go-cache-api/models"
+	shared "shared/problem"
+
+	"github.com/labstack/echo"
+)
+
+// ContentType is the media type of every error response, RFC 7807
+const ContentType = shared.ContentType
+
+// codes of the problems that are more specific than their status
+const (
+	CodeValidation   = shared.CodeValidation
+	CodeDuplicateKey = shared.CodeDuplicateKey
+	CodeTimeout      = shared.CodeTimeout
+	CodeDatabase     = shared.CodeDatabase
+)
+
+// New builds the problem of the request, code defaults to the snake cased status text
+func New(c echo.Context, status int, code string, detail string) *models.Exception {
+	return (*models.Exception)(shared.New(c.Response(), c.Request(), status, code, detail))
+}
+
+// Send writes p as application/problem+json
+func Send(c echo.Context, p *models.Exception) error {
+	return shared.Send(c.Response(), *p.Status, p)
+}
+
+// Write sends a problem with the given status and detail
+func Write(c echo.Context, status int, detail string) error {
+	return Send(c, New(c, status, "", detail))
+}
+
+// Validation sends a 400 listing the broken rules in errors
+func Validation(c echo.Context, errs interface{}) error {
+	p := New(c, http.StatusBadRequest, CodeValidation, "Validation failed")
+	p.Errors = errs
+	return Send(c, p)
+}
+
+// MongoStatus maps a mongo error to its status code and problem code
+func MongoStatus(err error) (int, string) {
+	return shared.MongoStatus(err)
+}
+
+// Mongo sends the problem matching a failed mongo call. detail describes what
+// failed, the error itself is only logged
+func Mongo(c echo.Context, err error, detail string) error {
+	status, code := MongoStatus(err)
+
+	p := New(c, status, code, detail)
+	if status >= http.StatusInternalServerError {
+		log.Printf("request %s: %s: %v", p.RequestID, detail, err)
+	}
+
+	return Send(c, p)
+}
+
+// HTTPErrorHandler is the echo error handler, errors returned by handlers and
+// middlewares are sent as problems too
+func HTTPErrorHandler(err error, c echo.Context) {
+	if c.Response().Committed {
+		return
+	}
+
+	var httpError *echo.HTTPError
+	if errors.As(err, &httpError) {
+		err = Write(c, httpError.Code, fmt.Sprint(httpError.Message))
+	} else if status, code := MongoStatus(err); status != http.StatusInternalServerError {
+		err = Send(c, New(c, status, code, http.StatusText(status)))
+	} else {
+		log.Printf("request %s: %v", shared.RequestID(c.Response(), c.Request()), err)
+		err = Write(c, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+	}
+
+	if err != nil {
+		log.Println("write problem:", err)
+	}
+}
+
+// RequestID is the middleware giving every request an X-Request-ID, the one
+// sent by the client is kept
+func RequestID(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		shared.SetRequestID(c.Response(), c.Request())
+		return next(c)
+	}
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"go-cache-api/models"
+	shared "shared/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound, Query and UpdateResult are the ones of the shared repository
+var ErrNotFound = shared.ErrNotFound
+
+type (
+	Query        = shared.Query
+	UpdateResult = shared.UpdateResult
+)
+
+// ProductRepository stores products
+type ProductRepository interface {
+	shared.Repository[models.Product]
+}
+
+// ExportRepository stores exports
+type ExportRepository interface {
+	shared.Repository[models.ExportData]
+}
+
+// Collection names of the repositories, the aggregations run on them too
+const (
+	ProductCollection = "products"
+	ExportCollection  = "exports"
+)
+
+// NewMongo reads and writes the documents of collection
+func NewMongo[T any](collection *mongo.Collection) shared.Repository[T] {
+	return shared.NewMongo[T](collection)
+}
+
+// NewMongoProducts stores products in the products collection of db
+func NewMongoProducts(db *mongo.Database) ProductRepository {
+	return shared.NewMongo[models.Product](db.Collection(ProductCollection))
+}
+
+// NewMongoExports stores exports in the exports collection of db
+func NewMongoExports(db *mongo.Database) ExportRepository {
+	return shared.NewMongo[models.ExportData](db.Collection(ExportCollection))
+}
+
+// NewMemoryProducts keeps products in memory, for tests
+func NewMemoryProducts() ProductRepository {
+	return shared.NewMemory[models.Product]()
+}
+
+// NewMemoryExports keeps exports in memory, for tests
+func NewMemoryExports() ExportRepository {
+	return shared.NewMemory[models.ExportData]()
+}
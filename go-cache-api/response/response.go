@@ -1,14 +1,126 @@
 package response
 
-import "go-cache-api/models"
-
-type ProductsCacheResponse struct {
-	Message  string           `json:"message"`
-	Count    int64            `json:"count,omitempty"`
-	Products []models.Product `json:"products"`
-}
+import (
+	"go-cache-api/models"
+	"go-cache-api/validation"
+)
 
 type ProductCacheResponse struct {
 	TotalProduct int            `json:"totalProduct"`
 	Products     models.Product `json:"products"`
 }
+
+// Page is the envelope returned by every list endpoint
+type Page struct {
+	Items  interface{} `json:"items"`
+	Total  int64       `json:"total"`
+	Limit  int         `json:"limit"`
+	Offset int         `json:"offset"`
+	Page   int         `json:"page"`
+	Links  PageLinks   `json:"links"`
+	// NextCursor continues the listing with ?cursor=, only set on keyset paginated endpoints
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// PageLinks holds the navigation links of a page, relative to the server root
+type PageLinks struct {
+	Self  string `json:"self"`
+	First string `json:"first"`
+	Last  string `json:"last,omitempty"`
+	Next  string `json:"next,omitempty"`
+	Prev  string `json:"prev,omitempty"`
+}
+
+// BulkResponse reports the outcome of every operation of a bulk write, in request order
+type BulkResponse struct {
+	Ordered   bool             `json:"ordered"`
+	Succeeded int              `json:"succeeded"`
+	Failed    int              `json:"failed"`
+	Results   []BulkItemResult `json:"results"`
+}
+
+type BulkItemResult struct {
+	Index int    `json:"index"`
+	Op    string `json:"op"`
+	ID    string `json:"id,omitempty"`
+	// Status is inserted, updated, upserted, deleted or unchanged on success
+	// and invalid, not_found, failed or skipped otherwise
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Errors lists the broken rules of an invalid document
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// Report is an export time series, periods are in chronological order and
+// the periods without exports are included with zero totals
+type Report struct {
+	Interval string `json:"interval"`
+	// Filters are the country, category and businessSize the report is restricted to
+	Filters map[string][]string `json:"filters"`
+	Periods []ReportPeriod      `json:"periods"`
+}
+
+// ReportPeriod holds the totals of a month, or of a year when Month is zero
+type ReportPeriod struct {
+	Year     int   `json:"year"`
+	Month    int   `json:"month,omitempty"`
+	Count    int64 `json:"count"`
+	ValueTHB int64 `json:"valueTHB"`
+	ValueUSD int64 `json:"valueUSD"`
+	// MonthOverMonth compares a month to the one before, monthly reports only
+	MonthOverMonth *ReportChange `json:"monthOverMonth,omitempty"`
+	// YearOverYear compares a period to the same period a year before
+	YearOverYear *ReportChange `json:"yearOverYear,omitempty"`
+}
+
+// ReportChange is the difference to an earlier period. A growth is null when
+// the earlier value was zero
+type ReportChange struct {
+	ValueTHB       int64    `json:"valueTHB"`
+	ValueUSD       int64    `json:"valueUSD"`
+	ValueTHBGrowth *float64 `json:"valueTHBGrowth"`
+	ValueUSDGrowth *float64 `json:"valueUSDGrowth"`
+}
+
+// ImportReport is the outcome of an imported file, row by row
+type ImportReport struct {
+	DryRun   bool `json:"dryRun"`
+	Total    int  `json:"total"`
+	Accepted int  `json:"accepted"`
+	Rejected int  `json:"rejected"`
+	// Conflicting rows share their natural key with an earlier row of the file
+	Conflicting int `json:"conflicting"`
+	// Inserted, Updated and Unchanged split the accepted rows by what writing
+	// them did to the documents, they are zero on a dry run
+	Inserted  int         `json:"inserted"`
+	Updated   int         `json:"updated"`
+	Unchanged int         `json:"unchanged"`
+	Rows      []ImportRow `json:"rows"`
+}
+
+type ImportRow struct {
+	// Sheet names the sheet of the row, a .csv file is a sheet named after the file
+	Sheet string `json:"sheet,omitempty"`
+	// Row is the line of the row in its sheet, the header is line 1
+	Row int `json:"row"`
+	// Status is accepted, rejected, conflicting, inserted, updated or unchanged
+	Status string `json:"status"`
+	ID     string `json:"id,omitempty"`
+	// Errors lists why a row was rejected
+	Errors validation.Errors `json:"errors,omitempty"`
+}
+
+// ImportRollback is the outcome of rolling back an import batch
+type ImportRollback struct {
+	BatchID    string `json:"batchId"`
+	RolledBack int    `json:"rolledBack"`
+	// Skipped are the documents changed since the import, they are left as they are
+	Skipped []ImportRollbackSkip `json:"skipped"`
+}
+
+type ImportRollbackSkip struct {
+	DocumentID string `json:"documentId"`
+	Sheet      string `json:"sheet,omitempty"`
+	Row        int    `json:"row"`
+	Reason     string `json:"reason"`
+}
@@ -1,23 +1,33 @@
 package routes
 
 import (
+	"go-cache-api/configs"
 	"go-cache-api/controllers"
 
 	"github.com/labstack/echo"
 )
 
-
-
-func ExportRoute(e *echo.Echo){
+func ExportRoute(e *echo.Echo, h *controllers.Handler, cfg *configs.Config) {
 
 	//-----------CRUD------------//
-	e.POST("/exports", controllers.CreateExports)
-	e.GET("/exports", controllers.GetExports)
-	e.GET("/exports/:exportId", controllers.GetExport)
-	e.PUT("/exports/:exportId", controllers.EditExport)
-	e.DELETE("/exports/:exportId", controllers.DeleteExport)
-
-
-	//------------CACHE--------------// 
-	e.GET("/api/v2/exports", controllers.ExportsCache)
-}
\ No newline at end of file
+	idempotent := h.Idempotent(cfg.Idempotency.TTL())
+
+	e.POST("/exports", h.CreateExports, idempotent)
+	e.POST("/exports/bulk", h.BulkExports, idempotent)
+	e.GET("/exports", h.GetExports)
+	e.GET("/exports/:exportId", h.GetExport)
+	e.PUT("/exports/:exportId", h.EditExport)
+	e.PATCH("/exports/:exportId", h.PatchExport)
+	e.DELETE("/exports/:exportId", h.DeleteExport)
+
+	e.GET("/exports/trash", h.GetExportsTrash)
+	e.POST("/exports/:exportId/restore", h.RestoreExport)
+
+	e.GET("/exports/:exportId/history", h.GetExportHistory)
+	e.POST("/exports/:exportId/history/:historyId/restore", h.RestoreExportVersion)
+
+	//------------CACHE--------------//
+	e.GET("/api/v2/exports", h.ExportsCache)
+	e.GET("/api/v2/reports/exports/monthly", h.MonthlyExportReport)
+	e.GET("/api/v2/reports/exports/yearly", h.YearlyExportReport)
+}
@@ -0,0 +1,21 @@
+package routes
+
+import (
+	"go-cache-api/configs"
+	"go-cache-api/controllers"
+
+	"github.com/labstack/echo"
+)
+
+func ImportRoute(e *echo.Echo, h *controllers.Handler, cfg *configs.Config) {
+	idempotent := h.Idempotent(cfg.Idempotency.TTL())
+
+	e.POST("/imports/exports", h.ImportExports, idempotent)
+	e.POST("/imports/products", h.ImportProducts, idempotent)
+	e.GET("/imports/:jobId", h.GetImportJob)
+	e.POST("/imports/:jobId/cancel", h.CancelImportJob)
+
+	// the id of a job is the id of its import batch
+	e.GET("/imports/:jobId/records", h.GetImportRecords)
+	e.DELETE("/imports/:jobId", h.RollbackImport)
+}
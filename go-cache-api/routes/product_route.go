@@ -1,17 +1,30 @@
 package routes
 
 import (
+	"go-cache-api/configs"
 	"go-cache-api/controllers"
 
 	"github.com/labstack/echo"
 )
 
-func ProductRoute(e *echo.Echo){
-	e.POST("/products", controllers.CreateProducts)
-	e.GET("/products", controllers.GetProducts)
-	e.GET("/products/:productId", controllers.GetProduct)
-	e.PUT("/products/:productId", controllers.EditProduct)
-	e.DELETE("/products/:productId", controllers.DeleteProduct)
+func ProductRoute(e *echo.Echo, h *controllers.Handler, cfg *configs.Config) {
+	idempotent := h.Idempotent(cfg.Idempotency.TTL())
 
-	e.GET("/api/v2/products", controllers.GetProductsCache)
-}
\ No newline at end of file
+	e.POST("/products", h.CreateProducts, idempotent)
+	e.POST("/products/bulk", h.BulkProducts, idempotent)
+	e.GET("/products", h.GetProducts)
+	e.GET("/products/:productId", h.GetProduct)
+	e.PUT("/products/:productId", h.EditProduct)
+	e.PATCH("/products/:productId", h.PatchProduct)
+	e.DELETE("/products/:productId", h.DeleteProduct)
+
+	e.GET("/products/trash", h.GetProductsTrash)
+	e.POST("/products/:productId/restore", h.RestoreProduct)
+
+	e.GET("/products/:productId/exports", h.GetProductExports)
+
+	e.GET("/products/:productId/history", h.GetProductHistory)
+	e.POST("/products/:productId/history/:historyId/restore", h.RestoreProductVersion)
+
+	e.GET("/api/v2/products", h.GetProductsCache)
+}
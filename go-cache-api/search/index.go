@@ -0,0 +1,104 @@
+package search
+
+import (
+	"context"
+	"sort"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Field holds the search terms of a document, one string per searched field.
+// It is derived from the document so it is never returned nor kept in the history
+const Field = "searchTerms"
+
+// the weights rank a match in a field above a match in a lighter one
+var (
+	ProductWeights = map[string]int32{
+		"productName": 10,
+		"category":    5,
+	}
+	ExportWeights = map[string]int32{
+		"productName": 10,
+		"category":    5,
+		"country":     3,
+	}
+)
+
+// TextIndex is the text index of the search terms of the fields of weights.
+// The terms are already split by Terms so the index does no stemming of its own
+func TextIndex(weights map[string]int32) (bson.D, *options.IndexOptions) {
+	// the keys are sorted, an index created again with another order would conflict
+	fields := []string{}
+	for field := range weights {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	keys := bson.D{}
+	weightKeys := bson.D{}
+	for _, field := range fields {
+		keys = append(keys, bson.E{Key: Field + "." + field, Value: "text"})
+		weightKeys = append(weightKeys, bson.E{Key: Field + "." + field, Value: weights[field]})
+	}
+
+	return keys, options.Index().SetName("search").SetWeights(weightKeys).SetDefaultLanguage("none")
+}
+
+// Reindex computes the search terms of the fields of weights for the
+// documents of coll matched by filter
+func Reindex(ctx context.Context, coll *mongo.Collection, weights map[string]int32, filter bson.M) error {
+	projection := bson.M{}
+	for field := range weights {
+		projection[field] = 1
+	}
+
+	cur, err := coll.Find(ctx, filter, options.Find().SetProjection(projection))
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	writes := []mongo.WriteModel{}
+	flush := func() error {
+		if len(writes) == 0 {
+			return nil
+		}
+		_, err := coll.BulkWrite(ctx, writes, options.BulkWrite().SetOrdered(false))
+		writes = writes[:0]
+		return err
+	}
+
+	for cur.Next(ctx) {
+		var doc bson.M
+		if err := cur.Decode(&doc); err != nil {
+			return err
+		}
+
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc["_id"]}).
+			SetUpdate(bson.M{"$set": bson.M{Field: documentTerms(doc, weights)}}))
+
+		if len(writes) == 500 {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+	}
+	if err := cur.Err(); err != nil {
+		return err
+	}
+
+	return flush()
+}
+
+// documentTerms are the search terms of the fields of weights in doc
+func documentTerms(doc bson.M, weights map[string]int32) bson.M {
+	terms := bson.M{}
+	for field := range weights {
+		text, _ := doc[field].(string)
+		terms[field] = Terms(text)
+	}
+	return terms
+}
@@ -0,0 +1,149 @@
+package search
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+const (
+	// MaxQueryLength is the longest search accepted, in characters
+	MaxQueryLength = 100
+	// maxTerms bounds the terms of a query, each of them is a condition of the search
+	maxTerms = 50
+	// maxPrefix is the longest prefix of a word that is indexed, longer
+	// queried words are cut to it
+	maxPrefix = 20
+)
+
+var (
+	ErrTooLong = errors.New("search is too long")
+	ErrNoTerms = errors.New("search should contain a letter or a digit")
+	ErrTooMany = errors.New("search has too many words")
+)
+
+// segments splits s into lower cased runs of letters and digits. Thai is
+// written without spaces between words so a run of Thai is its own segment
+// even when it touches latin letters
+func segments(s string) (words []string, thai []bool) {
+	var current []rune
+	currentThai := false
+
+	flush := func() {
+		if len(current) > 0 {
+			words = append(words, string(current))
+			thai = append(thai, currentThai)
+		}
+		current = nil
+	}
+
+	for _, r := range strings.ToLower(s) {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && !unicode.IsMark(r) {
+			flush()
+			continue
+		}
+
+		isThai := unicode.Is(unicode.Thai, r)
+		if len(current) > 0 && isThai != currentThai {
+			flush()
+		}
+		currentThai = isThai
+		current = append(current, r)
+	}
+	flush()
+
+	return words, thai
+}
+
+// bigrams returns the pairs of consecutive characters of a Thai segment, any
+// part of the segment is found through them without knowing where words end
+func bigrams(word string) []string {
+	runes := []rune(word)
+	if len(runes) < 2 {
+		return []string{word}
+	}
+
+	grams := []string{}
+	for i := 0; i+1 < len(runes); i++ {
+		grams = append(grams, string(runes[i:i+2]))
+	}
+	return grams
+}
+
+// prefixes returns the prefixes of a word from two characters up, so a
+// search for the start of a word finds it
+func prefixes(word string) []string {
+	runes := []rune(word)
+	if len(runes) < 2 {
+		return []string{word}
+	}
+
+	out := []string{}
+	for i := 2; i <= len(runes) && i <= maxPrefix; i++ {
+		out = append(out, string(runes[:i]))
+	}
+	return out
+}
+
+// Terms returns the terms indexed for s, separated by spaces, the text index
+// they are stored in splits on spaces only
+func Terms(s string) string {
+	words, thai := segments(s)
+
+	seen := map[string]bool{}
+	terms := []string{}
+	for i, word := range words {
+		grams := prefixes(word)
+		if thai[i] {
+			grams = bigrams(word)
+		}
+
+		for _, g := range grams {
+			if !seen[g] {
+				seen[g] = true
+				terms = append(terms, g)
+			}
+		}
+	}
+
+	return strings.Join(terms, " ")
+}
+
+// Query turns what the client searched for into a $text search matching the
+// documents having every term of it. Only letters and digits are kept, the
+// terms are quoted so each one is required and nothing in the input is read
+// as a $text operator
+func Query(s string) (string, error) {
+	if len([]rune(s)) > MaxQueryLength {
+		return "", ErrTooLong
+	}
+
+	words, thai := segments(s)
+
+	seen := map[string]bool{}
+	terms := []string{}
+	for i, word := range words {
+		grams := []string{word}
+		if thai[i] {
+			grams = bigrams(word)
+		} else if runes := []rune(word); len(runes) > maxPrefix {
+			grams = []string{string(runes[:maxPrefix])}
+		}
+
+		for _, g := range grams {
+			if !seen[g] {
+				seen[g] = true
+				terms = append(terms, `"`+g+`"`)
+			}
+		}
+	}
+
+	if len(terms) == 0 {
+		return "", ErrNoTerms
+	}
+	if len(terms) > maxTerms {
+		return "", ErrTooMany
+	}
+
+	return strings.Join(terms, " "), nil
+}
@@ -0,0 +1,128 @@
+package search
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestTerms(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+	}{
+		{"prefixes", "Rice", "ri ric rice"},
+		{"lower cased and split", "Jasmine-Rice", "ja jas jasm jasmi jasmin jasmine ri ric rice"},
+		{"repeated terms once", "rice rice", "ri ric rice"},
+		{"single character", "a", "a"},
+		{"thai bigrams", "ข้าวหอม", "ข้ ้า าว วห หอ อม"},
+		{"thai next to latin", "abข้าว", "ab ข้ ้า าว"},
+		{"no word", " - ", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Terms(tt.s); got != tt.want {
+				t.Errorf("Terms(%q) = %q, want %q", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTermsPrefixLength(t *testing.T) {
+	terms := strings.Fields(Terms(strings.Repeat("a", maxPrefix+5)))
+	if last := terms[len(terms)-1]; len(last) != maxPrefix {
+		t.Errorf("longest prefix has %d characters, want %d", len(last), maxPrefix)
+	}
+}
+
+func TestQuery(t *testing.T) {
+	tests := []struct {
+		name string
+		s    string
+		want string
+		err  error
+	}{
+		{"words are required", "Jasmine Rice", `"jasmine" "rice"`, nil},
+		{"operators are dropped", `-rice "tea"`, `"rice" "tea"`, nil},
+		{"repeated words once", "rice RICE", `"rice"`, nil},
+		{"thai bigrams", "ข้าว", `"ข้" "้า" "าว"`, nil},
+		{"long words are cut to the indexed prefix", strings.Repeat("a", maxPrefix+5), `"` + strings.Repeat("a", maxPrefix) + `"`, nil},
+		{"no terms", "!?", "", ErrNoTerms},
+		{"too long", strings.Repeat("a", MaxQueryLength+1), "", ErrTooLong},
+		{"too many", thaiRun(maxTerms) + " rice", "", ErrTooMany},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Query(tt.s)
+			if err != tt.err || got != tt.want {
+				t.Errorf("Query(%q) = %q, %v, want %q, %v", tt.s, got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+// thaiRun is a run of Thai characters with n distinct bigrams
+func thaiRun(n int) string {
+	runes := []rune{}
+	for r := 'ก'; len(runes) <= n; r++ {
+		runes = append(runes, r)
+	}
+	return string(runes)
+}
+
+func TestQueryFindsTerms(t *testing.T) {
+	indexed := map[string]bool{}
+	for _, term := range strings.Fields(Terms("Hom Mali ข้าวหอมมะลิ")) {
+		indexed[term] = true
+	}
+
+	for _, s := range []string{"hom", "Ma", "หอม", "ข้าวหอม"} {
+		q, err := Query(s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, term := range strings.Fields(q) {
+			if !indexed[strings.Trim(term, `"`)] {
+				t.Errorf("term %s of %q is not indexed", term, s)
+			}
+		}
+	}
+}
+
+func TestTextIndex(t *testing.T) {
+	keys, opts := TextIndex(ExportWeights)
+
+	wantKeys := bson.D{
+		{Key: "searchTerms.category", Value: "text"},
+		{Key: "searchTerms.country", Value: "text"},
+		{Key: "searchTerms.productName", Value: "text"},
+	}
+	if !reflect.DeepEqual(keys, wantKeys) {
+		t.Errorf("keys = %v, want %v", keys, wantKeys)
+	}
+
+	wantWeights := bson.D{
+		{Key: "searchTerms.category", Value: int32(5)},
+		{Key: "searchTerms.country", Value: int32(3)},
+		{Key: "searchTerms.productName", Value: int32(10)},
+	}
+	if !reflect.DeepEqual(opts.Weights, wantWeights) {
+		t.Errorf("weights = %v, want %v", opts.Weights, wantWeights)
+	}
+	if *opts.Name != "search" || *opts.DefaultLanguage != "none" {
+		t.Errorf("name = %s, language = %s", *opts.Name, *opts.DefaultLanguage)
+	}
+}
+
+func TestDocumentTerms(t *testing.T) {
+	got := documentTerms(bson.M{"productName": "Rice", "category": 5}, ProductWeights)
+	want := bson.M{"productName": "ri ric rice", "category": ""}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("documentTerms = %v, want %v", got, want)
+	}
+}
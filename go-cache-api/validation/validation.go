@@ -0,0 +1,22 @@
+package validation
+
+import (
+	shared "shared/validation"
+)
+
+type (
+	FieldError = shared.FieldError
+	Errors     = shared.Errors
+)
+
+var validate = shared.New()
+
+// Struct checks the validate tags of v
+func Struct(v interface{}) Errors {
+	return validate.Struct(v)
+}
+
+// Slice checks every item of items and sets the index of each error
+func Slice(items interface{}) Errors {
+	return validate.Slice(items)
+}
@@ -0,0 +1,26 @@
+package configs
+
+import (
+	"shared/config"
+)
+
+// Config is the configuration of the api, it is loaded once at start by Load
+type Config struct {
+	Server config.Server `yaml:"server"`
+	Mongo  config.Mongo  `yaml:"mongo"`
+
+	// MigrateOnStart applies the pending migrations when the api starts.
+	// Without it they are applied with go run ./cmd/migrate up
+	MigrateOnStart bool `yaml:"migrateOnStart" env:"MIGRATE_ON_START" default:"true"`
+}
+
+// Load reads the configuration from the environment, the optional .env and
+// yaml files and the defaults, see config.Load. An invalid configuration is
+// an error so the api does not start with it
+func Load() (*Config, error) {
+	cfg := &Config{Mongo: config.Mongo{Database: "quiz-api"}}
+	if err := config.Load(cfg); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
@@ -3,19 +3,21 @@ package configs
 import (
 	"context"
 	"log"
-	"time"
+
+	"shared/config"
 
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
-func ConnectDB() *mongo.Client {
-	client, err := mongo.NewClient(options.Client().ApplyURI(EnvMongoURI()))
+// ConnectDB connects to the mongo of cfg, the api does not start without it
+func ConnectDB(cfg config.Mongo) *mongo.Client {
+	client, err := mongo.NewClient(options.Client().ApplyURI(cfg.URI))
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ConnectTimeout)
 	defer cancel()
 
 	err = client.Connect(ctx)
@@ -31,11 +33,3 @@ func ConnectDB() *mongo.Client {
 	// fmt.Println("Connected to MongoDB")
 	return client
 }
-
-func GetCollection(client *mongo.Client, collectionName string) *mongo.Collection {
-	collection := client.Database("quiz-api").Collection(collectionName)
-	return collection
-}
-
-
-
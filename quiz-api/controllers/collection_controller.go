@@ -4,22 +4,31 @@ import (
 	"context"
 	"log"
 	"net/http"
-	"quiz-api/configs"
 	"quiz-api/models"
+	"quiz-api/problem"
+	"quiz-api/repository"
 	"quiz-api/responses"
+	"quiz-api/validation"
+	"shared/query"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	collectionCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "collections") //connect to collection in database
+	// sortable fields are the ones backed by an index
+	collectionSort = query.SortSpec{
+		Fields: map[string]string{
+			"id":         "_id",
+			"name":       "name",
+			"created_at": "created_at",
+			"updated_at": "updated_at",
+		},
+		Default: bson.D{{Key: "created_at", Value: -1}},
+	}
 )
 
 func TimeNow() time.Time {
@@ -32,23 +41,21 @@ func TimeNow() time.Time {
 }
 
 // ----------------------------------new created function with insert many---------------------------------------------//
-func CreateManyCollection(c echo.Context) error {
+func (h *Handler) CreateManyCollection(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var collection []models.Collection
 	if err := c.Bind(&collection); err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid request payload!"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload!")
 	}
 
-	for key, value := range collection {
-		if value.Name == "" {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "[" + strconv.Itoa(key) + "]" + "Name is required."})
-		}
+	if errs := validation.Slice(collection); errs != nil {
+		return problem.Validation(c, errs)
 	}
 
 	updatedAt := TimeNow()
-	var newCollections []interface{}
+	var newCollections []models.Collection
 	for _, collection := range collection {
 		newCollection := models.Collection{
 			ID:        primitive.NewObjectID(),
@@ -59,27 +66,26 @@ func CreateManyCollection(c echo.Context) error {
 		newCollections = append(newCollections, newCollection)
 	}
 
-	_, err := collectionCollection.InsertMany(ctx, newCollections)
+	err := h.Collections.Insert(ctx, newCollections...)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Failed to create new collection."})
+		return problem.Mongo(c, err, "Failed to create new collection.")
 	}
 
 	return c.JSON(http.StatusCreated, responses.SuccessResponse{Message: "Collection had been created.", Collection: newCollections})
 }
 
-
 // insert new data into database
-func CreateCollection(c echo.Context) error {
+func (h *Handler) CreateCollection(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	var collection models.Collection
 	if err := c.Bind(&collection); err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid request payload!"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload!")
 	}
 
-	if collection.Name == "" {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Name is required."})
+	if errs := validation.Struct(collection); errs != nil {
+		return problem.Validation(c, errs)
 	}
 
 	updateAt := TimeNow()
@@ -90,16 +96,16 @@ func CreateCollection(c echo.Context) error {
 		UpdatedAt: &updateAt,
 	}
 
-	_, err := collectionCollection.InsertOne(ctx, newCollection)
+	err := h.Collections.Insert(ctx, newCollection)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to create new collection!"})
+		return problem.Mongo(c, err, "Failed to create new collection!")
 	}
 
 	return c.JSON(http.StatusCreated, responses.SuccessResponse{Message: "Collection had been created.", Collection: newCollection})
 }
 
 // get all the data in collections
-func GetAllCollections(c echo.Context) error {
+func (h *Handler) GetAllCollections(c echo.Context) error {
 	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
@@ -109,7 +115,7 @@ func GetAllCollections(c echo.Context) error {
 	if c.QueryParam("limit") != "" {
 		limit, err = strconv.Atoi(c.QueryParam("limit"))
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid type limit!"})
+			return problem.Write(c, http.StatusBadRequest, "Invalid type limit!")
 		}
 	}
 
@@ -118,7 +124,7 @@ func GetAllCollections(c echo.Context) error {
 	if c.QueryParam("page") != "" {
 		page, err = strconv.Atoi(c.QueryParam("page"))
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid type page!"})
+			return problem.Write(c, http.StatusBadRequest, "Invalid type page!")
 		}
 	}
 
@@ -128,26 +134,13 @@ func GetAllCollections(c echo.Context) error {
 		offset = (page - 1) * limit
 	}
 
-	// check if sorts queryparam
-	// แก้ไข การแบ่ง การ sort
-	sortFields := c.QueryParams()["sort_by"]
-	sorts := bson.D{}
-	if len(sortFields) > 0 {
-		for _, sort := range sortFields {
-			for _, value := range strings.Split(sort, ",") {
-				sortOrder := 1
-				if strings.HasPrefix(value, "-") {
-					sortOrder = -1
-					value = strings.Trim(value, "-")
-
-				}
-				sorts = append(sorts, bson.E{Key: value, Value: sortOrder})
-			}
-		}
+	sorts, err := query.ParseSort(c.QueryParams()["sort_by"], collectionSort)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
 	filter := bson.M{"deleted_at": bson.M{"$exists": false}}
-	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	query := repository.Query{Filter: filter, Limit: int64(limit), Skip: int64(offset)}
 
 	search := c.QueryParam("search")
 	if search != "" {
@@ -156,17 +149,12 @@ func GetAllCollections(c echo.Context) error {
 	}
 
 	if len(sorts) > 0 {
-		opts.SetSort(sorts)
-	}
-
-	results, err := collectionCollection.Find(ctx, filter, opts)
-	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Can not find data in collection."})
+		query.Sort = sorts
 	}
 
 	var collections []models.Collection
-	if err := results.All(ctx, &collections); err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "A Server error occurred."})
+	if err := h.Collections.Find(ctx, query, &collections); err != nil {
+		return problem.Mongo(c, err, "Can not find data in collection.")
 	}
 
 	var checkDeletedCollections []models.Collection
@@ -193,19 +181,19 @@ func GetAllCollections(c echo.Context) error {
 }
 
 // get collection by id
-func GetCollection(c echo.Context) error {
+func (h *Handler) GetCollection(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id."})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id.")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	collection.CreatedAt = collection.CreatedAt.Add(7 * time.Hour)
@@ -217,28 +205,28 @@ func GetCollection(c echo.Context) error {
 		collection.UpdatedAt = nil
 	}
 
-	return c.JSON(http.StatusOK, collection)	
+	return c.JSON(http.StatusOK, collection)
 }
 
 // update collection by id
-func UpdateCollection(c echo.Context) error {
+func (h *Handler) UpdateCollection(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
 	if err := c.Bind(&collection); err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid request payload"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
 	}
 
 	var updateCollection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId}).Decode(&updateCollection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId}, nil, &updateCollection)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	if collection.Name != "" {
@@ -248,12 +236,12 @@ func UpdateCollection(c echo.Context) error {
 	updateTime := TimeNow()
 	updateCollection.UpdatedAt = &updateTime
 
-	result, err := collectionCollection.UpdateByID(ctx, collectionId, bson.M{"$set": updateCollection})
+	result, err := h.Collections.Update(ctx, bson.M{"_id": collectionId}, bson.M{"$set": updateCollection})
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Failed to update collection"})
+		return problem.Mongo(c, err, "Failed to update collection")
 	}
 
-	if result.ModifiedCount == 0 {
+	if result.Modified == 0 {
 		return c.JSON(http.StatusOK, responses.SuccessResponse{Message: "No changes detected."})
 	}
 
@@ -261,77 +249,76 @@ func UpdateCollection(c echo.Context) error {
 }
 
 // Deleted the collection by its ID.
-func DeleteCollection(c echo.Context) error {
+func (h *Handler) DeleteCollection(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
-	result, err := collectionCollection.DeleteOne(ctx, bson.M{"_id": collectionId})
+	deleted, err := h.Collections.Delete(ctx, bson.M{"_id": collectionId})
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Failed to delete collection"})
+		return problem.Mongo(c, err, "Failed to delete collection")
 	}
 
-	if result.DeletedCount == 0 {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found"})
+	if deleted == 0 {
+		return problem.Write(c, http.StatusNotFound, "Collection not found")
 	}
 
 	return c.JSON(http.StatusOK, responses.SuccessResponse{Message: collection.Name + " had been deleted"})
 }
 
-
 //------------------------------------new deleted function with condition deleted type-------------------------------------------//
 
-func DeleteCollectionV2(c echo.Context) error {
+func (h *Handler) DeleteCollectionV2(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	deleteType, err := strconv.Atoi(c.QueryParam("deleteType"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid delete type"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid delete type")
 	}
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	var updateCollection bson.M
 	if deleteType == 0 {
-		_, err := collectionCollection.DeleteOne(ctx, bson.M{"_id": collectionId})
+		_, err := h.Collections.Delete(ctx, bson.M{"_id": collectionId})
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Failed to hard delete collection"})
+			return problem.Mongo(c, err, "Failed to hard delete collection")
 		}
 	} else if deleteType == 1 {
 		updateCollection = bson.M{
 			"deleted_at": TimeNow(),
 		}
 
-		result, err := collectionCollection.UpdateOne(ctx, bson.M{"_id": collectionId}, bson.M{"$set": updateCollection})
+		result, err := h.Collections.Update(ctx, bson.M{"_id": collectionId}, bson.M{"$set": updateCollection})
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Failed to soft delete collection"})
+			return problem.Mongo(c, err, "Failed to soft delete collection")
 		}
 
-		if result.ModifiedCount == 0 {
+		if result.Modified == 0 {
 			return c.JSON(http.StatusOK, responses.SuccessResponse{Message: "Collection had been deleted"})
 		}
 	} else {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid delete type"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid delete type")
 	}
 
 	return c.JSON(http.StatusOK, responses.SuccessResponse{Message: collection.Name + " has been deleted"})
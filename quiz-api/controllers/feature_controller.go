@@ -3,62 +3,56 @@ package controllers
 import (
 	"context"
 	"net/http"
-	"quiz-api/configs"
 	"quiz-api/models"
+	"quiz-api/problem"
+	"quiz-api/repository"
 	"quiz-api/responses"
+	"quiz-api/validation"
+	"shared/query"
 	"strconv"
-	"strings"
 	"time"
 
 	"github.com/labstack/echo/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 var (
-	featureCollection *mongo.Collection = configs.GetCollection(configs.ConnectDB(), "features") //connect to the features collection
+	// sortable fields are the ones backed by an index
+	featureSort = query.SortSpec{
+		Fields: map[string]string{
+			"id":              "_id",
+			"properties.name": "properties.name",
+			"created_at":      "created_at",
+			"updated_at":      "updated_at",
+		},
+		Default: bson.D{{Key: "created_at", Value: -1}},
+	}
 )
 
 // insert new feature data
-func CreateFeature(c echo.Context) error {
+func (h *Handler) CreateFeature(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	var feature models.Feature
 	if err := c.Bind(&feature); err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid request payload"})
-	}
-
-	if feature.Geometry.Type == "" {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Type is required."})
-	}
-
-	if feature.Geometry.Coordinates == nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Coordinates is required."})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
 	}
 
-	if feature.Properties["name"] == nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Name in properties is required."})
-	}
-
-	//check coordinate must be numeric
-	for _, coord := range feature.Geometry.Coordinates {
-		if _, ok := coord.(string); ok {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Coordinate must be numeric"})
-		}
+	if errs := validation.Struct(feature); errs != nil {
+		return problem.Validation(c, errs)
 	}
 
 	feature.Properties["collectionId"] = collectionId
@@ -71,36 +65,36 @@ func CreateFeature(c echo.Context) error {
 		CreatedAt:  TimeNow(),
 	}
 
-	_, err = featureCollection.InsertOne(ctx, newFeature)
+	err = h.Features.Insert(ctx, newFeature)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to create new feature"})
+		return problem.Mongo(c, err, "Failed to create new feature")
 	}
 
 	return c.JSON(http.StatusCreated, responses.SuccessFeatureResponse{Message: "Created new feature successfully", Feature: newFeature})
 }
 
 // get all the feature data by collcection id
-func GetAllFeatures(c echo.Context) error {
+func (h *Handler) GetAllFeatures(c echo.Context) error {
 	var err error
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	limit := 10
 	if c.QueryParam("limit") != "" {
 		limit, err = strconv.Atoi(c.QueryParam("limit"))
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid limit type!"})
+			return problem.Write(c, http.StatusBadRequest, "Invalid limit type!")
 		}
 	}
 
@@ -108,7 +102,7 @@ func GetAllFeatures(c echo.Context) error {
 	if c.QueryParam("page") != "" {
 		page, err = strconv.Atoi(c.QueryParam("page"))
 		if err != nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid page type!"})
+			return problem.Write(c, http.StatusBadRequest, "Invalid page type!")
 		}
 	}
 
@@ -117,24 +111,13 @@ func GetAllFeatures(c echo.Context) error {
 		offset = (page - 1) * limit
 	}
 
-	sortFields := c.QueryParams()["sort_by"]
-
-	sorts := bson.D{}
-	if len(sortFields) > 0 {
-		for _, sort := range sortFields {
-			for _, value := range strings.Split(sort, ",") {
-				sortOrder := 1
-				if strings.HasPrefix(value, "-") {
-					sortOrder = -1
-					value = strings.Trim(value, "-")
-				}
-				sorts = append(sorts, bson.E{Key: value, Value: sortOrder})
-			}
-		}
+	sorts, err := query.ParseSort(c.QueryParams()["sort_by"], featureSort)
+	if err != nil {
+		return problem.Write(c, http.StatusBadRequest, err.Error())
 	}
 
 	filter := bson.M{"properties.collectionId": collectionId, "deleted_at": bson.M{"$exists": false}}
-	opts := options.Find().SetLimit(int64(limit)).SetSkip(int64(offset))
+	query := repository.Query{Filter: filter, Limit: int64(limit), Skip: int64(offset)}
 
 	search := c.QueryParam("search")
 	if search != "" {
@@ -142,17 +125,12 @@ func GetAllFeatures(c echo.Context) error {
 	}
 
 	if len(sorts) > 0 {
-		opts.SetSort(sorts)
-	}
-
-	results, err := featureCollection.Find(ctx, filter, opts)
-	if err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "A server error occurred while fetching features"})
+		query.Sort = sorts
 	}
 
 	var features []models.Feature
-	if err := results.All(ctx, &features); err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "A server error occurred"})
+	if err := h.Features.Find(ctx, query, &features); err != nil {
+		return problem.Mongo(c, err, "A server error occurred while fetching features")
 	}
 
 	var checkDeletedFeatures []models.Feature
@@ -178,68 +156,65 @@ func GetAllFeatures(c echo.Context) error {
 }
 
 // get feature by feature id
-func GetFeature(c echo.Context) error {
+func (h *Handler) GetFeature(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	featureId, err := primitive.ObjectIDFromHex(c.Param("featureId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid feature id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid feature id")
 	}
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	var features models.Feature
-	err = featureCollection.FindOne(ctx, bson.M{"_id": featureId, "deleted_at": bson.M{"$exists": false}, "properties.collectionId": collectionId}).Decode(&features)
+	err = h.Features.Get(ctx, bson.M{"_id": featureId, "deleted_at": bson.M{"$exists": false}, "properties.collectionId": collectionId}, nil, &features)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
-			return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Feature collection not found"})
-		}
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "A Server error occurred."})
+		return problem.Mongo(c, err, "Feature collection not found")
 	}
 
 	return c.JSON(http.StatusOK, features)
 }
 
 // update feature by feature id
-func UpdateFeature(c echo.Context) error {
+func (h *Handler) UpdateFeature(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	featureId, err := primitive.ObjectIDFromHex(c.Param("featureId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid feature id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid feature id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	var feature models.Feature
 	if err := c.Bind(&feature); err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid request payload"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload")
 	}
 
 	var updateFeature models.Feature
-	err = featureCollection.FindOne(ctx, bson.M{"_id": featureId}).Decode(&updateFeature)
+	err = h.Features.Get(ctx, bson.M{"_id": featureId}, nil, &updateFeature)
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Feature not found"})
+		return problem.Mongo(c, err, "Feature not found")
 	}
 
 	if feature.Geometry.Type != "" {
@@ -261,12 +236,12 @@ func UpdateFeature(c echo.Context) error {
 	updateTime := TimeNow()
 	updateFeature.UpdatedAt = &updateTime
 
-	result, err := featureCollection.UpdateByID(ctx, featureId, bson.M{"$set": updateFeature})
+	result, err := h.Features.Update(ctx, bson.M{"_id": featureId}, bson.M{"$set": updateFeature})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to update feature"})
+		return problem.Mongo(c, err, "Failed to update feature")
 	}
 
-	if result.ModifiedCount == 0 {
+	if result.Modified == 0 {
 		return c.JSON(http.StatusNoContent, responses.SuccessResponse{Message: "No changes detected."})
 	}
 
@@ -274,86 +249,72 @@ func UpdateFeature(c echo.Context) error {
 }
 
 // deleate feature by its id
-func DeleteFeature(c echo.Context) error {
+func (h *Handler) DeleteFeature(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	//count collection document in database to check the existence of the collection data
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	if !collection.DeletedAt.IsZero() {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "This collection had been deleted."})
+		return problem.Write(c, http.StatusNotFound, "This collection had been deleted.")
 	}
 
 	objFeatureID, err := primitive.ObjectIDFromHex(c.Param("featureId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid feature id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid feature id")
 	}
 
-	result, err := featureCollection.DeleteOne(ctx, bson.M{"_id": objFeatureID, "properties.collectionId": collectionId})
+	deleted, err := h.Features.Delete(ctx, bson.M{"_id": objFeatureID, "properties.collectionId": collectionId})
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to delete feature"})
+		return problem.Mongo(c, err, "Failed to delete feature")
 	}
-	if result.DeletedCount == 0 {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Feature collection not found"})
+	if deleted == 0 {
+		return problem.Write(c, http.StatusNotFound, "Feature collection not found")
 	}
 
 	return c.JSON(http.StatusOK, responses.SuccessResponse{Message: "Feature collection had been deleted"})
 }
 
 // ----------------------------------new created function with insert many---------------------------------------------//
-func CreateFeatureV2(c echo.Context) error {
+func (h *Handler) CreateFeatureV2(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	var features []models.Feature
 	if err := c.Bind(&features); err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid request payload!"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid request payload!")
 	}
 
-	for _, value := range features {
-		if value.Geometry.Type == "" {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Geometry type is required."})
-		}
-		if value.Geometry.Coordinates == nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Geometry coordinates is required."})
-		}
-		if value.Properties["name"] == nil {
-			return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Name in properties is required."})
-		}
+	if errs := validation.Slice(features); errs != nil {
+		return problem.Validation(c, errs)
 	}
 
-	// Check coordinates numeric
 	for _, feature := range features {
-		for _, coord := range feature.Geometry.Coordinates {
-			if _, ok := coord.(float64); !ok {
-				return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Coordinate must be numeric"})
-			}
-		}
 		feature.Properties["collectionId"] = collectionId
 	}
 
-	var newFeatures []interface{}
+	var newFeatures []models.Feature
 	for _, feature := range features {
 		newFeature := models.Feature{
 			Id:         primitive.NewObjectID(),
@@ -365,63 +326,63 @@ func CreateFeatureV2(c echo.Context) error {
 		newFeatures = append(newFeatures, newFeature)
 	}
 
-	_, err = featureCollection.InsertMany(ctx, newFeatures)
+	err = h.Features.Insert(ctx, newFeatures...)
 	if err != nil {
-		return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to create new feature"})
+		return problem.Mongo(c, err, "Failed to create new feature")
 	}
 
 	return c.JSON(http.StatusCreated, responses.SuccessFeatureResponse{Message: "Created new features successfully", Feature: newFeatures})
 }
 
 // ------------------------------------new deleted function with condition deleted type-------------------------------------------//
-func DeletedFeatureV2(c echo.Context) error {
+func (h *Handler) DeletedFeatureV2(c echo.Context) error {
 	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
 	deleteType, err := strconv.Atoi(c.QueryParam("deleteType"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid deletion type"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid deletion type")
 	}
 
 	collectionId, err := primitive.ObjectIDFromHex(c.Param("collectionId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid collection id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid collection id")
 	}
 
 	var collection models.Collection
-	err = collectionCollection.FindOne(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}).Decode(&collection)
+	err = h.Collections.Get(ctx, bson.M{"_id": collectionId, "deleted_at": bson.M{"$exists": false}}, nil, &collection)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Collection not found."})
+		return problem.Mongo(c, err, "Collection not found.")
 	}
 
 	featureId, err := primitive.ObjectIDFromHex(c.Param("featureId"))
 	if err != nil {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid feature id"})
+		return problem.Write(c, http.StatusBadRequest, "Invalid feature id")
 	}
 
 	var features models.Feature
-	err = featureCollection.FindOne(ctx, bson.M{"_id": featureId}).Decode(&features)
+	err = h.Features.Get(ctx, bson.M{"_id": featureId}, nil, &features)
 	if err != nil {
-		return c.JSON(http.StatusNotFound, responses.ErrorResponse{Message: "Feature not found."})
+		return problem.Mongo(c, err, "Feature not found.")
 	}
 
 	var updateFeature bson.M
 	if deleteType == 0 {
-		_, err := featureCollection.DeleteOne(ctx, bson.M{"_id": featureId})
+		_, err := h.Features.Delete(ctx, bson.M{"_id": featureId})
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to hard delete collection"})
+			return problem.Mongo(c, err, "Failed to hard delete collection")
 		}
 	} else if deleteType == 1 {
 		updateFeature = bson.M{"deleted_at": TimeNow()}
-		result, err := featureCollection.UpdateOne(ctx, bson.M{"_id": featureId}, bson.M{"$set": updateFeature})
+		result, err := h.Features.Update(ctx, bson.M{"_id": featureId}, bson.M{"$set": updateFeature})
 		if err != nil {
-			return c.JSON(http.StatusInternalServerError, responses.ErrorResponse{Message: "Failed to soft delete feature"})
+			return problem.Mongo(c, err, "Failed to soft delete feature")
 		}
-		if result.ModifiedCount == 0 {
+		if result.Modified == 0 {
 			return c.JSON(http.StatusOK, responses.SuccessFeatureResponse{Message: "Feature had been deleted."})
 		}
 	} else {
-		return c.JSON(http.StatusBadRequest, responses.ErrorResponse{Message: "Invalid delete type."})
+		return problem.Write(c, http.StatusBadRequest, "Invalid delete type.")
 	}
 
 	return c.JSON(http.StatusOK, responses.SuccessFeatureResponse{Message: "Feature had been deleted"})
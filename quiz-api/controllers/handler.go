@@ -0,0 +1,18 @@
+package controllers
+
+import (
+	"quiz-api/repository"
+)
+
+// Handler serves the collections and their features. It gets the
+// repositories at construction, the package opens no connection of its own
+type Handler struct {
+	Collections repository.CollectionRepository
+	Features    repository.FeatureRepository
+}
+
+// NewHandler serves the api from collections and features, the mongo
+// repositories or the memory ones in tests
+func NewHandler(collections repository.CollectionRepository, features repository.FeatureRepository) *Handler {
+	return &Handler{Collections: collections, Features: features}
+}
@@ -1,20 +1,70 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"os"
+	"os/signal"
 	"quiz-api/configs"
+	"quiz-api/controllers"
+	"quiz-api/migrations"
+	"quiz-api/problem"
+	"quiz-api/repository"
 	"quiz-api/routes"
+	"shared/health"
+	"shared/migrate"
+	"syscall"
+	"time"
 
 	"github.com/labstack/echo/v4"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+// pendingMigrations fails while migrations of db are not applied, the api
+// serves a database it expects to be migrated
+func pendingMigrations(db *mongo.Database) health.Check {
+	return func(ctx context.Context) error {
+		pending, err := migrate.Pending(ctx, db, migrations.All)
+		if err != nil {
+			return err
+		}
+		if len(pending) > 0 {
+			return fmt.Errorf("%d migrations are pending, from version %d", len(pending), pending[0].Version)
+		}
+		return nil
+	}
+}
+
 func main() {
 	e := echo.New()
+	e.HTTPErrorHandler = problem.HTTPErrorHandler
+	e.Use(problem.RequestID)
+
+	cfg, err := configs.Load()
+	if err != nil {
+		e.Logger.Fatal(err)
+	}
+
+	// the handlers share one mongo client
+	client := configs.ConnectDB(cfg.Mongo)
+	db := client.Database(cfg.Mongo.Database)
+
+	if cfg.MigrateOnStart {
+		if _, err := migrate.Run(context.Background(), db, migrations.All); err != nil {
+			e.Logger.Fatal(err)
+		}
+	}
 
-	configs.ConnectDB()
+	checker := health.New()
+	checker.Add("mongo", health.Mongo(client))
+	checker.Add("migrations", pendingMigrations(db))
+	routes.HealthRoute(e, checker)
 
-	routes.CollectionRoute(e)
-	routes.FeatureRoute(e)
+	h := controllers.NewHandler(repository.NewMongoCollections(db), repository.NewMongoFeatures(db))
+	routes.CollectionRoute(e, h)
+	routes.FeatureRoute(e, h)
 
 	e.GET("/", func(c echo.Context) error {
 		response := map[string]interface{}{
@@ -24,5 +74,30 @@ func main() {
 		return c.JSON(http.StatusOK, response)
 	})
 
-	e.Logger.Fatal(e.Start(":8000"))
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	go func() {
+		if err := e.Start(cfg.Server.Addr); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			e.Logger.Fatal(err)
+		}
+	}()
+
+	<-ctx.Done()
+
+	// the probes see the service is not ready while it still serves
+	checker.Drain()
+	time.Sleep(cfg.Server.DrainDelay)
+
+	// the requests in flight finish, then the client disconnects, both within
+	// the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), cfg.Server.ShutdownTimeout)
+	defer cancel()
+
+	if err := e.Shutdown(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
+	if err := client.Disconnect(shutdownCtx); err != nil {
+		e.Logger.Error(err)
+	}
 }
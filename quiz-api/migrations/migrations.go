@@ -0,0 +1,84 @@
+package migrations
+
+import (
+	"context"
+
+	"shared/migrate"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// All are the migrations of the database, a new migration is added at the end
+// with the next version and an applied one is never changed
+var All = []migrate.Migration{
+	{
+		Version:     1,
+		Description: "index the filters and sorts of collections and features",
+		Indexes: []migrate.Index{
+			{Collection: "collections", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Collection: "collections", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "updated_at", Value: -1}}},
+			{Collection: "collections", Keys: bson.D{{Key: "deleted_at", Value: 1}, {Key: "name", Value: 1}}},
+			// features are always listed within a collection
+			{Collection: "features", Keys: bson.D{{Key: "properties.collectionId", Value: 1}, {Key: "deleted_at", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Collection: "features", Keys: bson.D{{Key: "properties.collectionId", Value: 1}, {Key: "deleted_at", Value: 1}, {Key: "updated_at", Value: -1}}},
+			{Collection: "features", Keys: bson.D{{Key: "properties.collectionId", Value: 1}, {Key: "deleted_at", Value: 1}, {Key: "properties.name", Value: 1}}},
+			{Collection: "features", Keys: bson.D{{Key: "properties.collectionId", Value: 1}, {Key: "deleted_at", Value: 1}, {Key: "_id", Value: 1}}},
+		},
+	},
+	{
+		Version:     2,
+		Description: "backfill created_at and the type of features",
+		Up: func(ctx context.Context, db *mongo.Database) error {
+			// the id of a document holds the time it was created
+			createdAt := bson.A{bson.M{"$set": bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}
+			missing := bson.M{"created_at": bson.M{"$exists": false}}
+
+			for _, name := range []string{"collections", "features"} {
+				if _, err := db.Collection(name).UpdateMany(ctx, missing, createdAt); err != nil {
+					return err
+				}
+			}
+
+			_, err := db.Collection("features").UpdateMany(ctx,
+				bson.M{"$or": bson.A{bson.M{"type": bson.M{"$exists": false}}, bson.M{"type": ""}}},
+				bson.M{"$set": bson.M{"type": "Feature"}})
+			return err
+		},
+	},
+	{
+		Version:     3,
+		Description: "validate collections and features with JSON Schema",
+		Validators: []migrate.Validator{
+			{Collection: "collections", Schema: bson.M{
+				"bsonType": "object",
+				"required": []string{"name"},
+				"properties": bson.M{
+					"name": bson.M{"bsonType": "string", "minLength": 1},
+				},
+			}},
+			{Collection: "features", Schema: bson.M{
+				"bsonType": "object",
+				"required": []string{"type", "geometry", "properties"},
+				"properties": bson.M{
+					"type": bson.M{"enum": []string{"Feature"}},
+					"geometry": bson.M{
+						"bsonType": "object",
+						"required": []string{"type", "coordinates"},
+						"properties": bson.M{
+							"type":        bson.M{"enum": []string{"Point", "MultiPoint", "LineString", "MultiLineString", "Polygon", "MultiPolygon"}},
+							"coordinates": bson.M{"bsonType": "array"},
+						},
+					},
+					"properties": bson.M{
+						"bsonType": "object",
+						"required": []string{"name", "collectionId"},
+						"properties": bson.M{
+							"collectionId": bson.M{"bsonType": "objectId"},
+						},
+					},
+				},
+			}},
+		},
+	},
+}
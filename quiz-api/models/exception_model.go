@@ -0,0 +1,13 @@
+package models
+
+// Exception is the error response, an RFC 7807 problem details object
+type Exception struct {
+	Code      string      `json:"code,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Title     string      `json:"title,omitempty"`
+	Status    *int        `json:"status,omitempty"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	RequestID string      `json:"request_id,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
+}
@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"quiz-api/models"
+	shared "shared/repository"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound, Query and UpdateResult are the ones of the shared repository
+var ErrNotFound = shared.ErrNotFound
+
+type (
+	Query        = shared.Query
+	UpdateResult = shared.UpdateResult
+)
+
+// CollectionRepository stores collections
+type CollectionRepository interface {
+	shared.Repository[models.Collection]
+}
+
+// FeatureRepository stores the features of the collections
+type FeatureRepository interface {
+	shared.Repository[models.Feature]
+}
+
+// Collection names of the repositories
+const (
+	CollectionCollection = "collections"
+	FeatureCollection    = "features"
+)
+
+// NewMongo reads and writes the documents of collection
+func NewMongo[T any](collection *mongo.Collection) shared.Repository[T] {
+	return shared.NewMongo[T](collection)
+}
+
+// NewMongoCollections stores collections in the collections collection of db
+func NewMongoCollections(db *mongo.Database) CollectionRepository {
+	return shared.NewMongo[models.Collection](db.Collection(CollectionCollection))
+}
+
+// NewMongoFeatures stores features in the features collection of db
+func NewMongoFeatures(db *mongo.Database) FeatureRepository {
+	return shared.NewMongo[models.Feature](db.Collection(FeatureCollection))
+}
+
+// NewMemoryCollections keeps collections in memory, for tests
+func NewMemoryCollections() CollectionRepository {
+	return shared.NewMemory[models.Collection]()
+}
+
+// NewMemoryFeatures keeps features in memory, for tests
+func NewMemoryFeatures() FeatureRepository {
+	return shared.NewMemory[models.Feature]()
+}
@@ -6,14 +6,14 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func CollectionRoute(e *echo.Echo) {
-	e.POST("/collections", controllers.CreateCollection) 
-	e.GET("/collections", controllers.GetAllCollections) 
-	e.GET("/collections/:collectionId", controllers.GetCollection) 
-	e.PUT("/collections/:collectionId", controllers.UpdateCollection) 
-	e.DELETE("/collections/:collectionId", controllers.DeleteCollection) 
-	
+func CollectionRoute(e *echo.Echo, h *controllers.Handler) {
+	e.POST("/collections", h.CreateCollection)
+	e.GET("/collections", h.GetAllCollections)
+	e.GET("/collections/:collectionId", h.GetCollection)
+	e.PUT("/collections/:collectionId", h.UpdateCollection)
+	e.DELETE("/collections/:collectionId", h.DeleteCollection)
+
 	//-------------------------------------------------------------//
-	e.POST("/api/v2/collections", controllers.CreateManyCollection)
-	e.DELETE("/api/v2/collections/:collectionId", controllers.DeleteCollectionV2)
-}
\ No newline at end of file
+	e.POST("/api/v2/collections", h.CreateManyCollection)
+	e.DELETE("/api/v2/collections/:collectionId", h.DeleteCollectionV2)
+}
@@ -6,14 +6,14 @@ import (
 	"github.com/labstack/echo/v4"
 )
 
-func FeatureRoute(e *echo.Echo) {
-	e.POST("/collections/:collectionId/items", controllers.CreateFeature) 
-	e.GET("/collections/:collectionId/items", controllers.GetAllFeatures) 
-	e.GET("/collections/:collectionId/items/:featureId", controllers.GetFeature) 
-	e.PUT("/collections/:collectionId/items/:featureId", controllers.UpdateFeature) 
-	e.DELETE("/collections/:collectionId/items/:featureId", controllers.DeleteFeature)	
+func FeatureRoute(e *echo.Echo, h *controllers.Handler) {
+	e.POST("/collections/:collectionId/items", h.CreateFeature)
+	e.GET("/collections/:collectionId/items", h.GetAllFeatures)
+	e.GET("/collections/:collectionId/items/:featureId", h.GetFeature)
+	e.PUT("/collections/:collectionId/items/:featureId", h.UpdateFeature)
+	e.DELETE("/collections/:collectionId/items/:featureId", h.DeleteFeature)
 
 	//-------------------------------------------------------------//
-	e.POST("/api/v2/collections/:collectionId/items", controllers.CreateFeatureV2)
-	e.DELETE("/api/v2/collections/:collectionId/items/:featureId", controllers.DeletedFeatureV2)
+	e.POST("/api/v2/collections/:collectionId/items", h.CreateFeatureV2)
+	e.DELETE("/api/v2/collections/:collectionId/items/:featureId", h.DeletedFeatureV2)
 }
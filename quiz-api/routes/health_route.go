@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"net/http"
+
+	"shared/health"
+
+	"github.com/labstack/echo/v4"
+)
+
+func HealthRoute(e *echo.Echo, checker *health.Checker) {
+	e.GET("/healthz", echo.WrapHandler(http.HandlerFunc(health.Live)))
+	e.GET("/readyz", echo.WrapHandler(checker))
+}
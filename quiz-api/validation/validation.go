@@ -0,0 +1,69 @@
+package validation
+
+import (
+	"fmt"
+
+	shared "shared/validation"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type (
+	FieldError = shared.FieldError
+	Errors     = shared.Errors
+)
+
+var validate = shared.New(
+	shared.Rule{
+		Tag:  "coordinates",
+		Func: validateCoordinates,
+		Message: func(field string, param string) string {
+			return field + " should only hold numbers"
+		},
+	},
+	shared.Rule{
+		Tag:  "haskey",
+		Func: validateHasKey,
+		Message: func(field string, param string) string {
+			return fmt.Sprintf("%s.%s is required", field, param)
+		},
+	},
+)
+
+// Struct checks the validate tags of v
+func Struct(v interface{}) Errors {
+	return validate.Struct(v)
+}
+
+// Slice checks every item of items and sets the index of each error
+func Slice(items interface{}) Errors {
+	return validate.Slice(items)
+}
+
+// validateCoordinates accepts GeoJSON coordinates, numbers or arrays of
+// coordinates nested at any depth
+func validateCoordinates(fl validator.FieldLevel) bool {
+	coordinates, ok := fl.Field().Interface().([]interface{})
+	return ok && numericCoordinates(coordinates)
+}
+
+func numericCoordinates(coordinates []interface{}) bool {
+	for _, coord := range coordinates {
+		switch value := coord.(type) {
+		case float64, int, int32, int64:
+		case []interface{}:
+			if !numericCoordinates(value) {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validateHasKey checks a map holds a non null value for the key given as param
+func validateHasKey(fl validator.FieldLevel) bool {
+	properties, ok := fl.Field().Interface().(map[string]interface{})
+	return ok && properties[fl.Param()] != nil
+}
@@ -0,0 +1,223 @@
+// Package config loads the typed configuration of a service. A value is
+// taken from the environment, then from the yaml file, then from the default
+// tag of its field. The package is shared by the services, each one declares
+// its Config from the sections of this package and its own.
+package config
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+)
+
+// FileEnv names the yaml file of the configuration. The file is optional
+// unless it is named, config.yaml is read when it exists
+const FileEnv = "CONFIG_FILE"
+
+const defaultFile = "config.yaml"
+
+// Validator is a section of a configuration that checks its values once
+// they are loaded
+type Validator interface {
+	Validate() error
+}
+
+// Load fills cfg, a pointer to a struct. The fields a service set before
+// calling Load are kept as defaults, the default tags fill the zero ones.
+// A .env file is read into the environment first when there is one, a
+// variable already set wins over it. Every section implementing Validator is
+// validated, the errors of all of them are returned together
+func Load(cfg interface{}) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		return errors.New("config: Load needs a pointer to a struct")
+	}
+
+	if err := godotenv.Load(); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("config: .env: %v", err)
+	}
+
+	if err := walk(v.Elem(), "", setDefault); err != nil {
+		return err
+	}
+	if err := loadFile(cfg); err != nil {
+		return err
+	}
+	if err := walk(v.Elem(), "", setEnv); err != nil {
+		return err
+	}
+
+	if errs := validate(v.Elem(), ""); len(errs) > 0 {
+		return fmt.Errorf("config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+// loadFile decodes the yaml file over cfg, a key the configuration does not
+// have is an error so a typo is not silently ignored
+func loadFile(cfg interface{}) error {
+	path, named := os.LookupEnv(FileEnv)
+	if !named || path == "" {
+		path = defaultFile
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) && path == defaultFile {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("config: %v", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("config: %s: %v", path, err)
+	}
+	return nil
+}
+
+// walk calls set with every field of v that is not a section, path is the
+// yaml path of v
+func walk(v reflect.Value, path string, set func(field reflect.Value, f reflect.StructField, path string) error) error {
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+
+		fieldPath := path + yamlName(f)
+		if isSection(f.Type) {
+			if err := walk(v.Field(i), fieldPath+".", set); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if err := set(v.Field(i), f, fieldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setDefault(field reflect.Value, f reflect.StructField, path string) error {
+	value, ok := f.Tag.Lookup("default")
+	if !ok || !field.IsZero() {
+		return nil
+	}
+	if err := setString(field, value); err != nil {
+		return fmt.Errorf("config: default of %s: %v", path, err)
+	}
+	return nil
+}
+
+// setEnv sets field from its variable, an empty variable is the same as an unset one
+func setEnv(field reflect.Value, f reflect.StructField, path string) error {
+	name := f.Tag.Get("env")
+	if name == "" {
+		return nil
+	}
+
+	value := os.Getenv(name)
+	if value == "" {
+		return nil
+	}
+	if err := setString(field, value); err != nil {
+		return fmt.Errorf("config: %s: %v", name, err)
+	}
+	return nil
+}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// setString parses s into field. A list is comma separated, a duration is
+// written like 30s or 5m
+func setString(field reflect.Value, s string) error {
+	switch {
+	case field.Type() == durationType:
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration", s)
+		}
+		field.SetInt(int64(d))
+	case field.Kind() == reflect.String:
+		field.SetString(s)
+	case field.Kind() == reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q should be true or false", s)
+		}
+		field.SetBool(b)
+	case field.CanInt():
+		n, err := strconv.ParseInt(s, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		field.SetInt(n)
+	case field.Kind() == reflect.Slice && field.Type().Elem().Kind() == reflect.String:
+		items := []string{}
+		for _, item := range strings.Split(s, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		field.Set(reflect.ValueOf(items).Convert(field.Type()))
+	default:
+		return fmt.Errorf("%s fields can not be configured", field.Type())
+	}
+	return nil
+}
+
+// validate runs the Validator of v and of its sections, an error is prefixed
+// with the path of its section
+func validate(v reflect.Value, path string) []error {
+	errs := []error{}
+	if validator, ok := v.Addr().Interface().(Validator); ok {
+		if err := validator.Validate(); err != nil {
+			// the errors of a section joined together are prefixed one by one
+			sectionErrs := []error{err}
+			if joined, ok := err.(interface{ Unwrap() []error }); ok {
+				sectionErrs = joined.Unwrap()
+			}
+			for _, err := range sectionErrs {
+				if path != "" {
+					err = fmt.Errorf("%s: %w", strings.TrimSuffix(path, "."), err)
+				}
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if f := t.Field(i); f.IsExported() && isSection(f.Type) {
+			errs = append(errs, validate(v.Field(i), path+yamlName(f)+".")...)
+		}
+	}
+	return errs
+}
+
+// isSection reports whether a field of type t groups other fields
+func isSection(t reflect.Type) bool {
+	return t.Kind() == reflect.Struct && t != reflect.TypeOf(time.Time{})
+}
+
+// yamlName is the key of f in the yaml file
+func yamlName(f reflect.StructField) string {
+	if name, _, _ := strings.Cut(f.Tag.Get("yaml"), ","); name != "" {
+		return name
+	}
+	return strings.ToLower(f.Name)
+}
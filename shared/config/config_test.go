@@ -0,0 +1,177 @@
+package config
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testConfig struct {
+	Server Server   `yaml:"server"`
+	Mongo  Mongo    `yaml:"mongo"`
+	Redis  Redis    `yaml:"redis"`
+	Tags   []string `yaml:"tags" env:"TEST_TAGS"`
+	Debug  bool     `yaml:"debug" env:"TEST_DEBUG"`
+}
+
+// inEmptyDir runs the test in a directory of its own, without a config.yaml
+// or a .env, and with the variables of the configuration unset. files are
+// written to the directory
+func inEmptyDir(t *testing.T, files map[string]string) {
+	t.Helper()
+
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, name := range []string{FileEnv, "HTTP_ADDR", "SHUTDOWN_DRAIN_DELAY", "SHUTDOWN_TIMEOUT", "MONGOURI", "MONGO_DATABASE", "MONGO_CONNECT_TIMEOUT", "REDIS_ADDR", "REDIS_PASSWORD", "REDIS_DB", "TEST_TAGS", "TEST_DEBUG"} {
+		// Setenv restores the variable after the test, it is unset so a .env can set it
+		t.Setenv(name, "")
+		os.Unsetenv(name)
+	}
+
+	for name, content := range files {
+		if err := os.WriteFile(name, []byte(content), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestLoadDefaults(t *testing.T) {
+	inEmptyDir(t, nil)
+
+	cfg := testConfig{Mongo: Mongo{Database: "quiz"}}
+	if err := Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	want := testConfig{
+		Server: Server{Addr: ":8000", DrainDelay: 5 * time.Second, ShutdownTimeout: 30 * time.Second},
+		Mongo:  Mongo{URI: "mongodb://localhost:27017", Database: "quiz", ConnectTimeout: 10 * time.Second},
+		Redis:  Redis{Addr: "localhost:6379"},
+	}
+	if !reflect.DeepEqual(cfg, want) {
+		t.Errorf("cfg = %+v, want %+v", cfg, want)
+	}
+}
+
+func TestLoadFileThenEnv(t *testing.T) {
+	inEmptyDir(t, map[string]string{
+		"config.yaml": "server:\n  addr: \":9000\"\n  drainDelay: 1s\nmongo:\n  database: explore\ntags: [a]\n",
+		".env":        "HTTP_ADDR=:7000\nREDIS_DB=2\n",
+	})
+	t.Setenv("REDIS_DB", "3")
+	t.Setenv("TEST_TAGS", "b, c,")
+	t.Setenv("TEST_DEBUG", "true")
+
+	var cfg testConfig
+	if err := Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+
+	if cfg.Server.Addr != ":7000" {
+		t.Errorf("addr = %q, want the .env value over the file", cfg.Server.Addr)
+	}
+	if cfg.Server.DrainDelay != time.Second || cfg.Mongo.Database != "explore" {
+		t.Errorf("drainDelay = %v, database = %q, want the values of the file", cfg.Server.DrainDelay, cfg.Mongo.Database)
+	}
+	if cfg.Redis.DB != 3 {
+		t.Errorf("db = %d, want the variable already set over the .env", cfg.Redis.DB)
+	}
+	if !reflect.DeepEqual(cfg.Tags, []string{"b", "c"}) || !cfg.Debug {
+		t.Errorf("tags = %q, debug = %v", cfg.Tags, cfg.Debug)
+	}
+}
+
+func TestLoadNamedFile(t *testing.T) {
+	inEmptyDir(t, map[string]string{"api.yaml": "mongo:\n  database: cache\n"})
+
+	t.Setenv(FileEnv, "api.yaml")
+	var cfg testConfig
+	if err := Load(&cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Mongo.Database != "cache" {
+		t.Errorf("database = %q, want the one of the named file", cfg.Mongo.Database)
+	}
+
+	t.Setenv(FileEnv, "missing.yaml")
+	if err := Load(&testConfig{}); err == nil {
+		t.Error("a missing named file is ignored")
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		env   map[string]string
+		want  []string
+	}{
+		{
+			name:  "unknown key",
+			files: map[string]string{"config.yaml": "mongo:\n  database: quiz\n  databse: typo\n"},
+			want:  []string{"databse"},
+		},
+		{
+			name: "bad variable",
+			env:  map[string]string{"MONGO_DATABASE": "quiz", "SHUTDOWN_TIMEOUT": "soon"},
+			want: []string{"SHUTDOWN_TIMEOUT"},
+		},
+		{
+			name: "negative drain delay",
+			env:  map[string]string{"MONGO_DATABASE": "quiz", "SHUTDOWN_DRAIN_DELAY": "-1s"},
+			want: []string{"server: drainDelay should not be negative"},
+		},
+		{
+			name: "every section is validated",
+			env:  map[string]string{"MONGOURI": "localhost", "REDIS_DB": "-1"},
+			want: []string{"mongo: uri should be", "mongo: database is required", "redis: db should not be negative"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			inEmptyDir(t, tt.files)
+			for name, value := range tt.env {
+				t.Setenv(name, value)
+			}
+
+			err := Load(&testConfig{})
+			if err == nil {
+				t.Fatal("Load succeeded")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error = %v, want %q", err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadNeedsStructPointer(t *testing.T) {
+	if err := Load(testConfig{}); err == nil {
+		t.Error("Load accepted a struct value")
+	}
+}
+
+func TestServerDrainDelay(t *testing.T) {
+	s := Server{Addr: ":8000", ShutdownTimeout: time.Second}
+	if err := s.Validate(); err != nil {
+		t.Errorf("a zero drain delay is rejected: %v", err)
+	}
+
+	s.DrainDelay = -time.Second
+	if err := s.Validate(); err == nil {
+		t.Error("a negative drain delay is accepted")
+	}
+}
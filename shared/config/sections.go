@@ -0,0 +1,75 @@
+package config
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Server is the http server of a service
+type Server struct {
+	// Addr is the address the server listens on
+	Addr string `yaml:"addr" env:"HTTP_ADDR" default:":8000"`
+	// DrainDelay is how long a service told to stop keeps serving while its
+	// readiness fails, so it is taken out of the load balancer before its
+	// listener closes
+	DrainDelay time.Duration `yaml:"drainDelay" env:"SHUTDOWN_DRAIN_DELAY" default:"5s"`
+	// ShutdownTimeout bounds draining the requests, stopping the background
+	// jobs and disconnecting the clients once the drain delay is over
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT" default:"30s"`
+}
+
+func (s *Server) Validate() error {
+	errs := []error{}
+	if s.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if s.DrainDelay < 0 {
+		errs = append(errs, errors.New("drainDelay should not be negative"))
+	}
+	if s.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdownTimeout should be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Mongo is the database of a service. Each service sets the default of
+// Database to its own database before loading
+type Mongo struct {
+	URI      string `yaml:"uri" env:"MONGOURI" default:"mongodb://localhost:27017"`
+	Database string `yaml:"database" env:"MONGO_DATABASE"`
+	// ConnectTimeout bounds the connection and the first ping
+	ConnectTimeout time.Duration `yaml:"connectTimeout" env:"MONGO_CONNECT_TIMEOUT" default:"10s"`
+}
+
+func (m *Mongo) Validate() error {
+	errs := []error{}
+	if !strings.HasPrefix(m.URI, "mongodb://") && !strings.HasPrefix(m.URI, "mongodb+srv://") {
+		errs = append(errs, errors.New("uri should be a mongodb:// or mongodb+srv:// uri"))
+	}
+	if m.Database == "" {
+		errs = append(errs, errors.New("database is required"))
+	}
+	if m.ConnectTimeout <= 0 {
+		errs = append(errs, errors.New("connectTimeout should be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// Redis is the cache of a service
+type Redis struct {
+	Addr     string `yaml:"addr" env:"REDIS_ADDR" default:"localhost:6379"`
+	Password string `yaml:"password" env:"REDIS_PASSWORD"`
+	DB       int    `yaml:"db" env:"REDIS_DB"`
+}
+
+func (r *Redis) Validate() error {
+	errs := []error{}
+	if r.Addr == "" {
+		errs = append(errs, errors.New("addr is required"))
+	}
+	if r.DB < 0 {
+		errs = append(errs, errors.New("db should not be negative"))
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,130 @@
+// Package health serves the liveness and readiness probes of a service.
+// The handlers are plain net/http handlers so every service mounts them
+// whatever version of echo it uses.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// checkTimeout bounds each readiness check so a hung dependency fails the probe
+// instead of blocking it
+const checkTimeout = 2 * time.Second
+
+const (
+	statusUp   = "up"
+	statusDown = "down"
+)
+
+// Check reports whether a dependency of the service can be used
+type Check func(ctx context.Context) error
+
+// Checker is the readiness of a service, ready when every check passes and
+// the service is not shutting down
+type Checker struct {
+	names    []string
+	checks   []Check
+	draining atomic.Bool
+}
+
+// Report is the body of the probes
+type Report struct {
+	Status string            `json:"status"`
+	Checks map[string]Result `json:"checks,omitempty"`
+}
+
+// Result is the outcome of one check
+type Result struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func New() *Checker {
+	return &Checker{}
+}
+
+// Add adds a check named name, checks are added before the probes are served
+func (c *Checker) Add(name string, check Check) {
+	c.names = append(c.names, name)
+	c.checks = append(c.checks, check)
+}
+
+// Drain makes the service report it is not ready, so it stops getting new
+// traffic while it shuts down
+func (c *Checker) Drain() {
+	c.draining.Store(true)
+}
+
+// Ready runs the checks concurrently, it reports whether they all passed
+func (c *Checker) Ready(ctx context.Context) (Report, bool) {
+	results := make([]Result, len(c.checks))
+
+	var wg sync.WaitGroup
+	for i, check := range c.checks {
+		wg.Add(1)
+		go func(i int, check Check) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, checkTimeout)
+			defer cancel()
+
+			results[i] = Result{Status: statusUp}
+			if err := check(ctx); err != nil {
+				results[i] = Result{Status: statusDown, Error: err.Error()}
+			}
+		}(i, check)
+	}
+	wg.Wait()
+
+	report := Report{Status: statusUp, Checks: map[string]Result{}}
+	for i, result := range results {
+		report.Checks[c.names[i]] = result
+		if result.Status != statusUp {
+			report.Status = statusDown
+		}
+	}
+
+	if c.draining.Load() {
+		report.Status = statusDown
+		report.Checks["shutdown"] = Result{Status: statusDown, Error: "the service is shutting down"}
+	}
+
+	return report, report.Status == statusUp
+}
+
+// Live answers /healthz, the process is up as long as it can answer
+func Live(w http.ResponseWriter, r *http.Request) {
+	write(w, http.StatusOK, Report{Status: statusUp})
+}
+
+// ServeHTTP answers /readyz, 503 when a check failed
+func (c *Checker) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	report, ok := c.Ready(r.Context())
+
+	status := http.StatusOK
+	if !ok {
+		status = http.StatusServiceUnavailable
+	}
+	write(w, status, report)
+}
+
+func write(w http.ResponseWriter, status int, report Report) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(report)
+}
+
+// Mongo checks client can reach its primary
+func Mongo(client *mongo.Client) Check {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx, nil)
+	}
+}
@@ -0,0 +1,58 @@
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Main is the migrate command of a service, open connects to its database and
+// returns its migrations. The command applies the migrations or lists them
+//
+//	go run ./cmd/migrate up
+//	go run ./cmd/migrate status
+func Main(open func() (*mongo.Database, []Migration, error)) {
+	if len(os.Args) != 2 || (os.Args[1] != "up" && os.Args[1] != "status") {
+		usage()
+	}
+
+	db, migrations, err := open()
+	if err != nil {
+		log.Fatal(err)
+	}
+	ctx := context.Background()
+
+	switch os.Args[1] {
+	case "up":
+		applied, err := Run(ctx, db, migrations)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("no pending migrations")
+		}
+	case "status":
+		states, err := Status(ctx, db, migrations)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range states {
+			applied := "pending"
+			if !s.Pending() {
+				applied = s.Applied.AppliedAt.Format(time.RFC3339)
+			} else if s.Applied != nil {
+				applied = "changed"
+			}
+			fmt.Printf("%4d  %-25s  %s\n", s.Version, applied, s.Description)
+		}
+	}
+}
+
+func usage() {
+	fmt.Fprintln(os.Stderr, "usage: migrate up|status")
+	os.Exit(2)
+}
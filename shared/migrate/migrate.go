@@ -0,0 +1,284 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Collection records the applied migrations, by version
+const Collection = "migrations"
+
+const (
+	// lockID is the document of the migrations collection held while migrations run
+	lockID = "lock"
+	// lockTTL frees a lock left by a runner that died
+	lockTTL = 10 * time.Minute
+	// lockPoll is how often a runner waiting for the lock tries again
+	lockPoll = time.Second
+	// namespaceNotFound is the code of a command run on a missing collection
+	namespaceNotFound = 26
+)
+
+// Migration is a versioned change of the database. Its indexes are created
+// first, then its validators are set and Up runs last. A migration is applied
+// once, a failed one is tried again on the next run
+type Migration struct {
+	Version     int
+	Description string
+	Indexes     []Index
+	Validators  []Validator
+	// Up backfills data, it is optional
+	Up func(ctx context.Context, db *mongo.Database) error
+	// Checksum is the configuration the migration is made from, it is
+	// optional. An applied migration whose checksum changed is applied again
+	Checksum string
+}
+
+// Index is an index of a collection
+type Index struct {
+	Collection string
+	Keys       bson.D
+	// Options are optional, an index without a name is named after its keys
+	Options *options.IndexOptions
+}
+
+// Validator is the JSON Schema documents of a collection are checked against.
+// Level is strict or moderate, moderate by default so the documents written
+// before the validator are only checked once they are valid
+type Validator struct {
+	Collection string
+	Schema     bson.M
+	Level      string
+}
+
+// Applied is a migration recorded in the migrations collection
+type Applied struct {
+	Version     int       `json:"version" bson:"_id"`
+	Description string    `json:"description" bson:"description"`
+	AppliedAt   time.Time `json:"appliedAt" bson:"appliedAt"`
+	// Duration is how long the migration ran, in milliseconds
+	Duration int64  `json:"duration" bson:"duration"`
+	Checksum string `json:"checksum,omitempty" bson:"checksum,omitempty"`
+}
+
+// State is a migration and when it was applied, nil when it never was
+type State struct {
+	Migration
+	Applied *Applied
+}
+
+// Pending reports whether the migration has to be applied, it never was or
+// its checksum changed since
+func (s State) Pending() bool {
+	return s.Applied == nil || s.Applied.Checksum != s.Checksum
+}
+
+// check reports migrations that can not be run in order
+func check(migrations []Migration) ([]Migration, error) {
+	sorted := append([]Migration{}, migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+
+	for i, m := range sorted {
+		if m.Version < 1 {
+			return nil, fmt.Errorf("migration %q: version should be 1 or more", m.Description)
+		}
+		if i > 0 && sorted[i-1].Version == m.Version {
+			return nil, fmt.Errorf("migration version %d is declared twice", m.Version)
+		}
+	}
+	return sorted, nil
+}
+
+// Status lists migrations in order with when each was applied
+func Status(ctx context.Context, db *mongo.Database, migrations []Migration) ([]State, error) {
+	sorted, err := check(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	states := []State{}
+	for _, m := range sorted {
+		state := State{Migration: m}
+		if a, ok := applied[m.Version]; ok {
+			state.Applied = &a
+		}
+		states = append(states, state)
+	}
+	return states, nil
+}
+
+// Pending lists the migrations not applied yet, in order
+func Pending(ctx context.Context, db *mongo.Database, migrations []Migration) ([]Migration, error) {
+	states, err := Status(ctx, db, migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	pending := []Migration{}
+	for _, state := range states {
+		if state.Pending() {
+			pending = append(pending, state.Migration)
+		}
+	}
+	return pending, nil
+}
+
+func appliedVersions(ctx context.Context, db *mongo.Database) (map[int]Applied, error) {
+	cur, err := db.Collection(Collection).Find(ctx, bson.M{"_id": bson.M{"$type": "number"}})
+	if err != nil {
+		return nil, err
+	}
+
+	found := []Applied{}
+	if err := cur.All(ctx, &found); err != nil {
+		return nil, err
+	}
+
+	applied := map[int]Applied{}
+	for _, a := range found {
+		applied[a.Version] = a
+	}
+	return applied, nil
+}
+
+// Run applies the pending migrations in order and returns the ones it
+// applied. Runners started together wait for each other, so only one applies
+// a migration
+func Run(ctx context.Context, db *mongo.Database, migrations []Migration) ([]Applied, error) {
+	sorted, err := check(migrations)
+	if err != nil {
+		return nil, err
+	}
+
+	unlock, err := lock(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	applied, err := appliedVersions(ctx, db)
+	if err != nil {
+		return nil, err
+	}
+
+	done := []Applied{}
+	for _, m := range sorted {
+		if a, ok := applied[m.Version]; ok && a.Checksum == m.Checksum {
+			continue
+		}
+
+		start := time.Now()
+		if err := apply(ctx, db, m); err != nil {
+			return done, fmt.Errorf("migration %d (%s): %v", m.Version, m.Description, err)
+		}
+
+		a := Applied{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now(),
+			Duration:    time.Since(start).Milliseconds(),
+			Checksum:    m.Checksum,
+		}
+		_, err := db.Collection(Collection).ReplaceOne(ctx, bson.M{"_id": a.Version}, a, options.Replace().SetUpsert(true))
+		if err != nil {
+			return done, fmt.Errorf("migration %d (%s): %v", m.Version, m.Description, err)
+		}
+		log.Printf("migration %d applied: %s", m.Version, m.Description)
+		done = append(done, a)
+	}
+
+	return done, nil
+}
+
+func apply(ctx context.Context, db *mongo.Database, m Migration) error {
+	for _, index := range m.Indexes {
+		_, err := db.Collection(index.Collection).Indexes().CreateOne(ctx, mongo.IndexModel{Keys: index.Keys, Options: index.Options})
+		if err != nil {
+			return fmt.Errorf("index on %s: %v", index.Collection, err)
+		}
+	}
+
+	for _, v := range m.Validators {
+		if err := setValidator(ctx, db, v); err != nil {
+			return fmt.Errorf("validator of %s: %v", v.Collection, err)
+		}
+	}
+
+	if m.Up != nil {
+		return m.Up(ctx, db)
+	}
+	return nil
+}
+
+// setValidator sets the validator of a collection, a missing collection is
+// created with it
+func setValidator(ctx context.Context, db *mongo.Database, v Validator) error {
+	level := v.Level
+	if level == "" {
+		level = "moderate"
+	}
+	validator := bson.M{"$jsonSchema": v.Schema}
+
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: v.Collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: level},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Code == namespaceNotFound {
+		return db.CreateCollection(ctx, v.Collection, options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel(level).
+			SetValidationAction("error"))
+	}
+	return err
+}
+
+// lock takes the migration lock, waiting while another runner holds it. The
+// returned func releases it
+func lock(ctx context.Context, db *mongo.Database) (func(), error) {
+	coll := db.Collection(Collection)
+
+	for {
+		now := time.Now()
+		_, err := coll.UpdateOne(ctx,
+			bson.M{"_id": lockID, "lockedUntil": bson.M{"$lt": now}},
+			bson.M{"$set": bson.M{"lockedUntil": now.Add(lockTTL)}},
+			options.Update().SetUpsert(true))
+		if err == nil {
+			return func() {
+				// the lock is released even when ctx is done
+				releaseCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+				defer cancel()
+				if _, err := coll.DeleteOne(releaseCtx, bson.M{"_id": lockID}); err != nil {
+					log.Println("migrations: release lock:", err)
+				}
+			}, nil
+		}
+		// the lock document exists and is not expired, the upsert collided with it
+		if !mongo.IsDuplicateKeyError(err) {
+			return nil, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, fmt.Errorf("migrations are locked by another runner: %v", ctx.Err())
+		case <-time.After(lockPoll):
+		}
+	}
+}
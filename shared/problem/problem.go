@@ -0,0 +1,110 @@
+// Package problem writes errors as RFC 7807 problem details. It works on
+// net/http so every service wraps it for the version of echo it uses.
+package problem
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ContentType is the media type of every error response, RFC 7807
+const ContentType = "application/problem+json"
+
+// HeaderRequestID identifies a request in its logs and its problems
+const HeaderRequestID = "X-Request-ID"
+
+// codes of the problems that are more specific than their status
+const (
+	CodeValidation   = "validation_failed"
+	CodeDuplicateKey = "duplicate_key"
+	CodeTimeout      = "timeout"
+	CodeDatabase     = "database_error"
+)
+
+// Problem is a problem details object. A service naming its JSON fields its
+// own way converts it to a struct with the same fields and other tags
+type Problem struct {
+	Code      string      `json:"code,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Title     string      `json:"title,omitempty"`
+	Status    *int        `json:"status,omitempty"`
+	Detail    string      `json:"detail,omitempty"`
+	Instance  string      `json:"instance,omitempty"`
+	RequestID string      `json:"requestId,omitempty"`
+	Errors    interface{} `json:"errors,omitempty"`
+}
+
+// New builds the problem of r, code defaults to the snake cased status text
+func New(w http.ResponseWriter, r *http.Request, status int, code string, detail string) *Problem {
+	if code == "" {
+		code = StatusCode(status)
+	}
+
+	return &Problem{
+		Code:      code,
+		Type:      "about:blank",
+		Title:     http.StatusText(status),
+		Status:    &status,
+		Detail:    detail,
+		Instance:  r.URL.RequestURI(),
+		RequestID: RequestID(w, r),
+	}
+}
+
+// Send writes body, a Problem or its conversion, as application/problem+json
+func Send(w http.ResponseWriter, status int, body interface{}) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	w.Header().Set("Content-Type", ContentType)
+	w.WriteHeader(status)
+	_, err = w.Write(b)
+	return err
+}
+
+// MongoStatus maps a mongo error to its status code and problem code
+func MongoStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return http.StatusNotFound, StatusCode(http.StatusNotFound)
+	case mongo.IsDuplicateKeyError(err):
+		return http.StatusConflict, CodeDuplicateKey
+	case mongo.IsTimeout(err), errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout, CodeTimeout
+	}
+	return http.StatusInternalServerError, CodeDatabase
+}
+
+// SetRequestID gives the response of r an X-Request-ID, the one sent by the
+// client is kept
+func SetRequestID(w http.ResponseWriter, r *http.Request) {
+	id := r.Header.Get(HeaderRequestID)
+	if id == "" {
+		b := make([]byte, 16)
+		rand.Read(b)
+		id = hex.EncodeToString(b)
+	}
+	w.Header().Set(HeaderRequestID, id)
+}
+
+// RequestID is the id set by SetRequestID, or the one sent by the client
+func RequestID(w http.ResponseWriter, r *http.Request) string {
+	if id := w.Header().Get(HeaderRequestID); id != "" {
+		return id
+	}
+	return r.Header.Get(HeaderRequestID)
+}
+
+// StatusCode turns "Not Found" into "not_found"
+func StatusCode(status int) string {
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
+}
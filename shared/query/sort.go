@@ -0,0 +1,77 @@
+// Package query parses the query parameters shared by the list endpoints of
+// the services
+package query
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// SortSpec configures how a resource can be sorted
+type SortSpec struct {
+	// Fields maps the json name clients sort on to the bson key. Only list
+	// fields backed by an index, sorting on anything else scans the collection
+	Fields map[string]string
+	// Default is used when the client does not send a sort
+	Default bson.D
+}
+
+// ParseSort parses the sort query parameter. Both "-field" and "field:desc"
+// are accepted, fields are separated by commas and the direction defaults to asc
+func ParseSort(values []string, spec SortSpec) (bson.D, error) {
+	order := bson.D{}
+	seen := map[string]bool{}
+
+	for _, value := range values {
+		for _, qo := range strings.Split(value, ",") {
+			qo = strings.TrimSpace(qo)
+			if qo == "" {
+				continue
+			}
+
+			direction := 1
+			if strings.HasPrefix(qo, "-") {
+				direction = -1
+				qo = strings.TrimPrefix(qo, "-")
+			}
+
+			qoElems := strings.Split(qo, ":")
+			if len(qoElems) > 2 {
+				return nil, errors.New("wrong sort format, should be field, -field or field:desc")
+			}
+
+			if len(qoElems) == 2 {
+				elemValue := strings.ToLower(strings.TrimSpace(qoElems[1]))
+				if (elemValue != "asc" && elemValue != "desc") || direction == -1 {
+					return nil, errors.New("wrong direction, should be asc, desc or blank (default asc)")
+				}
+
+				if elemValue == "desc" {
+					direction = -1
+				}
+			}
+
+			name := strings.TrimSpace(qoElems[0])
+			key, ok := spec.Fields[name]
+			if !ok {
+				return nil, fmt.Errorf("sort on '%s' is not supported", name)
+			}
+
+			if seen[key] {
+				return nil, fmt.Errorf("'%s' is sorted more than once", name)
+			}
+			seen[key] = true
+
+			order = append(order, bson.E{Key: key, Value: direction})
+		}
+	}
+
+	if len(order) == 0 {
+		return append(bson.D{}, spec.Default...), nil
+	}
+
+	return order, nil
+}
@@ -0,0 +1,63 @@
+package query
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseSort(t *testing.T) {
+	spec := SortSpec{
+		Fields: map[string]string{
+			"id":        "_id",
+			"name":      "name",
+			"createdAt": "createdAt",
+		},
+		Default: bson.D{{Key: "createdAt", Value: -1}},
+	}
+
+	tests := []struct {
+		name   string
+		values []string
+		want   bson.D
+		err    bool
+	}{
+		{"default", nil, bson.D{{Key: "createdAt", Value: -1}}, false},
+		{"blank", []string{" , "}, bson.D{{Key: "createdAt", Value: -1}}, false},
+		{"ascending", []string{"name"}, bson.D{{Key: "name", Value: 1}}, false},
+		{"prefix", []string{"-name"}, bson.D{{Key: "name", Value: -1}}, false},
+		{"suffix", []string{"name:desc"}, bson.D{{Key: "name", Value: -1}}, false},
+		{"suffix asc", []string{"name:ASC"}, bson.D{{Key: "name", Value: 1}}, false},
+		{"bson key", []string{"id:desc"}, bson.D{{Key: "_id", Value: -1}}, false},
+		{"several", []string{"name, -createdAt"}, bson.D{{Key: "name", Value: 1}, {Key: "createdAt", Value: -1}}, false},
+		{"repeated parameter", []string{"name", "id"}, bson.D{{Key: "name", Value: 1}, {Key: "_id", Value: 1}}, false},
+		{"unknown field", []string{"price"}, nil, true},
+		{"unknown direction", []string{"name:up"}, nil, true},
+		{"both syntaxes", []string{"-name:desc"}, nil, true},
+		{"too many parts", []string{"name:desc:asc"}, nil, true},
+		{"sorted twice", []string{"name,-name"}, nil, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseSort(tt.values, spec)
+			if (err != nil) != tt.err {
+				t.Fatalf("ParseSort(%q) error = %v, want error %v", tt.values, err, tt.err)
+			}
+			if !tt.err && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseSort(%q) = %v, want %v", tt.values, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseSortKeepsDefault(t *testing.T) {
+	spec := SortSpec{Fields: map[string]string{}, Default: bson.D{{Key: "createdAt", Value: -1}}}
+
+	got, _ := ParseSort(nil, spec)
+	got[0].Value = 1
+	if spec.Default[0].Value != -1 {
+		t.Error("changing the parsed sort changed the default")
+	}
+}
@@ -0,0 +1,356 @@
+package repository
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// unsupported is the error of a query the memory repository can not run,
+// the handler using it needs a mongo repository to be tested
+func unsupported(what string) error {
+	return fmt.Errorf("memory repository: %s is not supported", what)
+}
+
+// matchFilter reports whether doc matches filter. It supports the field
+// operators $eq, $ne, $gt, $gte, $lt, $lte, $in, $nin, $exists and $regex and
+// the logical $and, $or and $nor
+func matchFilter(doc bson.M, filter bson.M) (bool, error) {
+	for key, cond := range filter {
+		var ok bool
+		var err error
+
+		switch key {
+		case "$and", "$or", "$nor":
+			ok, err = matchLogical(doc, key, cond)
+		default:
+			if strings.HasPrefix(key, "$") {
+				return false, unsupported("filter " + key)
+			}
+			value, exists := lookup(doc, key)
+			ok, err = matchCondition(value, exists, cond)
+		}
+
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func matchLogical(doc bson.M, op string, cond interface{}) (bool, error) {
+	filters, ok := cond.(primitive.A)
+	if !ok {
+		return false, fmt.Errorf("%s should be an array", op)
+	}
+
+	for _, f := range filters {
+		filter, ok := f.(bson.M)
+		if !ok {
+			return false, fmt.Errorf("%s should be an array of documents", op)
+		}
+
+		matched, err := matchFilter(doc, filter)
+		if err != nil {
+			return false, err
+		}
+
+		switch {
+		case op == "$and" && !matched:
+			return false, nil
+		case op == "$or" && matched:
+			return true, nil
+		case op == "$nor" && matched:
+			return false, nil
+		}
+	}
+	return op != "$or", nil
+}
+
+// matchCondition matches the value of a field against either a value or a
+// document of operators
+func matchCondition(value interface{}, exists bool, cond interface{}) (bool, error) {
+	ops, ok := cond.(bson.M)
+	if !ok || !isOperators(ops) {
+		return matchEqual(value, cond), nil
+	}
+
+	for op, arg := range ops {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = matchEqual(value, arg)
+		case "$ne":
+			ok = !matchEqual(value, arg)
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = exists && matchCompare(value, op, arg)
+		case "$in", "$nin":
+			values, isArray := arg.(primitive.A)
+			if !isArray {
+				return false, fmt.Errorf("%s should be an array", op)
+			}
+			ok = false
+			for _, v := range values {
+				if matchEqual(value, v) {
+					ok = true
+					break
+				}
+			}
+			if op == "$nin" {
+				ok = !ok
+			}
+		case "$exists":
+			ok = exists == truthy(arg)
+		case "$regex":
+			options, _ := ops["$options"].(string)
+			re, err := compileRegex(arg, options)
+			if err != nil {
+				return false, err
+			}
+			ok = matchRegex(value, re)
+		case "$options":
+			ok = true
+		default:
+			return false, unsupported("filter " + op)
+		}
+
+		if !ok {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func isOperators(doc bson.M) bool {
+	for key := range doc {
+		if !strings.HasPrefix(key, "$") {
+			return false
+		}
+	}
+	return len(doc) > 0
+}
+
+// matchEqual is equality the mongo way, a regex matches strings, null matches
+// a missing field and an array matches when one of its items does
+func matchEqual(value interface{}, cond interface{}) bool {
+	if regex, ok := cond.(primitive.Regex); ok {
+		re, err := compileRegex(regex, "")
+		return err == nil && matchRegex(value, re)
+	}
+
+	if items, ok := value.(primitive.A); ok {
+		if _, condIsArray := cond.(primitive.A); !condIsArray {
+			for _, item := range items {
+				if equalValues(item, cond) {
+					return true
+				}
+			}
+			return false
+		}
+	}
+	return equalValues(value, cond)
+}
+
+func matchCompare(value interface{}, op string, arg interface{}) bool {
+	if rank(value) != rank(arg) {
+		return false
+	}
+
+	c := compareValues(value, arg)
+	switch op {
+	case "$gt":
+		return c > 0
+	case "$gte":
+		return c >= 0
+	case "$lt":
+		return c < 0
+	}
+	return c <= 0
+}
+
+func compileRegex(pattern interface{}, options string) (*regexp.Regexp, error) {
+	expr := ""
+	switch p := pattern.(type) {
+	case string:
+		expr = p
+	case primitive.Regex:
+		expr = p.Pattern
+		options += p.Options
+	default:
+		return nil, fmt.Errorf("$regex should be a string")
+	}
+
+	if strings.Contains(options, "i") {
+		expr = "(?i)" + expr
+	}
+	return regexp.Compile(expr)
+}
+
+// matchRegex matches a string or, like mongo, any string item of an array
+func matchRegex(value interface{}, re *regexp.Regexp) bool {
+	if items, ok := value.(primitive.A); ok {
+		for _, item := range items {
+			if matchRegex(item, re) {
+				return true
+			}
+		}
+		return false
+	}
+
+	s, ok := value.(string)
+	return ok && re.MatchString(s)
+}
+
+// lookup returns the value of a dotted path of doc and whether it exists
+func lookup(doc bson.M, path string) (interface{}, bool) {
+	var value interface{} = doc
+	for _, key := range strings.Split(path, ".") {
+		sub, ok := value.(bson.M)
+		if !ok {
+			return nil, false
+		}
+		if value, ok = sub[key]; !ok {
+			return nil, false
+		}
+	}
+	return value, true
+}
+
+// setPath sets a dotted path of doc, creating the documents on the way
+func setPath(doc bson.M, path string, value interface{}) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := doc[key].(bson.M)
+		if !ok {
+			sub = bson.M{}
+			doc[key] = sub
+		}
+		doc = sub
+	}
+	doc[keys[len(keys)-1]] = value
+}
+
+func unsetPath(doc bson.M, path string) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys[:len(keys)-1] {
+		sub, ok := doc[key].(bson.M)
+		if !ok {
+			return
+		}
+		doc = sub
+	}
+	delete(doc, keys[len(keys)-1])
+}
+
+func truthy(v interface{}) bool {
+	switch b := v.(type) {
+	case bool:
+		return b
+	case nil:
+		return false
+	}
+	if n, ok := number(v); ok {
+		return n != 0
+	}
+	return true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	case float64:
+		return n, true
+	}
+	return 0, false
+}
+
+// rank is the place of the type of v in the order mongo sorts mixed types in
+func rank(v interface{}) int {
+	if _, ok := number(v); ok {
+		return 2
+	}
+	switch v.(type) {
+	case nil:
+		return 1
+	case string:
+		return 3
+	case bson.M:
+		return 4
+	case primitive.A:
+		return 5
+	case primitive.ObjectID:
+		return 7
+	case bool:
+		return 8
+	case primitive.DateTime:
+		return 9
+	}
+	return 10
+}
+
+// compareValues orders two values, values of different types by their rank
+func compareValues(a, b interface{}) int {
+	ra, rb := rank(a), rank(b)
+	if ra != rb {
+		return ra - rb
+	}
+
+	switch x := a.(type) {
+	case string:
+		return strings.Compare(x, b.(string))
+	case primitive.ObjectID:
+		y := b.(primitive.ObjectID)
+		return bytes.Compare(x[:], y[:])
+	case primitive.DateTime:
+		return compareInts(int64(x), int64(b.(primitive.DateTime)))
+	case bool:
+		y := b.(bool)
+		if x == y {
+			return 0
+		} else if !x {
+			return -1
+		}
+		return 1
+	}
+
+	if x, ok := number(a); ok {
+		y, _ := number(b)
+		switch {
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	return 0
+}
+
+func compareInts(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func equalValues(a, b interface{}) bool {
+	x, xIsNumber := number(a)
+	y, yIsNumber := number(b)
+	if xIsNumber || yIsNumber {
+		return xIsNumber && yIsNumber && x == y
+	}
+	return reflect.DeepEqual(a, b)
+}
@@ -0,0 +1,94 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestMatchFilter(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	doc := bson.M{
+		"name":      "Rice",
+		"price":     int32(40),
+		"weight":    2.5,
+		"tags":      primitive.A{"food", "thai"},
+		"createdAt": primitive.NewDateTimeFromTime(created),
+		"origin":    bson.M{"country": "TH"},
+		"deletedAt": nil,
+	}
+
+	tests := []struct {
+		name   string
+		filter bson.M
+		want   bool
+	}{
+		{"empty", bson.M{}, true},
+		{"equal", bson.M{"name": "Rice"}, true},
+		{"not equal", bson.M{"name": "Corn"}, false},
+		{"number across types", bson.M{"price": int64(40)}, true},
+		{"dotted path", bson.M{"origin.country": "TH"}, true},
+		{"null matches null", bson.M{"deletedAt": nil}, true},
+		{"null matches missing", bson.M{"missing": nil}, true},
+		{"array contains", bson.M{"tags": "thai"}, true},
+		{"$eq", bson.M{"price": bson.M{"$eq": 40}}, true},
+		{"$ne", bson.M{"price": bson.M{"$ne": 40}}, false},
+		{"$ne missing", bson.M{"missing": bson.M{"$ne": 40}}, true},
+		{"$gt", bson.M{"price": bson.M{"$gt": 39}}, true},
+		{"$gte", bson.M{"price": bson.M{"$gte": 40}}, true},
+		{"$lt", bson.M{"weight": bson.M{"$lt": 2.5}}, false},
+		{"$lte", bson.M{"weight": bson.M{"$lte": 2.5}}, true},
+		{"range", bson.M{"price": bson.M{"$gt": 10, "$lt": 20}}, false},
+		{"compare missing", bson.M{"missing": bson.M{"$lt": 10}}, false},
+		{"compare dates", bson.M{"createdAt": bson.M{"$gte": primitive.NewDateTimeFromTime(created)}}, true},
+		{"$in", bson.M{"name": bson.M{"$in": primitive.A{"Corn", "Rice"}}}, true},
+		{"$in array", bson.M{"tags": bson.M{"$in": primitive.A{"drink", "thai"}}}, true},
+		{"$nin", bson.M{"name": bson.M{"$nin": primitive.A{"Corn", "Rice"}}}, false},
+		{"$exists", bson.M{"origin": bson.M{"$exists": true}}, true},
+		{"$exists false", bson.M{"missing": bson.M{"$exists": false}}, true},
+		{"$exists null", bson.M{"deletedAt": bson.M{"$exists": false}}, false},
+		{"$regex", bson.M{"name": bson.M{"$regex": "^ri", "$options": "i"}}, true},
+		{"$regex case", bson.M{"name": bson.M{"$regex": "^ri"}}, false},
+		{"$regex array", bson.M{"tags": bson.M{"$regex": "^th"}}, true},
+		{"$and", bson.M{"$and": primitive.A{bson.M{"name": "Rice"}, bson.M{"price": 41}}}, false},
+		{"$or", bson.M{"$or": primitive.A{bson.M{"name": "Corn"}, bson.M{"price": 40}}}, true},
+		{"$or none", bson.M{"$or": primitive.A{bson.M{"name": "Corn"}, bson.M{"price": 41}}}, false},
+		{"$nor", bson.M{"$nor": primitive.A{bson.M{"name": "Corn"}, bson.M{"price": 41}}}, true},
+		{"$and with field", bson.M{"name": "Rice", "$and": primitive.A{bson.M{"price": 40}}}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := matchFilter(doc, tt.filter)
+			if err != nil {
+				t.Fatalf("matchFilter(%v) error: %v", tt.filter, err)
+			}
+			if got != tt.want {
+				t.Errorf("matchFilter(%v) = %v, want %v", tt.filter, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchFilterErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		filter bson.M
+	}{
+		{"unsupported top level", bson.M{"$where": "true"}},
+		{"unsupported operator", bson.M{"name": bson.M{"$elemMatch": bson.M{}}}},
+		{"$in not an array", bson.M{"name": bson.M{"$in": "Rice"}}},
+		{"$and not an array", bson.M{"$and": bson.M{"name": "Rice"}}},
+		{"invalid regex", bson.M{"name": bson.M{"$regex": "("}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := matchFilter(bson.M{"name": "Rice"}, tt.filter); err == nil {
+				t.Errorf("matchFilter(%v) should fail", tt.filter)
+			}
+		})
+	}
+}
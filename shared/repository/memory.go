@@ -0,0 +1,321 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// duplicateKey is the code of the write error of a document whose _id is taken
+const duplicateKey = 11000
+
+// memoryRepository is a Repository kept in memory for tests. Documents are
+// stored as bson so filters, sorts, projections and updates behave like they
+// do in mongo for the operators matchFilter supports
+type memoryRepository[T any] struct {
+	mu   sync.Mutex
+	docs []bson.M
+}
+
+func newMemoryRepository[T any]() *memoryRepository[T] {
+	return &memoryRepository[T]{}
+}
+
+func (r *memoryRepository[T]) Insert(ctx context.Context, docs ...T) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, doc := range docs {
+		m, err := toDocument(doc)
+		if err != nil {
+			return err
+		}
+		if r.indexOf(m["_id"]) >= 0 {
+			return mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{{
+				WriteError: mongo.WriteError{Index: i, Code: duplicateKey, Message: fmt.Sprintf("duplicate key _id: %v", m["_id"])},
+			}}}
+		}
+		r.docs = append(r.docs, m)
+	}
+	return nil
+}
+
+func (r *memoryRepository[T]) Get(ctx context.Context, filter bson.M, projection bson.M, result interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	docs, err := r.find(Query{Filter: filter, Projection: projection, Limit: 1})
+	if err != nil {
+		return err
+	}
+	if len(docs) == 0 {
+		return ErrNotFound
+	}
+	return decode(docs[0], result)
+}
+
+func (r *memoryRepository[T]) Find(ctx context.Context, q Query, results interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	docs, err := r.find(q)
+	if err != nil {
+		return err
+	}
+	return decodeAll(docs, results)
+}
+
+// find returns the documents of q, the caller holds the lock
+func (r *memoryRepository[T]) find(q Query) ([]bson.M, error) {
+	filter, err := toDocument(q.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	found := []bson.M{}
+	for _, doc := range r.docs {
+		ok, err := matchFilter(doc, filter)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			found = append(found, doc)
+		}
+	}
+
+	if err := sortDocuments(found, q.Sort); err != nil {
+		return nil, err
+	}
+
+	if q.Skip > 0 {
+		if q.Skip > int64(len(found)) {
+			q.Skip = int64(len(found))
+		}
+		found = found[q.Skip:]
+	}
+	if q.Limit > 0 && q.Limit < int64(len(found)) {
+		found = found[:q.Limit]
+	}
+
+	for i, doc := range found {
+		if found[i], err = project(doc, q.Projection); err != nil {
+			return nil, err
+		}
+	}
+
+	return found, nil
+}
+
+func (r *memoryRepository[T]) Count(ctx context.Context, filter bson.M) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	docs, err := r.find(Query{Filter: filter})
+	return int64(len(docs)), err
+}
+
+func (r *memoryRepository[T]) Update(ctx context.Context, filter bson.M, update bson.M) (UpdateResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	docs, err := r.find(Query{Filter: filter, Limit: 1})
+	if err != nil || len(docs) == 0 {
+		return UpdateResult{}, err
+	}
+
+	changes, err := toDocument(update)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	i := r.indexOf(docs[0]["_id"])
+	if i < 0 {
+		return UpdateResult{}, nil
+	}
+
+	updated, err := applyUpdate(r.docs[i], changes)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+
+	result := UpdateResult{Matched: 1}
+	if !reflect.DeepEqual(updated, r.docs[i]) {
+		r.docs[i] = updated
+		result.Modified = 1
+	}
+	return result, nil
+}
+
+func (r *memoryRepository[T]) Delete(ctx context.Context, filter bson.M) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	docs, err := r.find(Query{Filter: filter, Limit: 1})
+	if err != nil || len(docs) == 0 {
+		return 0, err
+	}
+
+	i := r.indexOf(docs[0]["_id"])
+	if i < 0 {
+		return 0, nil
+	}
+	r.docs = append(r.docs[:i], r.docs[i+1:]...)
+	return 1, nil
+}
+
+// indexOf is the position of the document of id, -1 when there is none
+func (r *memoryRepository[T]) indexOf(id interface{}) int {
+	for i, doc := range r.docs {
+		if equalValues(doc["_id"], id) {
+			return i
+		}
+	}
+	return -1
+}
+
+// toDocument converts v to the bson.M mongo would store, a nil v is an empty document
+func toDocument(v interface{}) (bson.M, error) {
+	doc := bson.M{}
+	if v == nil || reflect.ValueOf(v).Kind() == reflect.Map && reflect.ValueOf(v).IsNil() {
+		return doc, nil
+	}
+
+	b, err := bson.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return doc, bson.Unmarshal(b, &doc)
+}
+
+func decode(doc bson.M, result interface{}) error {
+	b, err := bson.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	return bson.Unmarshal(b, result)
+}
+
+// decodeAll decodes docs into results, a pointer to a slice
+func decodeAll(docs []bson.M, results interface{}) error {
+	items := reflect.ValueOf(results).Elem()
+	decoded := reflect.MakeSlice(items.Type(), len(docs), len(docs))
+
+	for i, doc := range docs {
+		if err := decode(doc, decoded.Index(i).Addr().Interface()); err != nil {
+			return err
+		}
+	}
+
+	items.Set(decoded)
+	return nil
+}
+
+// sortDocuments orders docs by sorts, documents missing a field come first
+// in ascending order like in mongo
+func sortDocuments(docs []bson.M, sorts bson.D) error {
+	directions := make([]int, len(sorts))
+	for i, s := range sorts {
+		switch d := s.Value.(type) {
+		case int:
+			directions[i] = d
+		case int32:
+			directions[i] = int(d)
+		case int64:
+			directions[i] = int(d)
+		default:
+			return unsupported(fmt.Sprintf("sort on %s by %v", s.Key, s.Value))
+		}
+	}
+
+	sort.SliceStable(docs, func(i, j int) bool {
+		for k, s := range sorts {
+			a, _ := lookup(docs[i], s.Key)
+			b, _ := lookup(docs[j], s.Key)
+			if c := compareValues(a, b); c != 0 {
+				return c*directions[k] < 0
+			}
+		}
+		return false
+	})
+	return nil
+}
+
+// project keeps the fields of an inclusion projection or drops the fields of
+// an exclusion one, _id is kept unless it is excluded
+func project(doc bson.M, projection bson.M) (bson.M, error) {
+	if len(projection) == 0 {
+		return doc, nil
+	}
+
+	include := false
+	for field, v := range projection {
+		if _, ok := v.(bson.M); ok {
+			return nil, unsupported("projection of " + field)
+		}
+		if field != "_id" && truthy(v) {
+			include = true
+		}
+	}
+
+	projected := bson.M{}
+	if !include {
+		for field, v := range doc {
+			projected[field] = v
+		}
+	}
+
+	for field, v := range projection {
+		if field == "_id" {
+			continue
+		}
+		if include {
+			if value, ok := lookup(doc, field); ok {
+				setPath(projected, field, value)
+			}
+		} else if !truthy(v) {
+			unsetPath(projected, field)
+		}
+	}
+
+	if v, ok := projection["_id"]; !ok || truthy(v) {
+		projected["_id"] = doc["_id"]
+	} else {
+		delete(projected, "_id")
+	}
+	return projected, nil
+}
+
+// applyUpdate returns doc changed by the $set and $unset of update
+func applyUpdate(doc bson.M, update bson.M) (bson.M, error) {
+	updated, err := toDocument(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for op, v := range update {
+		// a struct is set field by field, like the driver does
+		fields, err := toDocument(v)
+		if err != nil {
+			return nil, fmt.Errorf("update %s should be a document: %v", op, err)
+		}
+
+		for field, value := range fields {
+			switch op {
+			case "$set":
+				setPath(updated, field, value)
+			case "$unset":
+				unsetPath(updated, field)
+			case "$setOnInsert":
+				// documents are never upserted
+			default:
+				return nil, unsupported("update " + op)
+			}
+		}
+	}
+	return updated, nil
+}
@@ -0,0 +1,58 @@
+package repository
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestSortDocuments(t *testing.T) {
+	docs := func() []bson.M {
+		return []bson.M{
+			{"_id": 1, "name": "Rice", "price": 40, "country": "TH"},
+			{"_id": 2, "name": "Corn", "price": 25.5, "country": "VN"},
+			{"_id": 3, "name": "Tea", "country": "TH"},
+			{"_id": 4, "name": "Salt", "price": nil, "country": "VN"},
+			{"_id": 5, "name": "Milk", "price": 40, "country": "LA"},
+		}
+	}
+
+	tests := []struct {
+		name  string
+		sorts bson.D
+		want  []int
+	}{
+		{"none", bson.D{}, []int{1, 2, 3, 4, 5}},
+		{"ascending", bson.D{{Key: "name", Value: 1}}, []int{2, 5, 1, 4, 3}},
+		{"descending", bson.D{{Key: "name", Value: int32(-1)}}, []int{3, 4, 1, 5, 2}},
+		{"missing and null first", bson.D{{Key: "price", Value: 1}}, []int{3, 4, 2, 1, 5}},
+		{"missing and null last", bson.D{{Key: "price", Value: int64(-1)}}, []int{1, 5, 2, 3, 4}},
+		{"tie breaker", bson.D{{Key: "price", Value: -1}, {Key: "country", Value: 1}}, []int{5, 1, 2, 3, 4}},
+		{"stable", bson.D{{Key: "country", Value: 1}}, []int{5, 1, 3, 2, 4}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := docs()
+			if err := sortDocuments(got, tt.sorts); err != nil {
+				t.Fatalf("sortDocuments(%v) error: %v", tt.sorts, err)
+			}
+
+			ids := []int{}
+			for _, doc := range got {
+				ids = append(ids, doc["_id"].(int))
+			}
+			if !reflect.DeepEqual(ids, tt.want) {
+				t.Errorf("sortDocuments(%v) = %v, want %v", tt.sorts, ids, tt.want)
+			}
+		})
+	}
+}
+
+func TestSortDocumentsUnsupported(t *testing.T) {
+	err := sortDocuments([]bson.M{{"name": "Rice"}}, bson.D{{Key: "name", Value: bson.M{"$meta": "textScore"}}})
+	if err == nil {
+		t.Error("sortDocuments on a $meta should fail")
+	}
+}
@@ -0,0 +1,80 @@
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// mongoRepository is a Repository backed by a mongo collection
+type mongoRepository[T any] struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoRepository[T]) Insert(ctx context.Context, docs ...T) error {
+	if len(docs) == 0 {
+		return nil
+	}
+
+	values := make([]interface{}, 0, len(docs))
+	for _, doc := range docs {
+		values = append(values, doc)
+	}
+
+	_, err := r.collection.InsertMany(ctx, values)
+	return err
+}
+
+func (r *mongoRepository[T]) Get(ctx context.Context, filter bson.M, projection bson.M, result interface{}) error {
+	opts := options.FindOne()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+	return r.collection.FindOne(ctx, filter, opts).Decode(result)
+}
+
+func (r *mongoRepository[T]) Find(ctx context.Context, q Query, results interface{}) error {
+	opts := options.Find()
+	if len(q.Sort) > 0 {
+		opts.SetSort(q.Sort)
+	}
+	if q.Projection != nil {
+		opts.SetProjection(q.Projection)
+	}
+	if q.Skip > 0 {
+		opts.SetSkip(q.Skip)
+	}
+	if q.Limit > 0 {
+		opts.SetLimit(q.Limit)
+	}
+
+	cur, err := r.collection.Find(ctx, q.Filter, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	return cur.All(ctx, results)
+}
+
+func (r *mongoRepository[T]) Count(ctx context.Context, filter bson.M) (int64, error) {
+	return r.collection.CountDocuments(ctx, filter)
+}
+
+func (r *mongoRepository[T]) Update(ctx context.Context, filter bson.M, update bson.M) (UpdateResult, error) {
+	result, err := r.collection.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return UpdateResult{}, err
+	}
+	return UpdateResult{Matched: result.MatchedCount, Modified: result.ModifiedCount}, nil
+}
+
+func (r *mongoRepository[T]) Delete(ctx context.Context, filter bson.M) (int64, error) {
+	result, err := r.collection.DeleteOne(ctx, filter)
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
@@ -0,0 +1,59 @@
+// Package repository reads and writes the documents of a mongo collection,
+// or of a memory store that behaves like one in tests.
+package repository
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// ErrNotFound is returned when no document matches, it is the error of the
+// mongo driver so problem.Mongo answers it with a 404 from either implementation
+var ErrNotFound = mongo.ErrNoDocuments
+
+// Query selects a page of documents. Sort, Projection, Skip and Limit are
+// optional, a Limit of 0 returns every match
+type Query struct {
+	Filter     bson.M
+	Sort       bson.D
+	Projection bson.M
+	Skip       int64
+	Limit      int64
+}
+
+// UpdateResult is how many documents an update matched and changed
+type UpdateResult struct {
+	Matched  int64
+	Modified int64
+}
+
+// Repository reads and writes the documents of one collection. Filters and
+// updates are mongo documents, results are decoded like a mongo cursor does
+// so they can be models or bson.M when only some fields are projected
+type Repository[T any] interface {
+	// Insert adds documents whose ids are already set
+	Insert(ctx context.Context, docs ...T) error
+	// Get decodes the first document matching filter into result, projection
+	// is optional. It returns ErrNotFound without a match
+	Get(ctx context.Context, filter bson.M, projection bson.M, result interface{}) error
+	// Find decodes the documents matching q into results, a pointer to a slice
+	Find(ctx context.Context, q Query, results interface{}) error
+	// Count is the number of documents matching filter
+	Count(ctx context.Context, filter bson.M) (int64, error)
+	// Update applies update to the first document matching filter
+	Update(ctx context.Context, filter bson.M, update bson.M) (UpdateResult, error)
+	// Delete removes the first document matching filter and returns how many it removed
+	Delete(ctx context.Context, filter bson.M) (int64, error)
+}
+
+// NewMongo reads and writes the documents of collection
+func NewMongo[T any](collection *mongo.Collection) Repository[T] {
+	return &mongoRepository[T]{collection: collection}
+}
+
+// NewMemory keeps documents in memory, for tests
+func NewMemory[T any]() Repository[T] {
+	return newMemoryRepository[T]()
+}
@@ -0,0 +1,145 @@
+// Package validation checks the validate tags of the models and reports every
+// broken rule with the json path of its field. A service adds its own rules
+// with New
+package validation
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/go-playground/validator/v10"
+)
+
+// FieldError reports one broken rule. Field is the json path of the field and
+// Index the position of the item when a batch is validated
+type FieldError struct {
+	Field   string `json:"field"`
+	Index   *int   `json:"index,omitempty"`
+	Rule    string `json:"rule"`
+	Message string `json:"message"`
+}
+
+// Errors is the list of every broken rule
+type Errors []FieldError
+
+func (errs Errors) Error() string {
+	messages := []string{}
+	for _, e := range errs {
+		messages = append(messages, e.Message)
+	}
+	return strings.Join(messages, ", ")
+}
+
+// Rule is a validate tag of a service, Message is the message of a field
+// breaking it
+type Rule struct {
+	Tag     string
+	Func    validator.Func
+	Message func(field string, param string) string
+}
+
+// Validator checks the validate tags of the built in rules and of its own rules
+type Validator struct {
+	validate *validator.Validate
+	messages map[string]func(field string, param string) string
+}
+
+// New returns a validator knowing rules on top of the built in ones. A rule
+// that can not be registered is a programming error, New panics on it
+func New(rules ...Rule) *Validator {
+	v := validator.New()
+
+	// report fields with their json name
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	messages := map[string]func(field string, param string) string{}
+	for _, rule := range rules {
+		if err := v.RegisterValidation(rule.Tag, rule.Func); err != nil {
+			panic(fmt.Sprintf("validation rule %s: %v", rule.Tag, err))
+		}
+		messages[rule.Tag] = rule.Message
+	}
+
+	return &Validator{validate: v, messages: messages}
+}
+
+// Struct checks the validate tags of s
+func (v *Validator) Struct(s interface{}) Errors {
+	return v.check(s, nil)
+}
+
+// Slice checks every item of items and sets the index of each error
+func (v *Validator) Slice(items interface{}) Errors {
+	errs := Errors{}
+
+	list := reflect.ValueOf(items)
+	for i := 0; i < list.Len(); i++ {
+		index := i
+		errs = append(errs, v.check(list.Index(i).Interface(), &index)...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+func (v *Validator) check(s interface{}, index *int) Errors {
+	err := v.validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	validationErrors, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return Errors{{Index: index, Rule: "invalid", Message: err.Error()}}
+	}
+
+	errs := Errors{}
+	for _, fe := range validationErrors {
+		// drop the struct name from Product.productName
+		field := fe.Namespace()
+		if i := strings.Index(field, "."); i != -1 {
+			field = field[i+1:]
+		}
+
+		errs = append(errs, FieldError{
+			Field:   field,
+			Index:   index,
+			Rule:    fe.Tag(),
+			Message: v.message(field, fe),
+		})
+	}
+
+	return errs
+}
+
+func (v *Validator) message(field string, fe validator.FieldError) string {
+	if message, ok := v.messages[fe.Tag()]; ok {
+		return message(field, fe.Param())
+	}
+
+	switch fe.Tag() {
+	case "required":
+		return field + " is required"
+	case "min", "gte":
+		return fmt.Sprintf("%s should be at least %s", field, fe.Param())
+	case "max", "lte":
+		return fmt.Sprintf("%s should be at most %s", field, fe.Param())
+	case "oneof":
+		return fmt.Sprintf("%s should be one of %s", field, strings.Join(strings.Fields(fe.Param()), ", "))
+	case "eq":
+		return fmt.Sprintf("%s should be %s", field, fe.Param())
+	case "isdefault":
+		return field + " is read only"
+	}
+
+	return fmt.Sprintf("%s is invalid (%s)", field, fe.Tag())
+}
@@ -0,0 +1,109 @@
+package validation
+
+import (
+	"testing"
+
+	"github.com/go-playground/validator/v10"
+)
+
+type place struct {
+	Name     string `json:"name" validate:"required"`
+	Kind     string `json:"kind" validate:"omitempty,oneof=city town"`
+	Rank     int    `json:"rank" validate:"gte=0,lte=10"`
+	Code     string `json:"code" validate:"omitempty,even"`
+	Score    int    `json:"score,omitempty" validate:"isdefault"`
+	Location struct {
+		Country string `json:"country" validate:"required"`
+	} `json:"location"`
+}
+
+func evenLength(fl validator.FieldLevel) bool {
+	return len(fl.Field().String())%2 == 0
+}
+
+func TestStruct(t *testing.T) {
+	v := New(Rule{
+		Tag:     "even",
+		Func:    evenLength,
+		Message: func(field string, param string) string { return field + " should have an even length" },
+	})
+
+	valid := func() place {
+		p := place{Name: "Bangkok", Kind: "city", Rank: 1, Code: "BK"}
+		p.Location.Country = "TH"
+		return p
+	}
+
+	tests := []struct {
+		name    string
+		change  func(*place)
+		field   string
+		rule    string
+		message string
+	}{
+		{"valid", func(p *place) {}, "", "", ""},
+		{"required", func(p *place) { p.Name = "" }, "name", "required", "name is required"},
+		{"oneof", func(p *place) { p.Kind = "village" }, "kind", "oneof", "kind should be one of city, town"},
+		{"gte", func(p *place) { p.Rank = -1 }, "rank", "gte", "rank should be at least 0"},
+		{"lte", func(p *place) { p.Rank = 11 }, "rank", "lte", "rank should be at most 10"},
+		{"read only", func(p *place) { p.Score = 3 }, "score", "isdefault", "score is read only"},
+		{"nested", func(p *place) { p.Location.Country = "" }, "location.country", "required", "location.country is required"},
+		{"service rule", func(p *place) { p.Code = "BKK" }, "code", "even", "code should have an even length"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := valid()
+			tt.change(&p)
+
+			errs := v.Struct(p)
+			if tt.field == "" {
+				if errs != nil {
+					t.Fatalf("Struct = %v, want no error", errs)
+				}
+				return
+			}
+
+			if len(errs) != 1 {
+				t.Fatalf("Struct = %v, want one error", errs)
+			}
+			got := errs[0]
+			if got.Field != tt.field || got.Rule != tt.rule || got.Message != tt.message || got.Index != nil {
+				t.Errorf("Struct = %+v, want %s %s %q", got, tt.field, tt.rule, tt.message)
+			}
+		})
+	}
+}
+
+func TestSlice(t *testing.T) {
+	type item struct {
+		Name string `json:"name" validate:"required"`
+	}
+	v := New()
+
+	if errs := v.Slice([]item{{"Rice"}, {"Tea"}}); errs != nil {
+		t.Fatalf("Slice = %v, want nil", errs)
+	}
+
+	errs := v.Slice([]item{{"Rice"}, {""}, {"Tea"}, {""}})
+	if len(errs) != 2 {
+		t.Fatalf("Slice = %v, want two errors", errs)
+	}
+	for i, want := range []int{1, 3} {
+		if errs[i].Index == nil || *errs[i].Index != want {
+			t.Errorf("error %d index = %v, want %d", i, errs[i].Index, want)
+		}
+	}
+	if errs.Error() != "name is required, name is required" {
+		t.Errorf("Error() = %q", errs.Error())
+	}
+}
+
+func TestNewPanicsOnInvalidRule(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("New should panic on a rule without a tag")
+		}
+	}()
+	New(Rule{Func: evenLength})
+}